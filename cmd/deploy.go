@@ -8,6 +8,7 @@ import (
 	"github.com/DQGriffin/labrador/internal/cli/console"
 	"github.com/DQGriffin/labrador/internal/commands"
 	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/plan"
 	"github.com/DQGriffin/labrador/internal/services/aws"
 	"github.com/DQGriffin/labrador/pkg/utils"
 	"github.com/urfave/cli/v2"
@@ -54,6 +55,27 @@ func DeployCommand(flags []cli.Flag) *cli.Command {
 				Name:  "stage-types",
 				Usage: "Restrict deployment to specific stage types",
 			},
+			&cli.IntFlag{
+				Name:  "parallelism",
+				Usage: "Maximum number of resources to deploy at once",
+				Value: 4,
+			},
+			&cli.StringFlag{
+				Name:  "plan",
+				Usage: "Apply a plan saved with plan --out",
+			},
+			&cli.BoolFlag{
+				Name:  "prune-removed",
+				Usage: "Delete managed resources that were removed from their stage's config. Buckets are never deleted",
+			},
+			&cli.StringSliceFlag{
+				Name:  "enable-stage",
+				Usage: "Enable a stage by name, overriding its enabled setting. Can be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  "disable-stage",
+				Usage: "Disable a stage by name, overriding its enabled setting. Can be repeated",
+			},
 		},
 		Before: func(c *cli.Context) error {
 			console.SetColorEnabled(!c.Bool("no-color"))
@@ -63,6 +85,15 @@ func DeployCommand(flags []cli.Flag) *cli.Command {
 				return fmt.Errorf("you can't use --only-create and --only-update at the same time")
 			}
 
+			if c.Int("parallelism") < 1 {
+				return fmt.Errorf("--parallelism must be at least 1")
+			}
+
+			if c.String("plan") != "" && (c.Bool("only-create") || c.Bool("only-update") || c.String("stage-types") != "" || c.Bool("prune-removed") ||
+				len(c.StringSlice("enable-stage")) > 0 || len(c.StringSlice("disable-stage")) > 0) {
+				return fmt.Errorf("--plan can't be combined with --only-create, --only-update, --stage-types, --prune-removed, --enable-stage or --disable-stage")
+			}
+
 			if c.String("env-file") != "" {
 				helpers.LoadEnvFile(c.String("env-file"))
 			}
@@ -97,7 +128,7 @@ func DeployCommand(flags []cli.Flag) *cli.Command {
 				helpers.LoadEnvFile(c.String("env-file"))
 			}
 
-			config, err := helpers.LoadProject(projectPath)
+			config, err := helpers.LoadProject(projectPath, c.String("env"))
 
 			if err != nil {
 				console.Error("Could not load project configuration")
@@ -105,9 +136,18 @@ func DeployCommand(flags []cli.Flag) *cli.Command {
 				os.Exit(1)
 			}
 
+			if err := helpers.ApplyStageOverrides(&config.Project, c.StringSlice("enable-stage"), c.StringSlice("disable-stage")); err != nil {
+				console.Fatal(err.Error())
+			}
+
 			utils.ReadCliArgs(c)
 
-			existingLambdas, err := aws.ListLambdas()
+			var env = config.Project.Environment
+			if c.String("env") != "" {
+				env = c.String("env")
+			}
+
+			existingLambdas, err := aws.ListLambdas(config.Project.Stages)
 
 			if err != nil {
 				console.Fatal("Could not list lambdas in AWS account. Check permissions ", err.Error())
@@ -132,22 +172,67 @@ func DeployCommand(flags []cli.Flag) *cli.Command {
 
 			console.Debugf("Found %d API gateways in the account", len(existingApiGateways))
 
-			onlyCreate := c.Bool("only-create")
-			onlyUpdate := c.Bool("only-update")
+			if c.Bool("dry-run") {
+				st, err := helpers.LoadState(config, env)
+				if err != nil {
+					console.Fatal("Could not load deployment state. ", err.Error())
+				}
+
+				stageTypesMap := parseStageTypes(c.String("stage-types"))
+				_, err = commands.HandlePlanCommand(config, st, &stageTypesMap, existingLambdas, existingBuckets, existingApiGateways, c.Bool("prune-removed"))
+				return err
+			}
 
-			stageTypesMap := make(map[string]bool)
-			if c.String("stage-types") != "" {
-				stageTypes := strings.Split(c.String("stage-types"), ",")
+			// Read the plan before locking, so a bad path doesn't leave the state locked
+			var saved *plan.Plan
+			if c.String("plan") != "" {
+				saved, err = plan.Load(c.String("plan"))
+				if err != nil {
+					return err
+				}
+			}
 
-				for _, stageType := range stageTypes {
-					stageTypesMap[stageType] = true
+			st, err := helpers.LockState(config, env, "deploy")
+			if err != nil {
+				console.Fatal("Could not lock deployment state. ", err.Error())
+			}
+			defer unlockState(st)
+
+			if saved != nil {
+				// Return rather than exit so the state lock is released
+				opts := commands.DeployOptions{Parallelism: c.Int("parallelism")}
+				if err := commands.HandleApplyPlan(config, st, saved, opts, existingLambdas, existingBuckets, existingApiGateways); err != nil {
+					return err
 				}
+
+				console.Info("Done")
+				return nil
+			}
+
+			stageTypesMap := parseStageTypes(c.String("stage-types"))
+			opts := commands.DeployOptions{
+				OnlyCreate:   c.Bool("only-create"),
+				OnlyUpdate:   c.Bool("only-update"),
+				PruneRemoved: c.Bool("prune-removed"),
+				Parallelism:  c.Int("parallelism"),
 			}
 
-			commands.HandleDeployCommand(config, &stageTypesMap, existingLambdas, existingBuckets, &existingApiGateways, onlyCreate, onlyUpdate)
+			if err := commands.HandleDeployCommand(config, st, &stageTypesMap, existingLambdas, existingBuckets, &existingApiGateways, opts); err != nil {
+				return err
+			}
 
 			console.Info("Done")
 			return nil
 		},
 	}
 }
+
+func parseStageTypes(value string) map[string]bool {
+	stageTypesMap := make(map[string]bool)
+	if value != "" {
+		for _, stageType := range strings.Split(value, ",") {
+			stageTypesMap[stageType] = true
+		}
+	}
+	return stageTypesMap
+}
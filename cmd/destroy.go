@@ -45,6 +45,14 @@ func DestroyCommand(flags []cli.Flag) *cli.Command {
 				Usage:   "Restrict destroy operations for stage types in a comma-separated list",
 				EnvVars: []string{"STAGE_TYPES"},
 			},
+			&cli.StringSliceFlag{
+				Name:  "enable-stage",
+				Usage: "Enable a stage by name, overriding its enabled setting. Can be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  "disable-stage",
+				Usage: "Disable a stage by name, overriding its enabled setting. Can be repeated",
+			},
 		},
 		Before: func(c *cli.Context) error {
 			console.SetColorEnabled(!c.Bool("no-color"))
@@ -69,18 +77,28 @@ func DestroyCommand(flags []cli.Flag) *cli.Command {
 
 			var isDryRun = c.Bool("dry-run")
 
-			config, err := helpers.LoadProject(projectPath)
+			config, err := helpers.LoadProject(projectPath, c.String("env"))
 
 			if err != nil {
 				console.Error("Could not load project configuration")
 				console.Fatal(err.Error())
 			}
 
+			if err := helpers.ApplyStageOverrides(&config.Project, c.StringSlice("enable-stage"), c.StringSlice("disable-stage")); err != nil {
+				console.Fatal(err.Error())
+			}
+
 			var env = config.Project.Environment
 			if c.String("env") != "" {
 				env = c.String("env")
 			}
 
+			st, err := helpers.LockState(config, env, "destroy")
+			if err != nil {
+				console.Fatal("Could not lock deployment state. ", err.Error())
+			}
+			defer unlockState(st)
+
 			stageTypesMap := make(map[string]bool)
 			if c.String("stage-types") != "" {
 				stageTypes := strings.Split(c.String("stage-types"), ",")
@@ -92,7 +110,7 @@ func DestroyCommand(flags []cli.Flag) *cli.Command {
 
 			force := c.Bool("force")
 
-			commandErr := commands.HandleDestroyCommand(config, isDryRun, force, &stageTypesMap, env)
+			commandErr := commands.HandleDestroyCommand(config, st, isDryRun, force, &stageTypesMap, env)
 			return commandErr
 		},
 	}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/commands"
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func DriftCommand(flags []cli.Flag) *cli.Command {
+	return &cli.Command{
+		Name:  "drift",
+		Usage: "Report managed resources whose live settings no longer match the config",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "env",
+				Usage:   "Deployment environment",
+				EnvVars: []string{"LABRADOR_ENV"},
+			},
+			&cli.StringFlag{
+				Name:    "project",
+				Usage:   "Path to project file",
+				EnvVars: []string{"PROJECT_PATH"},
+			},
+			&cli.StringFlag{
+				Name:    "env-file",
+				Usage:   "Path to env file",
+				EnvVars: []string{"ENV_FILE"},
+			},
+			&cli.StringFlag{
+				Name:  "stage-types",
+				Usage: "Restrict the check to specific stage types",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "Set output mode (plain, json)",
+				Value: "plain",
+			},
+			&cli.StringSliceFlag{
+				Name:  "enable-stage",
+				Usage: "Enable a stage by name, overriding its enabled setting. Can be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  "disable-stage",
+				Usage: "Disable a stage by name, overriding its enabled setting. Can be repeated",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			console.SetColorEnabled(!c.Bool("no-color"))
+			console.SetDebugOutputEnabled(c.Bool("debug"))
+
+			if c.String("output") != "plain" && c.String("output") != "json" {
+				return fmt.Errorf("--output must be plain or json")
+			}
+
+			if c.String("env-file") != "" {
+				helpers.LoadEnvFile(c.String("env-file"))
+			}
+			utils.ReadCliArgs(c)
+
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			var projectPath = "project.json"
+			if c.String("project") != "" {
+				projectPath = c.String("project")
+			} else {
+				console.Info("Project config file path not specified. Assuming project.json")
+			}
+
+			config, err := helpers.LoadProject(projectPath, c.String("env"))
+
+			if err != nil {
+				console.Error("Error: Could not load project configuration")
+				console.Fatal(err.Error())
+			}
+
+			if err := helpers.ApplyStageOverrides(&config.Project, c.StringSlice("enable-stage"), c.StringSlice("disable-stage")); err != nil {
+				console.Fatal(err.Error())
+			}
+
+			var env = config.Project.Environment
+			if c.String("env") != "" {
+				env = c.String("env")
+			}
+
+			st, err := helpers.LoadState(config, env)
+			if err != nil {
+				console.Fatal("Could not load deployment state. ", err.Error())
+			}
+
+			existingLambdas, err := aws.ListLambdas(config.Project.Stages)
+			if err != nil {
+				console.Fatal("An error occured while listing lambdas in the AWS account. ", err.Error())
+			}
+
+			ctx, cfg, err := aws.GetConfig("us-east-1")
+			if err != nil {
+				return err
+			}
+
+			client := aws.GetClient(cfg)
+			existingBuckets, bucketErr := aws.ListBuckets(ctx, client)
+			if bucketErr != nil {
+				console.Fatal("Could not list buckets in AWS account. Check permissions ", bucketErr.Error())
+			}
+
+			existingApiGateways, gatewayErr := aws.ListApiGateways(os.Getenv("AWS_REGION"))
+			if gatewayErr != nil {
+				console.Fatal(gatewayErr.Error())
+			}
+
+			stageTypesMap := parseStageTypes(c.String("stage-types"))
+			return commands.HandleDriftCommand(config, st, &stageTypesMap, c.String("output"), existingLambdas, existingBuckets, existingApiGateways)
+		},
+	}
+}
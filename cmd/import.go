@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/commands"
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func ImportCommand(flags []cli.Flag) *cli.Command {
+	return &cli.Command{
+		Name:  "import",
+		Usage: "Bring an existing AWS resource under Labrador's management",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "type",
+				Aliases: []string{"t"},
+				Usage:   "Type of the resource (lambda, s3, api)",
+			},
+			&cli.StringFlag{
+				Name:    "name",
+				Aliases: []string{"n"},
+				Usage:   "Name of the resource in AWS",
+			},
+			&cli.StringFlag{
+				Name:  "stage",
+				Usage: "Name of the stage to add the resource to",
+			},
+			&cli.StringFlag{
+				Name:  "region",
+				Usage: "Region the resource is in. Defaults to AWS_REGION",
+			},
+			&cli.StringFlag{
+				Name:  "code-dir",
+				Usage: "Directory to save an imported Lambda's code to",
+				Value: "code",
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Usage:   "Deployment environment",
+				EnvVars: []string{"LABRADOR_ENV"},
+			},
+			&cli.StringFlag{
+				Name:    "project",
+				Usage:   "Path to project file",
+				EnvVars: []string{"PROJECT_PATH"},
+			},
+			&cli.StringFlag{
+				Name:    "env-file",
+				Usage:   "Path to env file",
+				EnvVars: []string{"ENV_FILE"},
+			},
+		},
+		Before: func(c *cli.Context) error {
+			console.SetColorEnabled(!c.Bool("no-color"))
+			console.SetDebugOutputEnabled(c.Bool("debug"))
+
+			for _, flag := range []string{"type", "name", "stage"} {
+				if c.String(flag) == "" {
+					return fmt.Errorf("you must provide --%s", flag)
+				}
+			}
+
+			if c.String("env-file") != "" {
+				helpers.LoadEnvFile(c.String("env-file"))
+			}
+			utils.ReadCliArgs(c)
+
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			var projectPath = "project.json"
+			if c.String("project") != "" {
+				projectPath = c.String("project")
+			} else {
+				console.Info("Project config file path not specified. Assuming project.json")
+			}
+
+			config, err := helpers.LoadProject(projectPath, c.String("env"))
+			if err != nil {
+				console.Error("Could not load project configuration")
+				console.Fatal(err.Error())
+			}
+
+			var env = config.Project.Environment
+			if c.String("env") != "" {
+				env = c.String("env")
+			}
+
+			region := c.String("region")
+			if region == "" {
+				region = os.Getenv("AWS_REGION")
+			}
+			if region == "" {
+				return fmt.Errorf("you must provide --region or set AWS_REGION")
+			}
+
+			st, err := helpers.LockState(config, env, "import")
+			if err != nil {
+				console.Fatal("Could not lock deployment state. ", err.Error())
+			}
+			defer unlockState(st)
+
+			return commands.HandleImportCommand(config, st, commands.ImportOptions{
+				Type:    c.String("type"),
+				Name:    c.String("name"),
+				Stage:   c.String("stage"),
+				Region:  region,
+				CodeDir: c.String("code-dir"),
+			})
+		},
+	}
+}
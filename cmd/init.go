@@ -2,10 +2,15 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/commands"
+	"github.com/DQGriffin/labrador/internal/helpers"
 	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/DQGriffin/labrador/pkg/utils"
 	"github.com/urfave/cli/v2"
 )
 
@@ -31,6 +36,34 @@ func InitCommand(flags []cli.Flag) *cli.Command {
 				Usage:   "Path to output project config to",
 				EnvVars: []string{"OUTPUT"},
 			},
+			&cli.BoolFlag{
+				Name:  "from-account",
+				Usage: "Generate the project from the Lambdas, buckets, and HTTP APIs in an AWS region",
+			},
+			&cli.StringFlag{
+				Name:  "region",
+				Usage: "Region to discover resources in with --from-account. Defaults to AWS_REGION",
+			},
+			&cli.StringSliceFlag{
+				Name:  "filter-tag",
+				Usage: "Only discover resources with this tag, as key=value. Can be repeated",
+			},
+			&cli.StringFlag{
+				Name:    "env-file",
+				Usage:   "Path to env file",
+				EnvVars: []string{"ENV_FILE"},
+			},
+		},
+		Before: func(c *cli.Context) error {
+			console.SetColorEnabled(!c.Bool("no-color"))
+			console.SetDebugOutputEnabled(c.Bool("debug"))
+
+			if c.String("env-file") != "" {
+				helpers.LoadEnvFile(c.String("env-file"))
+			}
+			utils.ReadCliArgs(c)
+
+			return nil
 		},
 		Action: func(c *cli.Context) error {
 
@@ -49,6 +82,29 @@ func InitCommand(flags []cli.Flag) *cli.Command {
 				outputPath = c.String("output")
 			}
 
+			if c.Bool("from-account") {
+				filterTags, err := parseFilterTags(c.StringSlice("filter-tag"))
+				if err != nil {
+					return err
+				}
+
+				region := c.String("region")
+				if region == "" {
+					region = os.Getenv("AWS_REGION")
+				}
+				if region == "" {
+					return fmt.Errorf("you must provide --region or set AWS_REGION")
+				}
+
+				return commands.HandleInitFromAccount(commands.InitOptions{
+					Name:        projectName,
+					Environment: projectEnv,
+					Region:      region,
+					Output:      outputPath,
+					FilterTags:  filterTags,
+				})
+			}
+
 			project := types.Project{
 				Name:        projectName,
 				Environment: projectEnv,
@@ -79,3 +135,15 @@ func InitCommand(flags []cli.Flag) *cli.Command {
 		},
 	}
 }
+
+func parseFilterTags(values []string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, value := range values {
+		key, tagValue, found := strings.Cut(value, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("--filter-tag must be key=value, got %q", value)
+		}
+		tags[key] = tagValue
+	}
+	return tags, nil
+}
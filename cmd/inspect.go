@@ -44,6 +44,14 @@ func InspectCommand(flags []cli.Flag) *cli.Command {
 				Name:  "stage-types",
 				Usage: "Comma-separated list of stage types to include (e.g., 'lambda,api')",
 			},
+			&cli.StringSliceFlag{
+				Name:  "enable-stage",
+				Usage: "Enable a stage by name, overriding its enabled setting. Can be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  "disable-stage",
+				Usage: "Disable a stage by name, overriding its enabled setting. Can be repeated",
+			},
 		},
 		Before: func(c *cli.Context) error {
 			if c.String("env-file") != "" {
@@ -81,15 +89,29 @@ func InspectCommand(flags []cli.Flag) *cli.Command {
 				console.Info("Project config file path not specified. Assuming project.json")
 			}
 
-			config, err := helpers.LoadProject(projectPath)
+			config, err := helpers.LoadProject(projectPath, c.String("env"))
 
 			if err != nil {
 				console.Error("Could not load project configuration")
 				console.Fatal(err.Error())
 			}
 
+			if err := helpers.ApplyStageOverrides(&config.Project, c.StringSlice("enable-stage"), c.StringSlice("disable-stage")); err != nil {
+				console.Fatal(err.Error())
+			}
+
 			verbose := c.Bool("full")
 
+			var env = config.Project.Environment
+			if c.String("env") != "" {
+				env = c.String("env")
+			}
+
+			st, err := helpers.LoadState(config, env)
+			if err != nil {
+				console.Fatal("Could not load deployment state. ", err.Error())
+			}
+
 			stageTypesMap := make(map[string]bool)
 			if c.String("stage-types") != "" {
 				stageTypes := strings.Split(c.String("stage-types"), ",")
@@ -104,7 +126,7 @@ func InspectCommand(flags []cli.Flag) *cli.Command {
 				outputMode = c.String("output")
 			}
 
-			commands.HandleInspectCommand(&config, outputMode, &stageTypesMap, verbose)
+			commands.HandleInspectCommand(&config, st, outputMode, &stageTypesMap, verbose)
 
 			return nil
 		},
@@ -61,9 +61,14 @@ func main() {
 			cmd.DeployCommand(globalFlags),
 			cmd.InitCommand(globalFlags),
 			cmd.PlanCommand(globalFlags),
+			cmd.DriftCommand(globalFlags),
 			cmd.DestroyCommand(globalFlags),
 			cmd.InspectCommand(globalFlags),
 			cmd.AddCommand(globalFlags),
+			cmd.ImportCommand(globalFlags),
+			cmd.StateCommand(globalFlags),
+			cmd.PromoteCommand(globalFlags),
+			cmd.PruneCommand(globalFlags),
 		},
 	}
 
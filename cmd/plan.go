@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"os"
+	"strings"
+
 	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/commands"
 	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/plan"
 	"github.com/DQGriffin/labrador/internal/services/aws"
 	"github.com/DQGriffin/labrador/pkg/utils"
 	"github.com/urfave/cli/v2"
@@ -13,6 +18,11 @@ func PlanCommand(flags []cli.Flag) *cli.Command {
 		Name:  "plan",
 		Usage: "Preview actions labrador will take",
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "env",
+				Usage:   "Deployment environment",
+				EnvVars: []string{"LABRADOR_ENV"},
+			},
 			&cli.StringFlag{
 				Name:    "project",
 				Usage:   "Path to project file",
@@ -23,11 +33,36 @@ func PlanCommand(flags []cli.Flag) *cli.Command {
 				Usage:   "Path to env file",
 				EnvVars: []string{"ENV_FILE"},
 			},
+			&cli.StringFlag{
+				Name:  "stage-types",
+				Usage: "Restrict the plan to specific stage types",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "Save the plan to a file so it can be applied with deploy --plan",
+			},
+			&cli.BoolFlag{
+				Name:  "prune-removed",
+				Usage: "Delete managed resources that were removed from their stage's config. Buckets are never deleted",
+			},
+			&cli.StringSliceFlag{
+				Name:  "enable-stage",
+				Usage: "Enable a stage by name, overriding its enabled setting. Can be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  "disable-stage",
+				Usage: "Disable a stage by name, overriding its enabled setting. Can be repeated",
+			},
 		},
 		Before: func(c *cli.Context) error {
 			console.SetColorEnabled(!c.Bool("no-color"))
 			console.SetDebugOutputEnabled(c.Bool("debug"))
 
+			if c.String("env-file") != "" {
+				helpers.LoadEnvFile(c.String("env-file"))
+			}
+			utils.ReadCliArgs(c)
+
 			return nil
 		},
 		Action: func(c *cli.Context) error {
@@ -40,37 +75,70 @@ func PlanCommand(flags []cli.Flag) *cli.Command {
 				console.Info("Project config file path not specified. Assuming project.json")
 			}
 
-			config, err := helpers.LoadProject(projectPath)
+			config, err := helpers.LoadProject(projectPath, c.String("env"))
 
 			if err != nil {
 				console.Error("Error: Could not load project configuration")
 				console.Fatal(err.Error())
 			}
 
-			utils.ReadCliArgs(c)
+			if err := helpers.ApplyStageOverrides(&config.Project, c.StringSlice("enable-stage"), c.StringSlice("disable-stage")); err != nil {
+				console.Fatal(err.Error())
+			}
 
-			existingLambdas, err := aws.ListLambdas()
+			var env = config.Project.Environment
+			if c.String("env") != "" {
+				env = c.String("env")
+			}
+
+			st, err := helpers.LoadState(config, env)
+			if err != nil {
+				console.Fatal("Could not load deployment state. ", err.Error())
+			}
+
+			existingLambdas, err := aws.ListLambdas(config.Project.Stages)
 
 			if err != nil {
 				console.Fatal("An error occured while listing lambdas in the AWS account. ", err.Error())
 			}
 
-			var createCount = 0
-			var updateCount = 0
-
-			for _, functionGroup := range config.FunctionData {
-				for _, function := range functionGroup.Functions {
-					if _, exists := existingLambdas[function.Name]; exists {
-						console.Info("Will be updated:", function.Name)
-						updateCount += 1
-					} else {
-						console.Info("Will be created", function.Name)
-						createCount += 1
-					}
+			ctx, cfg, err := aws.GetConfig("us-east-1")
+
+			if err != nil {
+				return err
+			}
+
+			client := aws.GetClient(cfg)
+			existingBuckets, bucketErr := aws.ListBuckets(ctx, client)
+			if bucketErr != nil {
+				console.Fatal("Could not list buckets in AWS account. Check permissions ", bucketErr.Error())
+			}
+
+			existingApiGateways, gatewayErr := aws.ListApiGateways(os.Getenv("AWS_REGION"))
+			if gatewayErr != nil {
+				console.Fatal(gatewayErr.Error())
+			}
+
+			stageTypesMap := make(map[string]bool)
+			if c.String("stage-types") != "" {
+				stageTypes := strings.Split(c.String("stage-types"), ",")
+
+				for _, stageType := range stageTypes {
+					stageTypesMap[stageType] = true
 				}
 			}
 
-			console.Infof("Plan complete: %d to create, %d to update, %d to destroy\n", createCount, updateCount, 0)
+			p, err := commands.HandlePlanCommand(config, st, &stageTypesMap, existingLambdas, existingBuckets, existingApiGateways, c.Bool("prune-removed"))
+			if err != nil {
+				return err
+			}
+
+			if c.String("out") != "" {
+				if err := plan.Save(p, c.String("out")); err != nil {
+					console.Fatal(err.Error())
+				}
+				console.Infof("Plan saved to %s. Apply it with labrador deploy --plan %s", c.String("out"), c.String("out"))
+			}
 
 			return nil
 		},
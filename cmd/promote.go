@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/commands"
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func PromoteCommand(flags []cli.Flag) *cli.Command {
+	return &cli.Command{
+		Name:  "promote",
+		Usage: "Send all of an alias's traffic to the version it's shifting traffic to",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "function",
+				Usage:    "Name of the function",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "alias",
+				Usage:    "Name of the alias to promote",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Usage:   "Deployment environment",
+				EnvVars: []string{"LABRADOR_ENV"},
+			},
+			&cli.StringFlag{
+				Name:    "project",
+				Usage:   "Path to project file",
+				EnvVars: []string{"PROJECT_PATH"},
+			},
+			&cli.StringFlag{
+				Name:    "env-file",
+				Usage:   "Path to env file",
+				EnvVars: []string{"ENV_FILE"},
+			},
+		},
+		Before: func(c *cli.Context) error {
+			console.SetColorEnabled(!c.Bool("no-color"))
+			console.SetDebugOutputEnabled(c.Bool("debug"))
+
+			if c.String("env-file") != "" {
+				helpers.LoadEnvFile(c.String("env-file"))
+			}
+			utils.ReadCliArgs(c)
+
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			var projectPath = "project.json"
+			if c.String("project") != "" {
+				projectPath = c.String("project")
+			} else {
+				console.Info("Project config file path not specified. Assuming project.json")
+			}
+
+			config, err := helpers.LoadProject(projectPath, c.String("env"))
+			if err != nil {
+				console.Error("Error: Could not load project configuration")
+				console.Fatal(err.Error())
+			}
+
+			return commands.HandlePromoteCommand(config, c.String("function"), c.String("alias"))
+		},
+	}
+}
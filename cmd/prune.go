@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/commands"
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func PruneCommand(flags []cli.Flag) *cli.Command {
+	return &cli.Command{
+		Name:  "prune",
+		Usage: "Delete old Lambda versions beyond each function's retainVersions",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "env",
+				Usage:   "Deployment environment",
+				EnvVars: []string{"LABRADOR_ENV"},
+			},
+			&cli.StringFlag{
+				Name:    "project",
+				Usage:   "Path to project file",
+				EnvVars: []string{"PROJECT_PATH"},
+			},
+			&cli.StringFlag{
+				Name:    "env-file",
+				Usage:   "Path to env file",
+				EnvVars: []string{"ENV_FILE"},
+			},
+			&cli.StringFlag{
+				Name:  "function",
+				Usage: "Only prune versions of this function",
+			},
+			&cli.BoolFlag{
+				Name:    "dry-run",
+				Usage:   "List the versions that would be deleted without deleting them",
+				EnvVars: []string{"DRY_RUN"},
+			},
+			&cli.StringSliceFlag{
+				Name:  "enable-stage",
+				Usage: "Enable a stage by name, overriding its enabled setting. Can be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  "disable-stage",
+				Usage: "Disable a stage by name, overriding its enabled setting. Can be repeated",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			console.SetColorEnabled(!c.Bool("no-color"))
+			console.SetDebugOutputEnabled(c.Bool("debug"))
+
+			if c.String("env-file") != "" {
+				helpers.LoadEnvFile(c.String("env-file"))
+			}
+			utils.ReadCliArgs(c)
+
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			var projectPath = "project.json"
+			if c.String("project") != "" {
+				projectPath = c.String("project")
+			} else {
+				console.Info("Project config file path not specified. Assuming project.json")
+			}
+
+			config, err := helpers.LoadProject(projectPath, c.String("env"))
+			if err != nil {
+				console.Error("Error: Could not load project configuration")
+				console.Fatal(err.Error())
+			}
+
+			if err := helpers.ApplyStageOverrides(&config.Project, c.StringSlice("enable-stage"), c.StringSlice("disable-stage")); err != nil {
+				console.Fatal(err.Error())
+			}
+
+			var env = config.Project.Environment
+			if c.String("env") != "" {
+				env = c.String("env")
+			}
+
+			isDryRun := c.Bool("dry-run")
+
+			var st *state.State
+			if isDryRun {
+				st, err = helpers.LoadState(config, env)
+				if err != nil {
+					console.Fatal("Could not load deployment state. ", err.Error())
+				}
+			} else {
+				st, err = helpers.LockState(config, env, "prune")
+				if err != nil {
+					console.Fatal("Could not lock deployment state. ", err.Error())
+				}
+				defer unlockState(st)
+			}
+
+			return commands.HandlePruneCommand(config, st, c.String("function"), isDryRun)
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/commands"
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/DQGriffin/labrador/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func StateCommand(flags []cli.Flag) *cli.Command {
+	stateFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:    "env",
+			Usage:   "Deployment environment",
+			EnvVars: []string{"LABRADOR_ENV"},
+		},
+		&cli.StringFlag{
+			Name:    "project",
+			Usage:   "Path to project file",
+			EnvVars: []string{"PROJECT_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    "env-file",
+			Usage:   "Path to env file",
+			EnvVars: []string{"ENV_FILE"},
+		},
+	}
+
+	return &cli.Command{
+		Name:  "state",
+		Usage: "Manage deployment state",
+		Before: func(c *cli.Context) error {
+			console.SetColorEnabled(!c.Bool("no-color"))
+			console.SetDebugOutputEnabled(c.Bool("debug"))
+			return nil
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:  "lock",
+				Usage: "Lock the state so no other deploy or destroy can run",
+				Flags: stateFlags,
+				Action: func(c *cli.Context) error {
+					config, env := loadStateCommandProject(c)
+					return commands.HandleStateLock(config, env)
+				},
+			},
+			{
+				Name:  "unlock",
+				Usage: "Release a lock you are holding",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:     "id",
+						Usage:    "ID of the lock, as printed by state lock",
+						Required: true,
+					},
+				}, stateFlags...),
+				Action: func(c *cli.Context) error {
+					config, env := loadStateCommandProject(c)
+					return commands.HandleStateUnlock(config, env, c.String("id"), false)
+				},
+			},
+			{
+				Name:  "force-unlock",
+				Usage: "Release a lock regardless of who is holding it",
+				Flags: stateFlags,
+				Action: func(c *cli.Context) error {
+					config, env := loadStateCommandProject(c)
+					return commands.HandleStateUnlock(config, env, "", true)
+				},
+			},
+		},
+	}
+}
+
+func loadStateCommandProject(c *cli.Context) (types.LabradorConfig, string) {
+	if c.String("env-file") != "" {
+		helpers.LoadEnvFile(c.String("env-file"))
+	}
+	utils.ReadCliArgs(c)
+
+	var projectPath = "project.json"
+	if c.String("project") != "" {
+		projectPath = c.String("project")
+	} else {
+		console.Info("Project config file path not specified. Assuming project.json")
+	}
+
+	config, err := helpers.LoadProject(projectPath, c.String("env"))
+	if err != nil {
+		console.Error("Could not load project configuration")
+		console.Fatal(err.Error())
+	}
+
+	var env = config.Project.Environment
+	if c.String("env") != "" {
+		env = c.String("env")
+	}
+
+	return config, env
+}
+
+func unlockState(st *state.State) {
+	err := st.Unlock()
+	if err != nil {
+		console.Errorf("Failed to release state lock: %s", err.Error())
+		console.Info("Run 'labrador state force-unlock' to release it manually")
+	}
+}
@@ -3,8 +3,10 @@ package console
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/DQGriffin/labrador/internal/cli/styles"
+	"github.com/charmbracelet/lipgloss"
 )
 
 var debugPrefix = "[DEBUG] "
@@ -14,6 +16,16 @@ var errorPrefix = "[ERROR] "
 var isColorEnabled = false
 var isDebugOutputEnabled = false
 
+// outputMu keeps lines, and flushed groups, from being interleaved when
+// resources are deployed concurrently
+var outputMu sync.Mutex
+
+// line is a single rendered line of output
+type line struct {
+	stderr bool
+	text   string
+}
+
 func SetColorEnabled(value bool) {
 	isColorEnabled = value
 }
@@ -23,107 +35,49 @@ func SetDebugOutputEnabled(value bool) {
 }
 
 func Heading(args ...interface{}) {
-	text := fmt.Sprint(args...)
-	if isColorEnabled {
-		fmt.Println(styles.Heading.Render(text))
-	} else {
-		fmt.Println(text)
-	}
+	emit(render(false, styles.Heading, fmt.Sprint(args...)))
 }
 
 func Headingf(format string, args ...interface{}) {
-	output := fmt.Sprintf(format, args...)
-	if isColorEnabled {
-		fmt.Println()
-		fmt.Println(styles.Heading.Render(output))
-	} else {
-		fmt.Println(output)
-	}
+	emit(headingLines(fmt.Sprintf(format, args...))...)
 }
 
 func Debug(args ...interface{}) {
 	if !isDebugOutputEnabled {
 		return
 	}
-
-	text := fmt.Sprint(args...)
-	debugText := debugPrefix + text
-	if isColorEnabled {
-		fmt.Fprintln(os.Stderr, styles.Primary.Render(debugText))
-	} else {
-		fmt.Fprintln(os.Stderr, debugText)
-	}
+	emit(render(true, styles.Primary, debugPrefix+fmt.Sprint(args...)))
 }
 
 func Debugf(format string, args ...interface{}) {
 	if !isDebugOutputEnabled {
 		return
 	}
-	output := fmt.Sprintf(format, args...)
-	formatted := debugPrefix + output
-	if isColorEnabled {
-		fmt.Fprintln(os.Stderr, styles.Primary.Render(formatted))
-	} else {
-		fmt.Fprintln(os.Stderr, formatted)
-	}
+	emit(render(true, styles.Primary, debugPrefix+fmt.Sprintf(format, args...)))
 }
 
 func Info(args ...interface{}) {
-	text := fmt.Sprint(args...)
-	if isColorEnabled {
-		fmt.Println(styles.Primary.Render(text))
-	} else {
-		fmt.Println(text)
-	}
+	emit(render(false, styles.Primary, fmt.Sprint(args...)))
 }
 
 func Infof(format string, args ...interface{}) {
-	output := fmt.Sprintf(format, args...)
-	if isColorEnabled {
-		fmt.Println(styles.Primary.Render(output))
-	} else {
-		fmt.Println(output)
-	}
+	emit(render(false, styles.Primary, fmt.Sprintf(format, args...)))
 }
 
 func Warn(args ...interface{}) {
-	text := fmt.Sprint(args...)
-	warnText := warnPrefix + text
-	if isColorEnabled {
-		fmt.Fprintln(os.Stderr, styles.Warn.Render(warnText))
-	} else {
-		fmt.Fprint(os.Stderr, warnText)
-	}
+	emit(render(true, styles.Warn, warnPrefix+fmt.Sprint(args...)))
 }
 
 func Warnf(format string, args ...interface{}) {
-	output := fmt.Sprintf(format, args...)
-	formatted := warnPrefix + output
-	if isColorEnabled {
-		fmt.Fprintln(os.Stderr, styles.Warn.Render(formatted))
-	} else {
-		fmt.Fprintln(os.Stderr, formatted)
-	}
+	emit(render(true, styles.Warn, warnPrefix+fmt.Sprintf(format, args...)))
 }
 
 func Error(args ...interface{}) {
-	text := fmt.Sprint(args...)
-	errorText := errorPrefix + text
-	if isColorEnabled {
-		fmt.Fprintln(os.Stderr, styles.Error.Render(errorText))
-	} else {
-		fmt.Fprintln(os.Stderr, errorText)
-	}
+	emit(render(true, styles.Error, errorPrefix+fmt.Sprint(args...)))
 }
 
 func Errorf(format string, args ...interface{}) {
-	output := fmt.Sprintf(format, args...)
-	formatted := errorPrefix + output
-	if isColorEnabled {
-		fmt.Fprintln(os.Stderr, styles.Error.Render(formatted))
-	} else {
-		fmt.Fprintln(os.Stderr, formatted)
-	}
+	emit(render(true, styles.Error, errorPrefix+fmt.Sprintf(format, args...)))
 }
 
 func Fatal(args ...interface{}) {
@@ -135,3 +89,30 @@ func Fatalf(format string, args ...interface{}) {
 	Errorf(format, args...)
 	os.Exit(1)
 }
+
+func render(stderr bool, style lipgloss.Style, text string) line {
+	if isColorEnabled {
+		text = style.Render(text)
+	}
+	return line{stderr: stderr, text: text}
+}
+
+func headingLines(text string) []line {
+	if isColorEnabled {
+		return []line{{text: ""}, render(false, styles.Heading, text)}
+	}
+	return []line{render(false, styles.Heading, text)}
+}
+
+func emit(lines ...line) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	for _, l := range lines {
+		if l.stderr {
+			fmt.Fprintln(os.Stderr, l.text)
+		} else {
+			fmt.Println(l.text)
+		}
+	}
+}
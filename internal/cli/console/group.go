@@ -0,0 +1,105 @@
+package console
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/DQGriffin/labrador/internal/cli/styles"
+)
+
+// Printer is implemented by the package level console (Std) and by Group, so
+// code that may run concurrently can be handed somewhere to write its output
+type Printer interface {
+	Debug(args ...interface{})
+	Debugf(format string, args ...interface{})
+	Info(args ...interface{})
+	Infof(format string, args ...interface{})
+	Warn(args ...interface{})
+	Warnf(format string, args ...interface{})
+	Error(args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type stdPrinter struct{}
+
+// Std writes straight to the terminal
+var Std Printer = stdPrinter{}
+
+func (stdPrinter) Debug(args ...interface{})                 { Debug(args...) }
+func (stdPrinter) Debugf(format string, args ...interface{}) { Debugf(format, args...) }
+func (stdPrinter) Info(args ...interface{})                  { Info(args...) }
+func (stdPrinter) Infof(format string, args ...interface{})  { Infof(format, args...) }
+func (stdPrinter) Warn(args ...interface{})                  { Warn(args...) }
+func (stdPrinter) Warnf(format string, args ...interface{})  { Warnf(format, args...) }
+func (stdPrinter) Error(args ...interface{})                 { Error(args...) }
+func (stdPrinter) Errorf(format string, args ...interface{}) { Errorf(format, args...) }
+
+// Group buffers the output for one resource and prints it in one piece on Flush
+type Group struct {
+	title string
+	mu    sync.Mutex
+	lines []line
+}
+
+func NewGroup(title string) *Group {
+	return &Group{title: title}
+}
+
+func (g *Group) add(l line) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lines = append(g.lines, l)
+}
+
+func (g *Group) Debug(args ...interface{}) {
+	if isDebugOutputEnabled {
+		g.add(render(true, styles.Primary, debugPrefix+fmt.Sprint(args...)))
+	}
+}
+
+func (g *Group) Debugf(format string, args ...interface{}) {
+	if isDebugOutputEnabled {
+		g.add(render(true, styles.Primary, debugPrefix+fmt.Sprintf(format, args...)))
+	}
+}
+
+func (g *Group) Info(args ...interface{}) {
+	g.add(render(false, styles.Primary, fmt.Sprint(args...)))
+}
+
+func (g *Group) Infof(format string, args ...interface{}) {
+	g.add(render(false, styles.Primary, fmt.Sprintf(format, args...)))
+}
+
+func (g *Group) Warn(args ...interface{}) {
+	g.add(render(true, styles.Warn, warnPrefix+fmt.Sprint(args...)))
+}
+
+func (g *Group) Warnf(format string, args ...interface{}) {
+	g.add(render(true, styles.Warn, warnPrefix+fmt.Sprintf(format, args...)))
+}
+
+func (g *Group) Error(args ...interface{}) {
+	g.add(render(true, styles.Error, errorPrefix+fmt.Sprint(args...)))
+}
+
+func (g *Group) Errorf(format string, args ...interface{}) {
+	g.add(render(true, styles.Error, errorPrefix+fmt.Sprintf(format, args...)))
+}
+
+// Flush prints the title and everything buffered so far without interruption
+func (g *Group) Flush() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.lines) == 0 {
+		return
+	}
+
+	lines := g.lines
+	if g.title != "" {
+		lines = append([]line{render(false, styles.Secondary, g.title)}, lines...)
+	}
+	emit(lines...)
+	g.lines = nil
+}
@@ -8,20 +8,23 @@ import (
 	"github.com/DQGriffin/labrador/internal/cli/console"
 	"github.com/DQGriffin/labrador/internal/helpers"
 	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/DQGriffin/labrador/pkg/utils"
 )
 
 func HandleAddStage(projectPath, stageType, stageName, outputPath string) error {
 	console.Debug("HandleAddLambdaStage")
 	console.Debugf("Project: %s, Type: %s, Name: %s, Output: %s", projectPath, stageType, stageName, outputPath)
 
-	config, err := helpers.LoadProject(projectPath)
+	// Read the base file alone, the project is written back and overlays
+	// must not end up in it
+	project, err := utils.ReadProjectData(projectPath, "")
 
 	if err != nil {
 		console.Error("Could not load project configuration")
 		console.Fatal(err.Error())
 	}
 
-	stageErr := dispatchCommand(&config.Project, projectPath, stageName, stageType, outputPath)
+	stageErr := dispatchCommand(&project, projectPath, stageName, stageType, outputPath)
 	if stageErr != nil {
 		return stageErr
 	}
@@ -88,7 +91,7 @@ func handleAddLambdaStage(project *types.Project, projectPath, stageName, output
 	stage := types.Stage{
 		Name:         stageName,
 		Type:         "lambda",
-		Enabled:      true,
+		Enabled:      types.NewToggle(true),
 		OnConflict:   "stop",
 		OnError:      "stop",
 		ConfigFile:   outputPath,
@@ -154,7 +157,7 @@ func handleAddS3Stage(project *types.Project, projectPath, stageName, outputPath
 	stage := types.Stage{
 		Name:         stageName,
 		Type:         "s3",
-		Enabled:      true,
+		Enabled:      types.NewToggle(true),
 		OnConflict:   "stop",
 		OnError:      "stop",
 		ConfigFile:   outputPath,
@@ -250,7 +253,7 @@ func handleAddApiGatewayStage(project *types.Project, projectPath, stageName, ou
 	stage := types.Stage{
 		Name:         stageName,
 		Type:         "api",
-		Enabled:      true,
+		Enabled:      types.NewToggle(true),
 		OnConflict:   "stop",
 		OnError:      "stop",
 		ConfigFile:   outputPath,
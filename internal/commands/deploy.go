@@ -2,135 +2,513 @@ package commands
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/graph"
 	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/plan"
 	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
+	internalTypes "github.com/DQGriffin/labrador/internal/types"
+	"github.com/DQGriffin/labrador/internal/validation/constants"
 	"github.com/DQGriffin/labrador/pkg/types"
 	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
 )
 
-func HandleDeployCommand(config types.LabradorConfig, stageTypesMap *map[string]bool, existingLambdas map[string]lambdaTypes.FunctionConfiguration, existingBuckets map[string]bool, existingApiGateways *map[string]string, onlyCreate bool, onlyUpdate bool) {
-	for _, stage := range config.Project.Stages {
+type DeployOptions struct {
+	OnlyCreate bool
+	OnlyUpdate bool
+	// PruneRemoved deletes managed resources that were removed from their stage's config
+	PruneRemoved bool
+	// Parallelism is the most resource operations that run at once
+	Parallelism int
+	// Selection restricts the deploy to the resources in a saved plan. Nil deploys everything.
+	Selection map[string]plan.Action
+	// refs resolves integration targets that point at a Lambda by ref
+	refs map[string]string
+}
+
+func (opts *DeployOptions) isSelected(resourceType, name string) bool {
+	selected := opts.inSelection(resourceType, name)
+	if !selected {
+		console.Debugf("Skipping %s %s because it is not in the plan", resourceType, name)
+	}
+	return selected
+}
+
+func (opts *DeployOptions) inSelection(resourceType, name string) bool {
+	if opts.Selection == nil {
+		return true
+	}
+
+	_, selected := opts.Selection[plan.Key(resourceType, name)]
+	return selected
+}
+
+func HandleDeployCommand(config types.LabradorConfig, st *state.State, stageTypesMap *map[string]bool, existingLambdas map[string]lambdaTypes.FunctionConfiguration, existingBuckets map[string]bool, existingApiGateways *map[string]string, opts DeployOptions) error {
+	g, err := graph.NewStageGraph(config.Project.Stages)
+	if err != nil {
+		return err
+	}
+
+	levels, err := g.Levels()
+	if err != nil {
+		return err
+	}
+
+	opts.refs, err = aws.BuildRefMap(config.Project.Stages)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to start if a stage would stop on a conflict, so nothing is left half deployed
+	conflicts := findConflicts(levels, st, stageTypesMap, existingLambdas, existingBuckets, existingApiGateways, &opts)
+	if len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			console.Error(conflict)
+		}
+		return fmt.Errorf("%d resource(s) already exist but are not managed by Labrador. Set onConflict to update to take them over, or skip to leave them alone", len(conflicts))
+	}
 
-		if helpers.IsStageActionable(&stage, stageTypesMap) {
-			if stage.Hooks != nil {
-				helpers.RunHooks("preDeploy", stage.Hooks.WorkingDir, &stage.Hooks.PreDeploy, stage.Hooks.SuppressStdout, stage.Hooks.SuppressStderr, stage.Hooks.StopOnError)
+	r := newRunner(opts.Parallelism)
+
+	// Stages in a level don't depend on each other, so they can run side by side
+	for _, level := range levels {
+		if r.isStopped() {
+			console.Warn("Deploy stopped. Remaining stages were not deployed")
+			break
+		}
+
+		var wg sync.WaitGroup
+
+		for _, stage := range level {
+			if reason := helpers.StageExclusionReason(&stage, stageTypesMap, st.Environment); reason != "" {
+				console.Debugf("Skipping stage %s: %s", stage.Name, reason)
+				continue
 			}
-			if stage.Type == "lambda" {
-				deployLambdaStage(&stage, existingLambdas, onlyCreate, onlyUpdate)
-			} else if stage.Type == "s3" {
-				deployS3Stage(&stage, existingBuckets, onlyCreate, onlyUpdate)
-			} else if stage.Type == "api" {
-				deployApiGatewayStage(&stage, existingApiGateways, onlyCreate, onlyUpdate)
-			} else {
-				console.Warn("unknown stage type: ", stage.Type)
+
+			wg.Add(1)
+			go func(stage types.Stage) {
+				defer wg.Done()
+				deployStage(&stage, st, existingLambdas, existingBuckets, existingApiGateways, &opts, r)
+			}(stage)
+		}
+
+		wg.Wait()
+	}
+
+	return r.report()
+}
+
+func deployStage(stage *types.Stage, st *state.State, existingLambdas map[string]lambdaTypes.FunctionConfiguration, existingBuckets map[string]bool, existingApiGateways *map[string]string, opts *DeployOptions, r *runner) {
+	if stage.Hooks != nil {
+		if err := helpers.RunHooks("preDeploy", stage.Hooks.WorkingDir, &stage.Hooks.PreDeploy, stage.Hooks.SuppressStdout, stage.Hooks.SuppressStderr, stage.Hooks.StopOnError); err != nil {
+			hookFailed(stage, err, r)
+			return
+		}
+	}
+
+	console.Headingf("[Stage - %s - %s]", stage.Name, stage.Type)
+
+	var snapshots *stageSnapshots
+	if stage.OnError == constants.ON_ERROR_ROLLBACK {
+		snapshots = &stageSnapshots{}
+	}
+
+	// stop and rollback both end the deploy at the first failure. skip lets the other stages carry on.
+	stopOnFailure := stage.OnError != constants.ON_ERROR_SKIP
+
+	var tasks []resourceTask
+	if stage.Type == "lambda" {
+		tasks = lambdaTasks(stage, st, existingLambdas, opts, snapshots)
+	} else if stage.Type == "s3" {
+		tasks = bucketTasks(stage, st, existingBuckets, opts, snapshots)
+	} else if stage.Type == "api" {
+		tasks = apiGatewayTasks(stage, st, existingApiGateways, opts, snapshots)
+	} else {
+		console.Warn("unknown stage type: ", stage.Type)
+	}
+
+	if !r.runAll(tasks, stopOnFailure) {
+		handleStageFailure(stage, st, snapshots, r)
+		return
+	}
+
+	if !opts.OnlyCreate && !opts.OnlyUpdate {
+		if !r.runAll(orphanTasks(stage, st, opts), stopOnFailure) {
+			// Deleted resources can't be brought back, so there is nothing to roll back to
+			console.Errorf("Stage %s failed while deleting resources that were removed from its config", stage.Name)
+			return
+		}
+	}
+
+	if stage.Type == "lambda" {
+		pruneStageVersions(stage, opts)
+	}
+
+	if stage.Hooks != nil {
+		if err := helpers.RunHooks("postDeploy", stage.Hooks.WorkingDir, &stage.Hooks.PostDeploy, stage.Hooks.SuppressStdout, stage.Hooks.SuppressStderr, stage.Hooks.StopOnError); err != nil {
+			hookFailed(stage, err, r)
+		}
+	}
+}
+
+// hookFailed stops the deploy after a hook with stopOnError fails
+func hookFailed(stage *types.Stage, err error, r *runner) {
+	console.Errorf("Stage %s failed. Stopping the deploy", stage.Name)
+	r.fail(fmt.Errorf("stage %s: %w", stage.Name, err))
+	r.stop()
+}
+
+// findConflicts lists the unmanaged resources that already exist in stages whose onConflict is stop
+func findConflicts(levels [][]types.Stage, st *state.State, stageTypesMap *map[string]bool, existingLambdas map[string]lambdaTypes.FunctionConfiguration, existingBuckets map[string]bool, existingApiGateways *map[string]string, opts *DeployOptions) []string {
+	var conflicts []string
+
+	// A plan apply only touches the resources in the plan, so only those can conflict
+	conflict := func(stage *types.Stage, resourceType, name string, exists bool) {
+		if exists && !st.IsManaged(resourceType, name) && opts.inSelection(resourceType, name) {
+			conflicts = append(conflicts, fmt.Sprintf("stage %q: %s %s already exists but is not managed by Labrador", stage.Name, resourceType, name))
+		}
+	}
+
+	for _, level := range levels {
+		for _, stage := range level {
+			if !helpers.IsStageActionable(&stage, stageTypesMap, st.Environment) || stage.OnConflict != constants.ON_CONFLICT_STOP {
+				continue
+			}
+
+			for _, fnConfig := range stage.Functions {
+				for _, fn := range fnConfig.Functions {
+					_, exists := existingLambdas[fn.Name]
+					conflict(&stage, "lambda", fn.Name, exists)
+				}
+			}
+
+			for _, bucketConfig := range stage.Buckets {
+				for _, bucket := range bucketConfig.Buckets {
+					conflict(&stage, "s3", *bucket.Name, existingBuckets[*bucket.Name])
+				}
 			}
-			if stage.Hooks != nil {
-				helpers.RunHooks("postDeploy", stage.Hooks.WorkingDir, &stage.Hooks.PostDeploy, stage.Hooks.SuppressStdout, stage.Hooks.SuppressStderr, stage.Hooks.StopOnError)
+
+			for _, gatewayConfig := range stage.Gateways {
+				for _, gateway := range gatewayConfig.Gateways {
+					conflict(&stage, "api", *gateway.Name, (*existingApiGateways)[*gateway.Name] != "")
+				}
 			}
 		}
 	}
+
+	return conflicts
+}
+
+// takeOver decides what happens to an existing resource Labrador doesn't manage.
+// It returns true if the stage's onConflict says to adopt and update it.
+func takeOver(stage *types.Stage, resourceType, name string) bool {
+	if stage.OnConflict == constants.ON_CONFLICT_UPDATE {
+		console.Infof("%s %s already exists. Taking it over because onConflict is update", resourceType, name)
+		return true
+	}
+
+	console.Warnf("%s %s already exists but is not managed by Labrador. Skipping", resourceType, name)
+	return false
 }
 
-func deployLambdaStage(stage *types.Stage, existingLambdas map[string]lambdaTypes.FunctionConfiguration, onlyCreate bool, onlyUpdate bool) {
-	console.Headingf("[Stage - %s - %s]", stage.Name, stage.Type)
+// handleStageFailure applies the stage's onError setting once its tasks have finished
+func handleStageFailure(stage *types.Stage, st *state.State, snapshots *stageSnapshots, r *runner) {
+	switch stage.OnError {
+	case constants.ON_ERROR_SKIP:
+		console.Warnf("Stage %s failed. Moving on because onError is skip", stage.Name)
+	case constants.ON_ERROR_ROLLBACK:
+		console.Errorf("Stage %s failed. Rolling back", stage.Name)
+		rollbackStage(stage, st, snapshots, r)
+	default:
+		console.Errorf("Stage %s failed. Stopping the deploy", stage.Name)
+	}
+}
+
+func lambdaTasks(stage *types.Stage, st *state.State, existingLambdas map[string]lambdaTypes.FunctionConfiguration, opts *DeployOptions, snapshots *stageSnapshots) []resourceTask {
+	var tasks []resourceTask
 
 	for _, fnConfig := range stage.Functions {
 		for _, fn := range fnConfig.Functions {
-			if _, exists := existingLambdas[fn.Name]; exists {
-				if onlyCreate {
+			if !opts.isSelected("lambda", fn.Name) {
+				continue
+			}
+
+			if live, exists := existingLambdas[fn.Name]; exists {
+				if !st.IsManaged("lambda", fn.Name) && !takeOver(stage, "lambda", fn.Name) {
+					continue
+				}
+
+				if opts.OnlyCreate {
 					console.Debugf("Skipping updating lambda %s because --only-create is set", fn.Name)
 					continue
 				}
 
-				aws.UpdateLambda(fn)
+				tasks = append(tasks, resourceTask{
+					title: "lambda " + fn.Name,
+					run: func(out console.Printer) error {
+						if err := snapshots.lambdaUpdated(st, fn, out); err != nil {
+							return err
+						}
+
+						if err := resolveLayers(&fn); err != nil {
+							return err
+						}
+
+						configChanged := len(plan.DiffLambda(fn, live)) > 0
+						arn, err := aws.UpdateLambda(fn, live, configChanged, out)
+						if err != nil {
+							return err
+						}
+
+						if err := recordResource(st, stage, "lambda", fn.Name, arn, "", *fn.Region, fn); err != nil {
+							return err
+						}
+
+						if err := aws.SyncEventSources(fn, opts.refs, out); err != nil {
+							return err
+						}
+
+						return aws.SyncSchedules(fn, arn, out)
+					},
+				})
 			} else {
-				if onlyUpdate {
+				if opts.OnlyUpdate {
 					console.Debugf("Skipping creating lambda %s because --only-update is set", fn.Name)
 					continue
 				}
 
-				aws.CreateLambda(fn)
+				tasks = append(tasks, resourceTask{
+					title: "lambda " + fn.Name,
+					run: func(out console.Printer) error {
+						if err := resolveLayers(&fn); err != nil {
+							return err
+						}
+
+						// The function can exist even when a step after creating it failed
+						arn, err := aws.CreateLambda(fn, out)
+						if arn != "" {
+							snapshots.created("lambda", fn.Name, *fn.Region)
+							if recordErr := recordResource(st, stage, "lambda", fn.Name, arn, "", *fn.Region, fn); recordErr != nil {
+								return recordErr
+							}
+						}
+						if err != nil {
+							return err
+						}
+
+						if err := aws.SyncEventSources(fn, opts.refs, out); err != nil {
+							return err
+						}
+
+						return aws.SyncSchedules(fn, arn, out)
+					},
+				})
 			}
 		}
 	}
 
-	console.Info()
+	return tasks
 }
 
-func deployApiGatewayStage(stage *types.Stage, existingApiGateways *map[string]string, onlyCreate bool, onlyUpdate bool) {
-	console.Headingf("[Stage - %s - %s]", stage.Name, stage.Type)
+// resolveLayers swaps layer names for the version ARNs Lambda expects
+func resolveLayers(fn *types.LambdaConfig) error {
+	layers, err := aws.ResolveLayers(*fn.Region, fn.Layers)
+	if err != nil {
+		return err
+	}
+
+	fn.Layers = layers
+	return nil
+}
+
+func apiGatewayTasks(stage *types.Stage, st *state.State, existingApiGateways *map[string]string, opts *DeployOptions, snapshots *stageSnapshots) []resourceTask {
+	var tasks []resourceTask
 
 	for _, gatewayConfig := range stage.Gateways {
 		for _, gateway := range gatewayConfig.Gateways {
+			if !opts.isSelected("api", *gateway.Name) {
+				continue
+			}
 
 			apiId := (*existingApiGateways)[*gateway.Name]
 			if apiId == "" {
-				if onlyUpdate {
+				if opts.OnlyUpdate {
 					console.Debugf("Skipping creating api gateway %s because --only-update is set", *gateway.Name)
 					continue
 				}
 
-				err := aws.CreateApiGateway(&gateway)
-				if err != nil {
-					console.Error(err.Error())
-				}
+				tasks = append(tasks, resourceTask{
+					title: "api " + *gateway.Name,
+					run: func(out console.Printer) error {
+						newApiId, err := aws.CreateApiGateway(&gateway, opts.refs, out)
+						// The API can exist even when setting up its routes failed
+						if newApiId != "" {
+							snapshots.created("api", *gateway.Name, *gateway.Region)
+							if recordErr := recordResource(st, stage, "api", *gateway.Name, "", newApiId, *gateway.Region, gateway); recordErr != nil {
+								return recordErr
+							}
+						}
+						return err
+					},
+				})
 			} else {
-				if onlyCreate {
-					console.Debugf("Skipping updating api gateway %s because --only-create is set", *gateway.Name)
+				if !st.IsManaged("api", *gateway.Name) && !takeOver(stage, "api", *gateway.Name) {
 					continue
 				}
 
-				err := aws.UpdateApiGateway(&gateway, apiId)
-				if err != nil {
-					console.Error(err.Error())
+				if opts.OnlyCreate {
+					console.Debugf("Skipping updating api gateway %s because --only-create is set", *gateway.Name)
+					continue
 				}
+
+				tasks = append(tasks, resourceTask{
+					title: "api " + *gateway.Name,
+					run: func(out console.Printer) error {
+						if err := snapshots.apiGatewayUpdated(st, gateway, apiId); err != nil {
+							return err
+						}
+
+						err := aws.UpdateApiGateway(&gateway, apiId, opts.refs, out)
+						if err != nil {
+							return err
+						}
+
+						return recordResource(st, stage, "api", *gateway.Name, "", apiId, *gateway.Region, gateway)
+					},
+				})
 			}
 		}
 	}
 
-	console.Info()
+	return tasks
 }
 
-func deployS3Stage(stage *types.Stage, existingBuckets map[string]bool, onlyCreate bool, onlyUpdate bool) error {
-	console.Headingf("[Stage - %s - %s]", stage.Name, stage.Type)
+func bucketTasks(stage *types.Stage, st *state.State, existingBuckets map[string]bool, opts *DeployOptions, snapshots *stageSnapshots) []resourceTask {
+	var tasks []resourceTask
 
 	for _, bucketConfig := range stage.Buckets {
 		for _, bucket := range bucketConfig.Buckets {
-			ctx, cfg, err := aws.GetConfig(*bucket.Region)
-
-			if err != nil {
-				return err
+			if !opts.isSelected("s3", *bucket.Name) {
+				continue
 			}
 
-			client := aws.GetClient(cfg)
+			_, exists := existingBuckets[*bucket.Name]
+			if exists {
+				if !st.IsManaged("s3", *bucket.Name) && !takeOver(stage, "s3", *bucket.Name) {
+					continue
+				}
 
-			if _, exists := existingBuckets[*bucket.Name]; exists {
-				if onlyCreate {
+				if opts.OnlyCreate {
 					console.Debugf("Skipping updating bucket %s because --only-create is set", *bucket.Name)
 					continue
 				}
+			} else if opts.OnlyUpdate {
+				console.Debugf("Skipping creating bucket %s because --only-update is set", *bucket.Name)
+				continue
+			}
 
-				updateErr := aws.UpdateBucket(ctx, *client, bucket)
-				if updateErr != nil {
-					fmt.Println(updateErr.Error())
-				}
+			tasks = append(tasks, resourceTask{
+				title: "s3 " + *bucket.Name,
+				run: func(out console.Printer) error {
+					ctx, cfg, err := aws.GetConfig(*bucket.Region)
+					if err != nil {
+						return err
+					}
 
-			} else {
-				if onlyUpdate {
-					console.Debugf("Skipping creating bucket %s because --only-update is set", *bucket.Name)
-					continue
-				}
-				createErr := aws.CreateBucket(ctx, cfg, *client, bucket)
-				if createErr != nil {
-					fmt.Println(createErr.Error())
-				}
+					client := aws.GetClient(cfg)
 
-			}
+					if exists {
+						if err := snapshots.bucketUpdated(st, bucket); err != nil {
+							return err
+						}
+						err = aws.UpdateBucket(ctx, *client, bucket, out)
+					} else {
+						err = aws.CreateBucket(ctx, cfg, *client, bucket, out)
+						if err == nil {
+							snapshots.created("s3", *bucket.Name, *bucket.Region)
+						}
+					}
+					if err != nil {
+						return err
+					}
+
+					if err := recordResource(st, stage, "s3", *bucket.Name, fmt.Sprintf("arn:aws:s3:::%s", *bucket.Name), "", *bucket.Region, bucket); err != nil {
+						return err
+					}
+
+					return aws.SyncBucketNotifications(ctx, cfg, client, bucket, opts.refs, out)
+				},
+			})
+		}
+	}
+
+	return tasks
+}
+
+// orphanTasks deletes managed resources that were removed from the stage's
+// config, when --prune-removed is set. The rest are left in place with a warning.
+func orphanTasks(stage *types.Stage, st *state.State, opts *DeployOptions) []resourceTask {
+	var tasks []resourceTask
+
+	for _, resource := range helpers.OrphanedResources(stage, st) {
+		if reason := helpers.RemovedResourceRetention(stage, resource, opts.PruneRemoved); reason != "" {
+			console.Warnf("%s %s was removed from the config of stage %s but is left in place: %s", resource.Type, resource.Name, stage.Name, reason)
+			continue
+		}
+
+		if !opts.isSelected(resource.Type, resource.Name) {
+			continue
+		}
+
+		orphan := internalTypes.UniversalResourceDefinition{
+			Name:         resource.Name,
+			StageName:    resource.Stage,
+			Arn:          resource.Arn,
+			Id:           resource.Id,
+			ResourceType: resource.Type,
+			Region:       resource.Region,
 		}
+
+		tasks = append(tasks, resourceTask{
+			title: resource.Type + " " + resource.Name,
+			run: func(out console.Printer) error {
+				out.Infof("%s %s is no longer in the config", resource.Type, resource.Name)
+				return destroyResource(orphan, st, false, out)
+			},
+		})
+	}
+
+	return tasks
+}
+
+func recordResource(st *state.State, stage *types.Stage, resourceType, name, arn, id, region string, config any) error {
+	// Kept so that a resource removed from the config later still honors onDelete
+	var onDelete *string
+	switch resource := config.(type) {
+	case types.LambdaConfig:
+		onDelete = resource.OnDelete
+	case types.S3Settings:
+		onDelete = resource.OnDelete
+	case types.ApiGatewaySettings:
+		onDelete = resource.OnDelete
 	}
 
-	console.Info()
+	err := st.Record(state.ResourceState{
+		Type:       resourceType,
+		Name:       name,
+		Stage:      stage.Name,
+		Arn:        arn,
+		Id:         id,
+		Region:     region,
+		ConfigHash: state.HashConfig(config),
+		OnDelete:   helpers.PtrOrDefault(onDelete, ""),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to record %s %s in state: %w", resourceType, name, err)
+	}
 	return nil
 }
@@ -2,33 +2,46 @@ package commands
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/graph"
 	"github.com/DQGriffin/labrador/internal/helpers"
 	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
 	internalTypes "github.com/DQGriffin/labrador/internal/types"
 	"github.com/DQGriffin/labrador/pkg/types"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 )
 
-func HandleDestroyCommand(projectConfig types.LabradorConfig, isDryRun bool, force bool, stageTypesMap *map[string]bool, env string) error {
-	for _, stage := range projectConfig.Project.Stages {
+func HandleDestroyCommand(projectConfig types.LabradorConfig, st *state.State, isDryRun bool, force bool, stageTypesMap *map[string]bool, env string) error {
+	// Dependents go first so nothing is left pointing at a deleted resource
+	stages, err := graph.ReverseOrderStages(projectConfig.Project.Stages)
+	if err != nil {
+		return err
+	}
+
+	for _, stage := range stages {
 		if isStageMarkedForDeletion(&stage, stageTypesMap, env) {
 			if stage.Hooks != nil {
-				helpers.RunHooks("preDestroy", stage.Hooks.WorkingDir, &stage.Hooks.PreDestroy, stage.Hooks.SuppressStdout, stage.Hooks.SuppressStderr, stage.Hooks.StopOnError)
+				if err := helpers.RunHooks("preDestroy", stage.Hooks.WorkingDir, &stage.Hooks.PreDestroy, stage.Hooks.SuppressStdout, stage.Hooks.SuppressStderr, stage.Hooks.StopOnError); err != nil {
+					return err
+				}
 			}
 
 			if stage.Type == "lambda" {
-				handleLambdaStage(&stage, isDryRun, force)
+				handleLambdaStage(&stage, st, isDryRun, force)
 			} else if stage.Type == "s3" {
-				handleS3Stage(&stage, isDryRun, force)
+				handleS3Stage(&stage, st, isDryRun, force)
 			} else if stage.Type == "api" {
-				handleApiGatewayStage(&stage, isDryRun, force)
+				handleApiGatewayStage(&stage, st, isDryRun, force)
 			}
 
 			if stage.Hooks != nil {
-				helpers.RunHooks("postDestroy", stage.Hooks.WorkingDir, &stage.Hooks.PostDestroy, stage.Hooks.SuppressStdout, stage.Hooks.SuppressStderr, stage.Hooks.StopOnError)
+				if err := helpers.RunHooks("postDestroy", stage.Hooks.WorkingDir, &stage.Hooks.PostDestroy, stage.Hooks.SuppressStdout, stage.Hooks.SuppressStderr, stage.Hooks.StopOnError); err != nil {
+					return err
+				}
 			}
 		} else {
 			console.Debug("Skipping stage: ", stage.Name)
@@ -39,36 +52,36 @@ func HandleDestroyCommand(projectConfig types.LabradorConfig, isDryRun bool, for
 	return nil
 }
 
-func handleLambdaStage(stage *types.Stage, isDryRun bool, force bool) {
+func handleLambdaStage(stage *types.Stage, st *state.State, isDryRun bool, force bool) {
 	console.Headingf("[Stage - %s - %s]", stage.Name, stage.Type)
-	deletableLambdas, skippedLambdas := getDeletableLambdas(&stage.Functions, stage.Name)
+	deletableLambdas, skippedLambdas := getDeletableLambdas(&stage.Functions, stage.Name, st)
 
 	if isDryRun {
 		handleDryRun(&deletableLambdas, &skippedLambdas)
 	} else {
-		destroyResources(&deletableLambdas, force)
+		destroyResources(&deletableLambdas, st, force)
 	}
 }
 
-func handleS3Stage(stage *types.Stage, isDryRun bool, force bool) {
+func handleS3Stage(stage *types.Stage, st *state.State, isDryRun bool, force bool) {
 	console.Headingf("[Stage - %s - %s]", stage.Name, stage.Type)
-	deletableBuckets, skippedBuckets := getDeletableBuckets(&stage.Buckets, stage.Name)
+	deletableBuckets, skippedBuckets := getDeletableBuckets(&stage.Buckets, stage.Name, st)
 
 	if isDryRun {
 		handleDryRun(&deletableBuckets, &skippedBuckets)
 	} else {
-		destroyResources(&deletableBuckets, force)
+		destroyResources(&deletableBuckets, st, force)
 	}
 }
 
-func handleApiGatewayStage(stage *types.Stage, isDryRun bool, force bool) {
+func handleApiGatewayStage(stage *types.Stage, st *state.State, isDryRun bool, force bool) {
 	console.Headingf("[Stage - %s - %s]", stage.Name, stage.Type)
-	deletableGateways, skippedGateways := getDeletableApiGateways(&stage.Gateways, stage.Name)
+	deletableGateways, skippedGateways := getDeletableApiGateways(&stage.Gateways, stage.Name, st)
 
 	if isDryRun {
 		handleDryRun(&deletableGateways, &skippedGateways)
 	} else {
-		destroyResources(&deletableGateways, force)
+		destroyResources(&deletableGateways, st, force)
 	}
 }
 
@@ -79,38 +92,42 @@ func handleDryRun(forDeletion *[]internalTypes.UniversalResourceDefinition, skip
 	}
 	console.Info("Would skip:")
 	for _, resource := range *skipped {
-		console.Infof("- %s", resource.Name)
+		if resource.SkipReason != "" {
+			console.Infof("- %s (%s)", resource.Name, resource.SkipReason)
+		} else {
+			console.Infof("- %s", resource.Name)
+		}
 	}
 	console.Info()
 }
 
 func isStageMarkedForDeletion(stage *types.Stage, stageTypesMap *map[string]bool, env string) bool {
-	if len(*stageTypesMap) == 0 {
-		return true
-	}
-
-	return (*stageTypesMap)[stage.Type]
+	return helpers.IsStageActionable(stage, stageTypesMap, env)
 }
 
-func getDeletableLambdas(config *[]types.LambdaData, stageName string) ([]internalTypes.UniversalResourceDefinition, []internalTypes.UniversalResourceDefinition) {
+func getDeletableLambdas(config *[]types.LambdaData, stageName string, st *state.State) ([]internalTypes.UniversalResourceDefinition, []internalTypes.UniversalResourceDefinition) {
 	var deletableLambdas []internalTypes.UniversalResourceDefinition
 	var skippedLambdas []internalTypes.UniversalResourceDefinition
 	for _, stageFuncs := range *config {
 		for _, fn := range stageFuncs.Functions {
-			if (fn.OnDelete == nil) || (fn.OnDelete != nil && *fn.OnDelete != "skip") {
-				deletableLambdas = append(deletableLambdas, internalTypes.UniversalResourceDefinition{
-					Name:         fn.Name,
-					StageName:    stageName,
-					Arn:          "",
-					ResourceType: "lambda",
-				})
+			resource := internalTypes.UniversalResourceDefinition{
+				Name:         fn.Name,
+				StageName:    stageName,
+				Arn:          "",
+				ResourceType: "lambda",
+				Region:       helpers.PtrOrDefault(fn.Region, ""),
+			}
+
+			if fn.OnDelete != nil && *fn.OnDelete == "skip" {
+				resource.SkipReason = "onDelete is skip"
+				skippedLambdas = append(skippedLambdas, resource)
+			} else if managed, exists := st.Get("lambda", fn.Name); !exists {
+				resource.SkipReason = "not managed by Labrador"
+				skippedLambdas = append(skippedLambdas, resource)
 			} else {
-				skippedLambdas = append(skippedLambdas, internalTypes.UniversalResourceDefinition{
-					Name:         fn.Name,
-					StageName:    stageName,
-					Arn:          "",
-					ResourceType: "lambda",
-				})
+				resource.Arn = managed.Arn
+				resource.Region = managed.Region
+				deletableLambdas = append(deletableLambdas, resource)
 			}
 		}
 	}
@@ -118,28 +135,30 @@ func getDeletableLambdas(config *[]types.LambdaData, stageName string) ([]intern
 	return deletableLambdas, skippedLambdas
 }
 
-func getDeletableBuckets(config *[]types.S3Config, stageName string) ([]internalTypes.UniversalResourceDefinition, []internalTypes.UniversalResourceDefinition) {
+func getDeletableBuckets(config *[]types.S3Config, stageName string, st *state.State) ([]internalTypes.UniversalResourceDefinition, []internalTypes.UniversalResourceDefinition) {
 	var deletableBuckets []internalTypes.UniversalResourceDefinition
 	var skippedBuckets []internalTypes.UniversalResourceDefinition
 
 	for _, stageBuckets := range *config {
 		for _, bucket := range stageBuckets.Buckets {
-			if (bucket.OnDelete == nil) || (bucket.OnDelete != nil && *bucket.OnDelete != "skip") {
-				deletableBuckets = append(deletableBuckets, internalTypes.UniversalResourceDefinition{
-					Name:         *bucket.Name,
-					StageName:    stageName,
-					Arn:          "",
-					ResourceType: "s3",
-					Region:       *bucket.Region,
-				})
+			resource := internalTypes.UniversalResourceDefinition{
+				Name:         *bucket.Name,
+				StageName:    stageName,
+				Arn:          "",
+				ResourceType: "s3",
+				Region:       *bucket.Region,
+			}
+
+			if bucket.OnDelete != nil && *bucket.OnDelete == "skip" {
+				resource.SkipReason = "onDelete is skip"
+				skippedBuckets = append(skippedBuckets, resource)
+			} else if managed, exists := st.Get("s3", *bucket.Name); !exists {
+				resource.SkipReason = "not managed by Labrador"
+				skippedBuckets = append(skippedBuckets, resource)
 			} else {
-				skippedBuckets = append(skippedBuckets, internalTypes.UniversalResourceDefinition{
-					Name:         *bucket.Name,
-					StageName:    stageName,
-					Arn:          "",
-					ResourceType: "s3",
-					Region:       *bucket.Region,
-				})
+				resource.Arn = managed.Arn
+				resource.Region = managed.Region
+				deletableBuckets = append(deletableBuckets, resource)
 			}
 		}
 	}
@@ -147,28 +166,30 @@ func getDeletableBuckets(config *[]types.S3Config, stageName string) ([]internal
 	return deletableBuckets, skippedBuckets
 }
 
-func getDeletableApiGateways(config *[]types.ApiGatewayConfig, stageName string) ([]internalTypes.UniversalResourceDefinition, []internalTypes.UniversalResourceDefinition) {
+func getDeletableApiGateways(config *[]types.ApiGatewayConfig, stageName string, st *state.State) ([]internalTypes.UniversalResourceDefinition, []internalTypes.UniversalResourceDefinition) {
 	var deletableGateways []internalTypes.UniversalResourceDefinition
 	var skippedGateways []internalTypes.UniversalResourceDefinition
 
 	for _, stageGateways := range *config {
 		for _, gateway := range stageGateways.Gateways {
-			if (gateway.OnDelete == nil) || (gateway.OnDelete != nil && *gateway.OnDelete != "skip") {
-				deletableGateways = append(deletableGateways, internalTypes.UniversalResourceDefinition{
-					Name:         *gateway.Name,
-					StageName:    stageName,
-					Arn:          "",
-					ResourceType: "api",
-					Region:       *gateway.Region,
-				})
+			resource := internalTypes.UniversalResourceDefinition{
+				Name:         *gateway.Name,
+				StageName:    stageName,
+				Arn:          "",
+				ResourceType: "api",
+				Region:       *gateway.Region,
+			}
+
+			if gateway.OnDelete != nil && *gateway.OnDelete == "skip" {
+				resource.SkipReason = "onDelete is skip"
+				skippedGateways = append(skippedGateways, resource)
+			} else if managed, exists := st.Get("api", *gateway.Name); !exists {
+				resource.SkipReason = "not managed by Labrador"
+				skippedGateways = append(skippedGateways, resource)
 			} else {
-				skippedGateways = append(skippedGateways, internalTypes.UniversalResourceDefinition{
-					Name:         *gateway.Name,
-					StageName:    stageName,
-					Arn:          "",
-					ResourceType: "api",
-					Region:       *gateway.Region,
-				})
+				resource.Id = managed.Id
+				resource.Region = managed.Region
+				deletableGateways = append(deletableGateways, resource)
 			}
 		}
 	}
@@ -176,24 +197,36 @@ func getDeletableApiGateways(config *[]types.ApiGatewayConfig, stageName string)
 	return deletableGateways, skippedGateways
 }
 
-func destroyResources(resources *[]internalTypes.UniversalResourceDefinition, force bool) {
+func destroyResources(resources *[]internalTypes.UniversalResourceDefinition, st *state.State, force bool) {
 	for _, resource := range *resources {
-		if resource.ResourceType == "lambda" {
-			aws.DeleteLambda(resource.Name)
-		} else if resource.ResourceType == "s3" {
-			err := aws.DeleteBucket(resource.Name, resource.Region, force)
-			if err != nil {
-				console.Error(err.Error())
-			}
-		} else if resource.ResourceType == "api" {
-
-			ctx := context.TODO()
-			cfg, _ := config.LoadDefaultConfig(ctx, config.WithRegion(resource.Region))
-			client := apigatewayv2.NewFromConfig(cfg)
-			err := aws.DestroyApiGateway(ctx, *client, resource.Name)
-			if err != nil {
-				console.Error(err.Error())
-			}
+		if err := destroyResource(resource, st, force, console.Std); err != nil {
+			console.Error(err.Error())
 		}
 	}
 }
+
+// destroyResource deletes a resource and drops it from the state
+func destroyResource(resource internalTypes.UniversalResourceDefinition, st *state.State, force bool, out console.Printer) error {
+	var err error
+	if resource.ResourceType == "lambda" {
+		err = aws.DeleteLambda(resource.Name, resource.Region, out)
+	} else if resource.ResourceType == "s3" {
+		err = aws.DeleteBucket(resource.Name, resource.Region, force, out)
+	} else if resource.ResourceType == "api" {
+
+		ctx := context.TODO()
+		cfg, _ := config.LoadDefaultConfig(ctx, config.WithRegion(resource.Region))
+		client := apigatewayv2.NewFromConfig(cfg)
+		err = aws.DestroyApiGateway(ctx, *client, resource.Id, resource.Name, out)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	stateErr := st.Remove(resource.ResourceType, resource.Name)
+	if stateErr != nil {
+		return fmt.Errorf("failed to remove %s %s from state: %w", resource.ResourceType, resource.Name, stateErr)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/DQGriffin/labrador/internal/plan"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/types"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// HandleDriftCommand compares the live settings of every managed resource with
+// the config. It returns an error if any resource has drifted or couldn't be checked.
+func HandleDriftCommand(config types.LabradorConfig, st *state.State, stageTypesMap *map[string]bool, format string, existingLambdas map[string]lambdaTypes.FunctionConfiguration, existingBuckets map[string]bool, existingApiGateways map[string]string) error {
+	p, err := plan.Build(config, st, stageTypesMap, existingLambdas, existingBuckets, existingApiGateways, false)
+	if err != nil {
+		return err
+	}
+
+	report := plan.DetectDrift(p, st)
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode drift report: %w", err)
+		}
+		fmt.Println(string(data))
+	default:
+		plan.PrintDrift(report)
+	}
+
+	if report.HasDrift() {
+		return fmt.Errorf("drift found in %d resource(s)", report.Count(plan.DriftChanged)+report.Count(plan.DriftMissing))
+	}
+
+	if failed := report.Count(plan.DriftError); failed > 0 {
+		return fmt.Errorf("%d resource(s) could not be checked for drift", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,397 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// ImportOptions describes the resource to import and the stage it goes into
+type ImportOptions struct {
+	Type    string
+	Name    string
+	Stage   string
+	Region  string
+	CodeDir string
+}
+
+// HandleImportCommand reads a resource that already exists in AWS, adds a
+// matching entry to the stage's config file and records it as managed, so the
+// next deploy updates it instead of treating it as a conflict
+func HandleImportCommand(config types.LabradorConfig, st *state.State, opts ImportOptions) error {
+	index := slices.IndexFunc(config.Project.Stages, func(stage types.Stage) bool {
+		return stage.Name == opts.Stage
+	})
+	if index < 0 {
+		return fmt.Errorf("stage %q does not exist", opts.Stage)
+	}
+	stage := &config.Project.Stages[index]
+
+	if stage.Type != opts.Type {
+		return fmt.Errorf("stage %s holds %s resources, not %s", stage.Name, stage.Type, opts.Type)
+	}
+
+	if helpers.StageResourceNames(stage)[opts.Name] {
+		return fmt.Errorf("%s %s is already in the config for stage %s", opts.Type, opts.Name, stage.Name)
+	}
+
+	if st.IsManaged(opts.Type, opts.Name) {
+		return fmt.Errorf("%s %s is already managed by Labrador", opts.Type, opts.Name)
+	}
+
+	switch opts.Type {
+	case "lambda":
+		return importLambda(stage, st, opts)
+	case "s3":
+		return importBucket(stage, st, opts)
+	case "api":
+		return importApiGateway(stage, st, opts)
+	default:
+		return fmt.Errorf("cannot import resources of unknown type: %s", opts.Type)
+	}
+}
+
+func importLambda(stage *types.Stage, st *state.State, opts ImportOptions) error {
+	console.Infof("Reading lambda %s", opts.Name)
+	snapshot, err := aws.GetLambdaSnapshot(opts.Name, opts.Region)
+	if err != nil {
+		return err
+	}
+
+	fn, err := lambdaFromSnapshot(opts.Name, opts.Region, opts.CodeDir, snapshot)
+	if err != nil {
+		return err
+	}
+
+	err = updateConfigFile(stage.ConfigFile, func(data *types.LambdaData) {
+		data.Functions = append(data.Functions, fn)
+	})
+	if err != nil {
+		return err
+	}
+
+	return finishImport(st, stage, "lambda", opts.Name, helpers.PtrOrDefault(snapshot.Configuration.FunctionArn, ""), "", opts.Region, fn)
+}
+
+// lambdaFromSnapshot builds the config for an existing function. The code of a
+// zip function is saved to codeDir, while an image function keeps its image URI.
+func lambdaFromSnapshot(name, region, codeDir string, snapshot aws.LambdaSnapshot) (types.LambdaConfig, error) {
+	live := snapshot.Configuration
+	fn := types.LambdaConfig{
+		Name:         name,
+		Region:       helpers.AsPtr(region),
+		RoleArn:      live.Role,
+		Architecture: helpers.AsPtr(aws.LiveArchitecture(live)),
+		Tags:         snapshot.Tags,
+	}
+
+	if snapshot.ImageUri != "" {
+		fn.PackageType = helpers.AsPtr("Image")
+		fn.ImageUri = helpers.AsPtr(snapshot.ImageUri)
+
+		if live.ImageConfigResponse != nil && live.ImageConfigResponse.ImageConfig != nil {
+			image := live.ImageConfigResponse.ImageConfig
+			fn.ImageConfig = &types.LambdaImageConfig{
+				Command:          image.Command,
+				EntryPoint:       image.EntryPoint,
+				WorkingDirectory: image.WorkingDirectory,
+			}
+		}
+	} else {
+		if err := os.MkdirAll(codeDir, 0755); err != nil {
+			return types.LambdaConfig{}, fmt.Errorf("failed to create %s: %w", codeDir, err)
+		}
+
+		codePath := filepath.Join(codeDir, name+".zip")
+		if err := os.WriteFile(codePath, snapshot.ZipFile, 0644); err != nil {
+			return types.LambdaConfig{}, fmt.Errorf("failed to write code for lambda %s: %w", name, err)
+		}
+		console.Infof("Code for lambda %s saved to %s", name, codePath)
+
+		fn.Handler = live.Handler
+		fn.Runtime = helpers.AsPtr(string(live.Runtime))
+		fn.Code = helpers.AsPtr(codePath)
+	}
+
+	applyLiveSettings(&fn, live)
+
+	if live.MemorySize != nil {
+		fn.MemorySize = helpers.AsPtr(uint16(*live.MemorySize))
+	}
+
+	if live.Timeout != nil {
+		fn.Timeout = helpers.AsPtr(uint16(*live.Timeout))
+	}
+
+	if helpers.PtrOrDefault(live.Description, "") != "" {
+		fn.Description = live.Description
+	}
+
+	if live.Environment != nil {
+		fn.Environment = live.Environment.Variables
+	}
+
+	return fn, nil
+}
+
+// applyLiveSettings copies the optional settings a function uses into its
+// config, so the first deploy doesn't reset them to Lambda's defaults
+func applyLiveSettings(fn *types.LambdaConfig, live lambdaTypes.FunctionConfiguration) {
+	for _, layer := range live.Layers {
+		fn.Layers = append(fn.Layers, helpers.PtrOrDefault(layer.Arn, ""))
+	}
+
+	if live.EphemeralStorage != nil && helpers.PtrOrDefault(live.EphemeralStorage.Size, aws.DefaultEphemeralStorage) != aws.DefaultEphemeralStorage {
+		fn.EphemeralStorage = helpers.AsPtr(uint16(*live.EphemeralStorage.Size))
+	}
+
+	if live.VpcConfig != nil && len(live.VpcConfig.SubnetIds) > 0 {
+		fn.VpcConfig = &types.LambdaVpcConfig{
+			SubnetIds:        live.VpcConfig.SubnetIds,
+			SecurityGroupIds: live.VpcConfig.SecurityGroupIds,
+		}
+	}
+
+	if live.TracingConfig != nil && string(live.TracingConfig.Mode) != aws.DefaultTracingMode && live.TracingConfig.Mode != "" {
+		fn.TracingConfig = &types.LambdaTracingConfig{Mode: string(live.TracingConfig.Mode)}
+	}
+
+	if live.DeadLetterConfig != nil && helpers.PtrOrDefault(live.DeadLetterConfig.TargetArn, "") != "" {
+		fn.DeadLetterConfig = &types.LambdaDeadLetterConfig{TargetArn: *live.DeadLetterConfig.TargetArn}
+	}
+
+	fn.KmsKeyArn = live.KMSKeyArn
+}
+
+func importBucket(stage *types.Stage, st *state.State, opts ImportOptions) error {
+	console.Infof("Reading bucket %s", opts.Name)
+	ctx, cfg, err := aws.GetConfig(opts.Region)
+	if err != nil {
+		return err
+	}
+
+	bucket, err := aws.GetBucketSettings(ctx, *aws.GetClient(cfg), opts.Name, opts.Region)
+	if err != nil {
+		return err
+	}
+
+	if len(bucket.Tags) == 0 {
+		bucket.Tags = nil
+	}
+
+	err = updateConfigFile(stage.ConfigFile, func(data *types.S3Config) {
+		data.Buckets = append(data.Buckets, bucket)
+	})
+	if err != nil {
+		return err
+	}
+
+	return finishImport(st, stage, "s3", opts.Name, fmt.Sprintf("arn:aws:s3:::%s", opts.Name), "", opts.Region, bucket)
+}
+
+func importApiGateway(stage *types.Stage, st *state.State, opts ImportOptions) error {
+	console.Infof("Reading API gateway %s", opts.Name)
+	ctx, cfg, err := aws.GetConfig(opts.Region)
+	if err != nil {
+		return err
+	}
+
+	apiId, err := aws.GetApiIDByName(ctx, apigatewayv2.NewFromConfig(cfg), opts.Name)
+	if err != nil {
+		return err
+	}
+
+	live, err := aws.GetApiGateway(opts.Region, apiId)
+	if err != nil {
+		return err
+	}
+
+	gateway := apiGatewayFromLive(opts.Name, opts.Region, live, nil)
+
+	err = updateConfigFile(stage.ConfigFile, func(data *types.ApiGatewayConfig) {
+		data.Gateways = append(data.Gateways, gateway)
+	})
+	if err != nil {
+		return err
+	}
+
+	return finishImport(st, stage, "api", opts.Name, "", apiId, opts.Region, gateway)
+}
+
+// apiGatewayFromLive builds the config for an existing API. Integrations target
+// their Lambda by ref if it is in functionRefs (function name -> ref), otherwise
+// by name. Routes point at their integration's ref.
+func apiGatewayFromLive(name, region string, live aws.LiveApiGateway, functionRefs map[string]string) types.ApiGatewaySettings {
+	gateway := types.ApiGatewaySettings{
+		Name:     helpers.AsPtr(name),
+		Region:   helpers.AsPtr(region),
+		Protocol: helpers.AsPtr("http"),
+		Tags:     live.Tags,
+	}
+
+	if live.Description != "" {
+		gateway.Description = helpers.AsPtr(live.Description)
+	}
+
+	stages := []types.ApiGatewayStage{}
+	for _, stageName := range sortedNames(live.Stages) {
+		stage := live.Stages[stageName]
+		stages = append(stages, types.ApiGatewayStage{
+			Name:        stageName,
+			Description: helpers.PtrOrDefault(stage.Description, ""),
+			AutoDeploy:  helpers.PtrOrDefault(stage.AutoDeploy, false),
+			Tags:        stage.Tags,
+		})
+	}
+	gateway.Stages = &stages
+
+	// Integration ID -> ref
+	refs := make(map[string]string)
+	for _, id := range sortedNames(live.Integrations) {
+		integration := live.Integrations[id]
+		uri := helpers.PtrOrDefault(integration.IntegrationUri, "")
+
+		target, ok := lambdaTarget(uri, region)
+		if !ok {
+			console.Warnf("Skipping integration %s: only Lambda integrations can be managed by Labrador (%s)", id, uri)
+			continue
+		}
+
+		functionName := target.External.Dynamic.Name
+		ref := uniqueRef(functionName, refs)
+		refs[id] = ref
+
+		if functionRef, exists := functionRefs[functionName]; exists {
+			target = types.ResourceTarget{Ref: helpers.AsPtr(functionRef)}
+		}
+
+		gateway.Integrations = append(gateway.Integrations, types.ApiGatewayIntegration{
+			Type:              "proxy",
+			PayloadVersion:    helpers.PtrOrDefault(integration.PayloadFormatVersion, "2.0"),
+			IntegrationMethod: helpers.PtrOrDefault(integration.IntegrationMethod, "POST"),
+			Ref:               ref,
+			Target:            target,
+		})
+	}
+
+	for _, routeKey := range sortedNames(live.Routes) {
+		route := live.Routes[routeKey]
+		method, path, found := strings.Cut(routeKey, " ")
+		integrationId := strings.TrimPrefix(helpers.PtrOrDefault(route.Target, ""), "integrations/")
+
+		ref, exists := refs[integrationId]
+		if !found || !exists {
+			console.Warnf("Skipping route %s: it isn't a method and path pointing at a Lambda integration", routeKey)
+			continue
+		}
+
+		gateway.Routes = append(gateway.Routes, types.ApiGatewayRoute{
+			Method: method,
+			Route:  path,
+			Target: types.ResourceTarget{Ref: helpers.AsPtr(ref)},
+		})
+	}
+
+	return gateway
+}
+
+// lambdaTarget turns a Lambda integration URI into a dynamic target. The URI is
+// either the function ARN or arn:aws:apigateway:<region>:lambda:path/2015-03-31/functions/<function ARN>/invocations.
+func lambdaTarget(uri, region string) (types.ResourceTarget, bool) {
+	start := strings.Index(uri, "arn:aws:lambda:")
+	if start < 0 {
+		return types.ResourceTarget{}, false
+	}
+
+	// arn:aws:lambda:<region>:<account>:function:<name>[:<qualifier>]
+	parts := strings.Split(strings.SplitN(uri[start:], "/", 2)[0], ":")
+	if len(parts) < 7 || parts[5] != "function" {
+		return types.ResourceTarget{}, false
+	}
+
+	if parts[3] != "" {
+		region = parts[3]
+	}
+
+	return types.ResourceTarget{
+		External: &types.ExternalReference{
+			Dynamic: &types.DynamicResourceRefData{
+				Name:   parts[6],
+				Region: region,
+				Type:   "lambda",
+			},
+		},
+	}, true
+}
+
+func uniqueRef(base string, refs map[string]string) string {
+	taken := make(map[string]bool)
+	for _, ref := range refs {
+		taken[ref] = true
+	}
+
+	ref := base + "-int"
+	for i := 2; taken[ref]; i++ {
+		ref = fmt.Sprintf("%s-int-%d", base, i)
+	}
+	return ref
+}
+
+func sortedNames[T any](m map[string]T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// updateConfigFile reads a stage's config file, applies update to it and writes
+// it back in the same format add stage uses
+func updateConfigFile[T any](path string, update func(*T)) error {
+	var config T
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read stage config %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to decode stage config %s: %w", path, err)
+	}
+
+	update(&config)
+
+	data, err = json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode stage config %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write stage config %s: %w", path, err)
+	}
+
+	console.Infof("Updated %s", path)
+	return nil
+}
+
+func finishImport(st *state.State, stage *types.Stage, resourceType, name, arn, id, region string, config any) error {
+	if err := recordResource(st, stage, resourceType, name, arn, id, region, config); err != nil {
+		return err
+	}
+
+	console.Infof("Imported %s %s into stage %s. It is now managed by Labrador", resourceType, name, stage.Name)
+	return nil
+}
@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/validation/constants"
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+// InitOptions describes the project to generate from an existing account
+type InitOptions struct {
+	Name        string
+	Environment string
+	Region      string
+	Output      string
+	FilterTags  map[string]string
+}
+
+// HandleInitFromAccount discovers the Lambdas, buckets, and HTTP APIs in a region
+// and writes a project with one stage per resource type. The stages take over
+// the resources on their first deploy.
+func HandleInitFromAccount(opts InitOptions) error {
+	dir := filepath.Dir(opts.Output)
+	stagesDir := filepath.Join(dir, "stages")
+	codeDir := filepath.Join(dir, "code")
+
+	files := map[string]string{
+		"lambda": filepath.Join(stagesDir, "lambdas.json"),
+		"s3":     filepath.Join(stagesDir, "buckets.json"),
+		"api":    filepath.Join(stagesDir, "apis.json"),
+	}
+
+	for _, path := range []string{opts.Output, files["lambda"], files["s3"], files["api"]} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	console.Infof("Discovering resources in %s", opts.Region)
+
+	functionNames, err := aws.DiscoverLambdas(opts.Region, opts.FilterTags)
+	if err != nil {
+		return err
+	}
+
+	bucketNames, err := aws.DiscoverBuckets(opts.Region, opts.FilterTags)
+	if err != nil {
+		return err
+	}
+
+	apiIds, err := aws.DiscoverApiGateways(opts.Region, opts.FilterTags)
+	if err != nil {
+		return err
+	}
+
+	console.Infof("Found %d lambda(s), %d bucket(s), and %d API(s)", len(functionNames), len(bucketNames), len(apiIds))
+
+	// Discovered functions are referenced by name, so integrations that invoke
+	// them can use a ref instead of looking the function up
+	functionRefs := make(map[string]string)
+	for _, name := range functionNames {
+		functionRefs[name] = name
+	}
+
+	var gateways []types.ApiGatewaySettings
+	usedRefs := make(map[string]bool)
+	for _, name := range sortedNames(apiIds) {
+		live, err := aws.GetApiGateway(opts.Region, apiIds[name])
+		if err != nil {
+			return err
+		}
+
+		gateway := apiGatewayFromLive(name, opts.Region, live, functionRefs)
+		for _, integration := range gateway.Integrations {
+			if integration.Target.Ref != nil {
+				usedRefs[*integration.Target.Ref] = true
+			}
+		}
+		gateways = append(gateways, gateway)
+	}
+
+	var functions []types.LambdaConfig
+	for _, name := range functionNames {
+		snapshot, err := aws.GetLambdaSnapshot(name, opts.Region)
+		if err != nil {
+			return err
+		}
+
+		fn, err := lambdaFromSnapshot(name, opts.Region, codeDir, snapshot)
+		if err != nil {
+			console.Warnf("Skipping lambda %s: %s", name, err.Error())
+			continue
+		}
+
+		if usedRefs[functionRefs[name]] {
+			fn.Ref = helpers.AsPtr(functionRefs[name])
+		}
+		functions = append(functions, fn)
+	}
+
+	var buckets []types.S3Settings
+	for _, name := range bucketNames {
+		ctx, cfg, err := aws.GetConfig(opts.Region)
+		if err != nil {
+			return err
+		}
+
+		bucket, err := aws.GetBucketSettings(ctx, *aws.GetClient(cfg), name, opts.Region)
+		if err != nil {
+			return err
+		}
+
+		if len(bucket.Tags) == 0 {
+			bucket.Tags = nil
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	project := types.Project{
+		Name:        opts.Name,
+		Environment: opts.Environment,
+		Variables: map[string]string{
+			"version":      "1.0",
+			"config_files": stagesDir,
+		},
+		Stages: []types.Stage{},
+	}
+
+	if len(functions) > 0 {
+		if err := writeJson(files["lambda"], types.LambdaData{Defaults: &types.LambdaDefaults{}, Functions: functions}); err != nil {
+			return err
+		}
+		project.Stages = append(project.Stages, discoveredStage("Lambdas", "lambda", "lambdas.json"))
+	}
+
+	if len(buckets) > 0 {
+		if err := writeJson(files["s3"], types.S3Config{Defaults: &types.S3Settings{}, Buckets: buckets}); err != nil {
+			return err
+		}
+		project.Stages = append(project.Stages, discoveredStage("Buckets", "s3", "buckets.json"))
+	}
+
+	if len(gateways) > 0 {
+		if err := writeJson(files["api"], types.ApiGatewayConfig{Defaults: &types.ApiGatewaySettings{}, Gateways: gateways}); err != nil {
+			return err
+		}
+
+		stage := discoveredStage("APIs", "api", "apis.json")
+		if len(usedRefs) > 0 && len(functions) > 0 {
+			stage.DependsOn = []string{"Lambdas"}
+		}
+		project.Stages = append(project.Stages, stage)
+	}
+
+	if err := writeJson(opts.Output, project); err != nil {
+		return err
+	}
+
+	console.Infof("Wrote project config to %s", opts.Output)
+	console.Info("Stages are set to take over their resources on the first deploy. Run labrador plan to review.")
+	return nil
+}
+
+func discoveredStage(name, stageType, file string) types.Stage {
+	return types.Stage{
+		Name:         name,
+		Type:         stageType,
+		Enabled:      types.NewToggle(true),
+		OnConflict:   constants.ON_CONFLICT_UPDATE,
+		OnError:      constants.ON_ERROR_STOP,
+		ConfigFile:   "{{config_files}}/" + file,
+		Environments: []string{},
+	}
+}
+
+func writeJson(path string, value any) error {
+	data, err := json.MarshalIndent(value, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
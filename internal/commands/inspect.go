@@ -4,26 +4,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/DQGriffin/labrador/internal/cli/console"
 	"github.com/DQGriffin/labrador/internal/cli/styles"
 	"github.com/DQGriffin/labrador/internal/helpers"
 	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/overlay"
 	"github.com/DQGriffin/labrador/pkg/types"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/tree"
 )
 
-func HandleInspectCommand(config *types.LabradorConfig, format string, stageTypesMap *map[string]bool, verbose bool) {
+func HandleInspectCommand(config *types.LabradorConfig, st *state.State, format string, stageTypesMap *map[string]bool, verbose bool) {
 	switch format {
 	case "plain":
-		printPlainText(config, stageTypesMap, verbose)
+		printPlainText(config, st, stageTypesMap, verbose)
 	case "tree":
-		printTree(config, stageTypesMap, verbose)
+		printTree(config, st, stageTypesMap, verbose)
 	case "json":
 		printJson(config)
 	default:
-		printPlainText(config, stageTypesMap, verbose)
+		printPlainText(config, st, stageTypesMap, verbose)
 	}
 
 	if len(config.Project.Stages) == 0 {
@@ -42,11 +45,11 @@ func printJson(config *types.LabradorConfig) {
 	fmt.Println(string(data))
 }
 
-func printTree(config *types.LabradorConfig, stageTypesMap *map[string]bool, verbose bool) {
+func printTree(config *types.LabradorConfig, st *state.State, stageTypesMap *map[string]bool, verbose bool) {
 	rootStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("252"))
 	t := tree.Root(config.Project.Name).RootStyle(rootStyle)
 
-	nodes := generateStageNodes(&config.Project.Stages, stageTypesMap, verbose)
+	nodes := generateStageNodes(&config.Project.Stages, st, stageTypesMap, verbose)
 
 	for i := range nodes {
 		t.Child(nodes[i])
@@ -55,21 +58,22 @@ func printTree(config *types.LabradorConfig, stageTypesMap *map[string]bool, ver
 	fmt.Println(t)
 }
 
-func generateStageNodes(stages *[]types.Stage, stageTypesMap *map[string]bool, verbose bool) []*tree.Tree {
+func generateStageNodes(stages *[]types.Stage, st *state.State, stageTypesMap *map[string]bool, verbose bool) []*tree.Tree {
 	var nodes []*tree.Tree
 
 	for _, stage := range *stages {
-		if !helpers.IsStageActionable(&stage, stageTypesMap) {
+		if reason := helpers.StageExclusionReason(&stage, stageTypesMap, st.Environment); reason != "" {
+			nodes = append(nodes, tree.New().Root(stage.Name+" "+styles.Tertiary.Render("("+describeEnabled(&stage)+", excluded: "+reason+")")))
 			continue
 		}
 
 		node := tree.New().
-			Root(stage.Name)
+			Root(stage.Name + " " + styles.Tertiary.Render("("+describeEnabled(&stage)+")"))
 
 		if stage.Type == "lambda" {
 			for _, fnConfig := range stage.Functions {
-				for _, fn := range fnConfig.Functions {
-					childNodes := generateLambdaNodes(&fn, verbose)
+				for i, fn := range fnConfig.Functions {
+					childNodes := generateLambdaNodes(&fn, st, newValueSource(&stage, "functions", i), verbose)
 					for i := range childNodes {
 						node.Child(childNodes[i])
 					}
@@ -77,8 +81,8 @@ func generateStageNodes(stages *[]types.Stage, stageTypesMap *map[string]bool, v
 			}
 		} else if stage.Type == "s3" {
 			for _, s3Config := range stage.Buckets {
-				for _, bucket := range s3Config.Buckets {
-					childNodes := generateS3Nodes(&bucket, verbose)
+				for i, bucket := range s3Config.Buckets {
+					childNodes := generateS3Nodes(&bucket, st, newValueSource(&stage, "buckets", i), verbose)
 					for i := range childNodes {
 						node.Child(childNodes[i])
 					}
@@ -86,8 +90,8 @@ func generateStageNodes(stages *[]types.Stage, stageTypesMap *map[string]bool, v
 			}
 		} else if stage.Type == "api" {
 			for _, gatewayConfig := range stage.Gateways {
-				for _, gateway := range gatewayConfig.Gateways {
-					childNodes := generateApiGatewayNodes(&gateway, verbose)
+				for i, gateway := range gatewayConfig.Gateways {
+					childNodes := generateApiGatewayNodes(&gateway, st, newValueSource(&stage, "gateways", i), verbose)
 					for i := range childNodes {
 						node.Child(childNodes[i])
 					}
@@ -101,19 +105,40 @@ func generateStageNodes(stages *[]types.Stage, stageTypesMap *map[string]bool, v
 	return nodes
 }
 
-func generateLambdaNodes(lambda *types.LambdaConfig, verbose bool) []*tree.Tree {
+func generateLambdaNodes(lambda *types.LambdaConfig, st *state.State, src valueSource, verbose bool) []*tree.Tree {
 	var nodes []*tree.Tree
 	node := tree.New().Root(styles.Tertiary.Bold(true).Render(lambda.Name))
 
 	if verbose {
-		node.Child(styles.Primary.Render("Region:     ") + styles.Secondary.Render(*lambda.Region))
-		node.Child(styles.Primary.Render("Code:       ") + styles.Secondary.Render(*lambda.Code))
-		node.Child(styles.Primary.Render("Handler:    ") + styles.Secondary.Render(*lambda.Handler))
-		node.Child(styles.Primary.Render("Runtime:    ") + styles.Secondary.Render(*lambda.Runtime))
-		node.Child(styles.Primary.Render("Role ARN:   ") + styles.Secondary.Render(*lambda.RoleArn))
-		node.Child(styles.Primary.Render("Memory:     ") + styles.Secondary.Render(fmt.Sprintf("%dmb", *lambda.MemorySize)))
-		node.Child(styles.Primary.Render("Timeout:    ") + styles.Secondary.Render(fmt.Sprintf("%ds", *lambda.Timeout)))
-		node.Child(styles.Primary.Render("On Delete:  ") + styles.Secondary.Render(helpers.PtrOrDefault(lambda.OnDelete, "delete")))
+		node.Child(styles.Primary.Render("Region:     ") + styles.Secondary.Render(*lambda.Region) + src.render("region"))
+		if lambda.IsImage() {
+			node.Child(styles.Primary.Render("Image:      ") + styles.Secondary.Render(helpers.PtrOrDefault(lambda.ImageUri, "")) + src.render("imageUri"))
+			node.Child(styles.Primary.Render("Image Tag:  ") + styles.Secondary.Render(imageTag(helpers.PtrOrDefault(lambda.ImageUri, ""))))
+		} else {
+			node.Child(styles.Primary.Render("Code:       ") + styles.Secondary.Render(*lambda.Code) + src.render("code"))
+			node.Child(styles.Primary.Render("Handler:    ") + styles.Secondary.Render(*lambda.Handler) + src.render("handler"))
+			node.Child(styles.Primary.Render("Runtime:    ") + styles.Secondary.Render(*lambda.Runtime) + src.render("runtime"))
+		}
+		node.Child(styles.Primary.Render("Arch:       ") + styles.Secondary.Render(helpers.PtrOrDefault(lambda.Architecture, "x86_64")) + src.render("architecture"))
+		node.Child(styles.Primary.Render("Role ARN:   ") + styles.Secondary.Render(*lambda.RoleArn) + src.render("roleArn"))
+		node.Child(styles.Primary.Render("Memory:     ") + styles.Secondary.Render(fmt.Sprintf("%dmb", *lambda.MemorySize)) + src.render("memory"))
+		node.Child(styles.Primary.Render("Timeout:    ") + styles.Secondary.Render(fmt.Sprintf("%ds", *lambda.Timeout)) + src.render("timeout"))
+		node.Child(styles.Primary.Render("Storage:    ") + styles.Secondary.Render(fmt.Sprintf("%dmb", helpers.PtrOrDefault(lambda.EphemeralStorage, aws.DefaultEphemeralStorage))) + src.render("ephemeralStorage"))
+		node.Child(styles.Primary.Render("Layers:     ") + styles.Secondary.Render(fmt.Sprintf("%d", len(lambda.Layers))) + src.render("layers"))
+		node.Child(styles.Primary.Render("VPC:        ") + styles.Secondary.Render(describeVpc(lambda.VpcConfig)) + src.render("vpcConfig"))
+		node.Child(styles.Primary.Render("Tracing:    ") + styles.Secondary.Render(helpers.PtrOrDefault(lambda.TracingConfig, types.LambdaTracingConfig{Mode: aws.DefaultTracingMode}).Mode) + src.render("tracingConfig"))
+		node.Child(styles.Primary.Render("DLQ:        ") + styles.Secondary.Render(describeDeadLetter(lambda.DeadLetterConfig)) + src.render("deadLetterConfig"))
+		node.Child(styles.Primary.Render("KMS Key:    ") + styles.Secondary.Render(helpers.PtrOrDefault(lambda.KmsKeyArn, "AWS managed key")) + src.render("kmsKeyArn"))
+		node.Child(styles.Primary.Render("Logging:    ") + styles.Secondary.Render(describeLogging(lambda.LoggingConfig)) + src.render("loggingConfig"))
+		node.Child(styles.Primary.Render("Reserved:   ") + styles.Secondary.Render(describeConcurrency(lambda.ReservedConcurrency)) + src.render("reservedConcurrency"))
+		node.Child(styles.Primary.Render("Aliases:    ") + styles.Secondary.Render(describeAliases(lambda.Aliases)))
+		node.Child(styles.Primary.Render("Triggers:   ") + styles.Secondary.Render(describeEventSources(lambda.EventSources)))
+		node.Child(styles.Primary.Render("Schedules:  ") + styles.Secondary.Render(describeSchedules(lambda.Schedules)))
+		node.Child(styles.Primary.Render("Versions:   ") + styles.Secondary.Render(describeRetention(lambda.RetainVersions)) + src.render("retainVersions"))
+		node.Child(styles.Primary.Render("On Delete:  ") + styles.Secondary.Render(helpers.PtrOrDefault(lambda.OnDelete, "delete")) + src.render("onDelete"))
+		node.Child(styles.Primary.Render("Env Vars:   ") + styles.Secondary.Render(fmt.Sprintf("%d", len(lambda.Environment))) + src.render("environment"))
+		node.Child(styles.Primary.Render("Tags:       ") + styles.Secondary.Render(fmt.Sprintf("%d", len(lambda.Tags))) + src.render("tags"))
+		node.Child(styles.Primary.Render("State:      ") + styles.Secondary.Render(describeState(st, "lambda", lambda.Name)))
 	}
 
 	nodes = append(nodes, node)
@@ -121,30 +146,34 @@ func generateLambdaNodes(lambda *types.LambdaConfig, verbose bool) []*tree.Tree
 	return nodes
 }
 
-func generateS3Nodes(s3 *types.S3Settings, verbose bool) []*tree.Tree {
+func generateS3Nodes(s3 *types.S3Settings, st *state.State, src valueSource, verbose bool) []*tree.Tree {
 	var nodes []*tree.Tree
 	node := tree.New().Root(styles.Tertiary.Bold(true).Render(*s3.Name))
 
 	if verbose {
-		node.Child(styles.Primary.Render("Region:               ") + styles.Secondary.Render(helpers.PtrOrDefault(s3.Region, "[region not set]")))
-		node.Child(styles.Primary.Render("Versioning:           ") + styles.Secondary.Render(fmt.Sprintf("%t", helpers.PtrOrDefault(s3.Versioning, false))))
-		node.Child(styles.Primary.Render("Block Public Access:  ") + styles.Secondary.Render(fmt.Sprintf("%t", helpers.PtrOrDefault(s3.BlockPublicAccess, true))))
-		node.Child(styles.Primary.Render("On Delete:            ") + styles.Secondary.Render(helpers.PtrOrDefault(s3.OnDelete, "delete")))
+		node.Child(styles.Primary.Render("Region:               ") + styles.Secondary.Render(helpers.PtrOrDefault(s3.Region, "[region not set]")) + src.render("region"))
+		node.Child(styles.Primary.Render("Versioning:           ") + styles.Secondary.Render(fmt.Sprintf("%t", helpers.PtrOrDefault(s3.Versioning, false))) + src.render("versioning"))
+		node.Child(styles.Primary.Render("Block Public Access:  ") + styles.Secondary.Render(fmt.Sprintf("%t", helpers.PtrOrDefault(s3.BlockPublicAccess, true))) + src.render("blockPublicAccess"))
+		node.Child(styles.Primary.Render("On Delete:            ") + styles.Secondary.Render(helpers.PtrOrDefault(s3.OnDelete, "delete")) + src.render("onDelete"))
+		node.Child(styles.Primary.Render("Tags:                 ") + styles.Secondary.Render(fmt.Sprintf("%d", len(s3.Tags))) + src.render("tags"))
+		node.Child(styles.Primary.Render("Notifications:        ") + styles.Secondary.Render(describeNotifications(s3.Notifications)) + src.render("notifications"))
+		node.Child(styles.Primary.Render("State:                ") + styles.Secondary.Render(describeState(st, "s3", helpers.PtrOrDefault(s3.Name, ""))))
 	}
 
 	nodes = append(nodes, node)
 	return nodes
 }
 
-func generateApiGatewayNodes(gateway *types.ApiGatewaySettings, verbose bool) []*tree.Tree {
+func generateApiGatewayNodes(gateway *types.ApiGatewaySettings, st *state.State, src valueSource, verbose bool) []*tree.Tree {
 	var nodes []*tree.Tree
 	node := tree.New().Root(styles.Tertiary.Bold(true).Render(*gateway.Name))
 
 	if verbose {
-		node.Child(styles.Primary.Render("Region:       ") + styles.Secondary.Render(helpers.PtrOrDefault(gateway.Region, "[region not set]")))
-		node.Child(styles.Primary.Render("Protocol:     ") + styles.Secondary.Render(helpers.PtrOrDefault(gateway.Protocol, "[protocol not set]")))
-		node.Child(styles.Primary.Render("Description:  ") + styles.Secondary.Render(helpers.PtrOrDefault(gateway.Description, "[description not set]")))
-		stagesNode := tree.New().Root(styles.Primary.Render("Stages"))
+		node.Child(styles.Primary.Render("Region:       ") + styles.Secondary.Render(helpers.PtrOrDefault(gateway.Region, "[region not set]")) + src.render("region"))
+		node.Child(styles.Primary.Render("Protocol:     ") + styles.Secondary.Render(helpers.PtrOrDefault(gateway.Protocol, "[protocol not set]")) + src.render("protocol"))
+		node.Child(styles.Primary.Render("Description:  ") + styles.Secondary.Render(helpers.PtrOrDefault(gateway.Description, "[description not set]")) + src.render("description"))
+		node.Child(styles.Primary.Render("State:        ") + styles.Secondary.Render(describeState(st, "api", helpers.PtrOrDefault(gateway.Name, ""))))
+		stagesNode := tree.New().Root(styles.Primary.Render("Stages") + src.render("stages"))
 
 		for _, stage := range *gateway.Stages {
 			childNodes := generateApiGatewayStageNodes(&stage)
@@ -153,7 +182,7 @@ func generateApiGatewayNodes(gateway *types.ApiGatewaySettings, verbose bool) []
 			}
 		}
 
-		integrationsNode := tree.New().Root(styles.Primary.Render("Integrations"))
+		integrationsNode := tree.New().Root(styles.Primary.Render("Integrations") + src.render("integrations"))
 		for integationIndex, integration := range gateway.Integrations {
 			childNodes := generateApiGatewayIntegrationNodes(&integration, integationIndex)
 			for i := range childNodes {
@@ -161,7 +190,7 @@ func generateApiGatewayNodes(gateway *types.ApiGatewaySettings, verbose bool) []
 			}
 		}
 
-		routesNode := tree.New().Root(styles.Primary.Render("Routes"))
+		routesNode := tree.New().Root(styles.Primary.Render("Routes") + src.render("routes"))
 		for _, route := range gateway.Routes {
 			childNodes := generateApiGatewayRouteNodes(&route)
 			for i := range childNodes {
@@ -192,15 +221,8 @@ func generateApiGatewayIntegrationNodes(integration *types.ApiGatewayIntegration
 	var nodes []*tree.Tree
 	node := tree.New().Root(styles.Primary.Render(fmt.Sprintf("Integration %d", iteration+1)))
 
-	m := make(map[string]string)
-	arn, err := aws.ResolveTarget(integration.Target, m)
-
 	node.Child(styles.Primary.Render("Type:                ") + styles.Secondary.Render(integration.Type))
-	if err != nil {
-		node.Child(styles.Primary.Render("Target:              ") + styles.Secondary.Render("[unresolved]"))
-	} else {
-		node.Child(styles.Primary.Render("Target:              ") + styles.Secondary.Render(arn))
-	}
+	node.Child(styles.Primary.Render("Target:              ") + styles.Secondary.Render(describeTarget(integration.Target)))
 	node.Child(styles.Primary.Render("Payload Version:     ") + styles.Secondary.Render(integration.PayloadVersion))
 	node.Child(styles.Primary.Render("Integration Method:  ") + styles.Secondary.Render(integration.IntegrationMethod))
 
@@ -217,10 +239,10 @@ func generateApiGatewayRouteNodes(route *types.ApiGatewayRoute) []*tree.Tree {
 	return nodes
 }
 
-func printPlainText(config *types.LabradorConfig, stageTypesMap *map[string]bool, verbose bool) {
+func printPlainText(config *types.LabradorConfig, st *state.State, stageTypesMap *map[string]bool, verbose bool) {
 	console.Info("============================")
 	plainPrintProject(&config.Project, verbose)
-	plainPrintStages(&config.Project.Stages, stageTypesMap, verbose)
+	plainPrintStages(&config.Project.Stages, st, stageTypesMap, verbose)
 
 	if !verbose {
 		console.Info("\nRun with --verbose to view detailed resource configuration.")
@@ -232,81 +254,112 @@ func plainPrintProject(project *types.Project, verbose bool) {
 	console.Infof("Environment: %s", project.Environment)
 }
 
-func plainPrintStages(stages *[]types.Stage, stageTypesMap *map[string]bool, verbose bool) {
+func plainPrintStages(stages *[]types.Stage, st *state.State, stageTypesMap *map[string]bool, verbose bool) {
 	console.Info("\nStages:")
 	for _, stage := range *stages {
-		if isStageActionable(&stage, stageTypesMap) {
-			console.Infof("- %s (%s)", stage.Name, stage.Type)
+		if reason := helpers.StageExclusionReason(&stage, stageTypesMap, st.Environment); reason != "" {
+			console.Infof("- %s (%s, %s) excluded: %s", stage.Name, stage.Type, describeEnabled(&stage), reason)
+		} else {
+			console.Infof("- %s (%s, %s)", stage.Name, stage.Type, describeEnabled(&stage))
 
 			for _, fnConfig := range stage.Functions {
-				for _, fn := range fnConfig.Functions {
-					plainPrintLambda(&fn, verbose)
+				for i, fn := range fnConfig.Functions {
+					plainPrintLambda(&fn, st, newValueSource(&stage, "functions", i), verbose)
 				}
 			}
 
 			for _, s3Config := range stage.Buckets {
-				for _, bucket := range s3Config.Buckets {
-					plainPrintS3(&bucket, verbose)
+				for i, bucket := range s3Config.Buckets {
+					plainPrintS3(&bucket, st, newValueSource(&stage, "buckets", i), verbose)
 				}
 			}
 
 			for _, gatewayConfig := range stage.Gateways {
-				for _, gateway := range gatewayConfig.Gateways {
-					plainPrintApiGateway(&gateway, verbose)
+				for i, gateway := range gatewayConfig.Gateways {
+					plainPrintApiGateway(&gateway, st, newValueSource(&stage, "gateways", i), verbose)
 				}
 			}
 		}
 	}
 }
 
-func isStageActionable(stage *types.Stage, stageTypesMap *map[string]bool) bool {
-	if len(*stageTypesMap) == 0 {
-		return true
+func plainPrintLambda(lambda *types.LambdaConfig, st *state.State, src valueSource, verbose bool) {
+	if lambda.IsImage() {
+		console.Infof("  - %-25s -> image %s", lambda.Name, imageTag(helpers.PtrOrDefault(lambda.ImageUri, "")))
+	} else {
+		console.Infof("  - %-25s -> %s", lambda.Name, *lambda.Code)
 	}
-
-	return (*stageTypesMap)[stage.Type]
-}
-
-func plainPrintLambda(lambda *types.LambdaConfig, verbose bool) {
-	console.Infof("  - %-25s -> %s", lambda.Name, *lambda.Code)
 	if verbose {
-		console.Infof("    - Region      : %s", *lambda.Region)
-		console.Infof("    - Handler     : %s", *lambda.Handler)
-		console.Infof("    - Runtime     : %s", *lambda.Runtime)
-		console.Infof("    - Role ARN    : %s", *lambda.RoleArn)
-		console.Infof("    - Memory      : %dmb", *lambda.MemorySize)
-		console.Infof("    - Timeout     : %ds", *lambda.Timeout)
-		console.Infof("    - On Delete   : %s", helpers.PtrOrDefault(lambda.OnDelete, "delete"))
-		console.Info("    - Environment :")
+		console.Infof("    - Region      : %s%s", *lambda.Region, src.describe("region"))
+		if lambda.IsImage() {
+			console.Infof("    - Image       : %s%s", helpers.PtrOrDefault(lambda.ImageUri, ""), src.describe("imageUri"))
+		} else {
+			console.Infof("    - Handler     : %s%s", *lambda.Handler, src.describe("handler"))
+			console.Infof("    - Runtime     : %s%s", *lambda.Runtime, src.describe("runtime"))
+		}
+		console.Infof("    - Arch        : %s%s", helpers.PtrOrDefault(lambda.Architecture, "x86_64"), src.describe("architecture"))
+		console.Infof("    - Role ARN    : %s%s", *lambda.RoleArn, src.describe("roleArn"))
+		console.Infof("    - Memory      : %dmb%s", *lambda.MemorySize, src.describe("memory"))
+		console.Infof("    - Timeout     : %ds%s", *lambda.Timeout, src.describe("timeout"))
+		console.Infof("    - Storage     : %dmb%s", helpers.PtrOrDefault(lambda.EphemeralStorage, aws.DefaultEphemeralStorage), src.describe("ephemeralStorage"))
+		console.Infof("    - VPC         : %s%s", describeVpc(lambda.VpcConfig), src.describe("vpcConfig"))
+		console.Infof("    - Tracing     : %s%s", helpers.PtrOrDefault(lambda.TracingConfig, types.LambdaTracingConfig{Mode: aws.DefaultTracingMode}).Mode, src.describe("tracingConfig"))
+		console.Infof("    - DLQ         : %s%s", describeDeadLetter(lambda.DeadLetterConfig), src.describe("deadLetterConfig"))
+		console.Infof("    - KMS Key     : %s%s", helpers.PtrOrDefault(lambda.KmsKeyArn, "AWS managed key"), src.describe("kmsKeyArn"))
+		console.Infof("    - Logging     : %s%s", describeLogging(lambda.LoggingConfig), src.describe("loggingConfig"))
+		console.Infof("    - Concurrency : %s%s", describeConcurrency(lambda.ReservedConcurrency), src.describe("reservedConcurrency"))
+		console.Infof("    - Layers      :%s", src.describe("layers"))
+		for _, layer := range lambda.Layers {
+			console.Infof("      - %s", layer)
+		}
+		console.Infof("    - Aliases     : %s", describeAliases(lambda.Aliases))
+		console.Infof("    - Triggers    : %s", describeEventSources(lambda.EventSources))
+		for _, source := range lambda.EventSources {
+			console.Infof("      - %s", describeEventSourceTarget(source))
+		}
+		console.Infof("    - Schedules   : %s", describeSchedules(lambda.Schedules))
+		for _, schedule := range lambda.Schedules {
+			console.Infof("      - %s: %s", schedule.Name, describeSchedule(schedule))
+		}
+		console.Infof("    - Versions    : %s%s", describeRetention(lambda.RetainVersions), src.describe("retainVersions"))
+		console.Infof("    - On Delete   : %s%s", helpers.PtrOrDefault(lambda.OnDelete, "delete"), src.describe("onDelete"))
+		console.Infof("    - State       : %s", describeState(st, "lambda", lambda.Name))
+		console.Infof("    - Environment :%s", src.describe("environment"))
 		PrintMapAligned("      - ", lambda.Environment)
-		console.Info("    - Tags :")
+		console.Infof("    - Tags :%s", src.describe("tags"))
 		PrintMapAligned("      - ", lambda.Tags)
 		console.Info()
 	}
 }
 
-func plainPrintS3(s3 *types.S3Settings, verbose bool) {
+func plainPrintS3(s3 *types.S3Settings, st *state.State, src valueSource, verbose bool) {
 	console.Infof("  - %s ", helpers.PtrOrDefault(s3.Name, "[Name not set]"))
 	if verbose {
-		console.Infof("    - Region               : %s", helpers.PtrOrDefault(s3.Region, "[region not set]"))
-		console.Infof("    - Versioning           : %t", helpers.PtrOrDefault(s3.Versioning, false))
-		console.Infof("    - Block Public Access  : %t", helpers.PtrOrDefault(s3.BlockPublicAccess, true))
-		console.Infof("    - On Delete            : %s", helpers.PtrOrDefault(s3.OnDelete, "delete"))
-		console.Info("    - Tags                 :")
+		console.Infof("    - Region               : %s%s", helpers.PtrOrDefault(s3.Region, "[region not set]"), src.describe("region"))
+		console.Infof("    - Versioning           : %t%s", helpers.PtrOrDefault(s3.Versioning, false), src.describe("versioning"))
+		console.Infof("    - Block Public Access  : %t%s", helpers.PtrOrDefault(s3.BlockPublicAccess, true), src.describe("blockPublicAccess"))
+		console.Infof("    - On Delete            : %s%s", helpers.PtrOrDefault(s3.OnDelete, "delete"), src.describe("onDelete"))
+		console.Infof("    - State                : %s", describeState(st, "s3", helpers.PtrOrDefault(s3.Name, "")))
+		console.Infof("    - Notifications        : %s%s", describeNotifications(s3.Notifications), src.describe("notifications"))
+		for _, notification := range s3.Notifications {
+			console.Infof("      - %s", describeNotification(notification))
+		}
+		console.Infof("    - Tags                 :%s", src.describe("tags"))
 		PrintMapAligned("      - ", s3.Tags)
 		console.Info()
 	}
 }
 
-func plainPrintApiGateway(gateway *types.ApiGatewaySettings, verbose bool) {
+func plainPrintApiGateway(gateway *types.ApiGatewaySettings, st *state.State, src valueSource, verbose bool) {
 	console.Infof("  - %s ", helpers.PtrOrDefault(gateway.Name, "[Name not set]"))
 	if verbose {
-		console.Infof("    - Protocol     : %s", helpers.PtrOrDefault(gateway.Protocol, "[protocol not set]"))
-		console.Infof("    - Description  : %s", helpers.PtrOrDefault(gateway.Description, "[description not set]"))
+		console.Infof("    - Protocol     : %s%s", helpers.PtrOrDefault(gateway.Protocol, "[protocol not set]"), src.describe("protocol"))
+		console.Infof("    - Description  : %s%s", helpers.PtrOrDefault(gateway.Description, "[description not set]"), src.describe("description"))
+		console.Infof("    - State        : %s", describeState(st, "api", helpers.PtrOrDefault(gateway.Name, "")))
 		plainPrintApiGatewayStages(gateway.Stages)
 		plainPrintApiGatewayIntegrations(&gateway.Integrations)
 		plainPrintApiGatewayRoutes(&gateway.Routes)
-		console.Info("    - Tags         :")
+		console.Infof("    - Tags         :%s", src.describe("tags"))
 		PrintMapAligned("      - ", gateway.Tags)
 		console.Info()
 	}
@@ -316,13 +369,7 @@ func plainPrintApiGatewayIntegrations(integrations *[]types.ApiGatewayIntegratio
 	console.Info("    - Integrations")
 	for _, integration := range *integrations {
 		console.Infof("      - Type                : %s", integration.Type)
-		m := make(map[string]string)
-		arn, err := aws.ResolveTarget(integration.Target, m)
-		if err != nil {
-			console.Infof("      - Target              : %s", "[unresolved]")
-		} else {
-			console.Infof("      - Target              : %s", arn)
-		}
+		console.Infof("      - Target              : %s", describeTarget(integration.Target))
 		console.Infof("      - Payload version     : %s", integration.PayloadVersion)
 		console.Infof("      - Integration method  : %s", integration.IntegrationMethod)
 	}
@@ -348,6 +395,195 @@ func plainPrintApiGatewayStages(stages *[]types.ApiGatewayStage) {
 	}
 }
 
+// valueSource finds the files a resource's settings came from, so inspect can
+// show which values were set by an environment overlay
+type valueSource struct {
+	sources overlay.Sources
+	path    string
+}
+
+func newValueSource(stage *types.Stage, list string, index int) valueSource {
+	return valueSource{sources: stage.Sources, path: fmt.Sprintf("%s.%d", list, index)}
+}
+
+// describe returns " (from <file>)" for a setting, falling back to the config's
+// defaults when the resource doesn't set it itself
+func (v valueSource) describe(key string) string {
+	if file := v.sources.Origin(v.path + "." + key); file != "" {
+		return fmt.Sprintf(" (from %s)", file)
+	}
+
+	if file := v.sources.Origin("defaults." + key); file != "" {
+		return fmt.Sprintf(" (from %s defaults)", file)
+	}
+
+	return ""
+}
+
+func (v valueSource) render(key string) string {
+	return styles.Tertiary.Render(v.describe(key))
+}
+
+// describeTarget shows the ARN an integration points at, or the ref of the Lambda
+// it targets. Refs only resolve during plan and deploy.
+func describeTarget(target types.ResourceTarget) string {
+	if target.Ref != nil && *target.Ref != "" {
+		return "ref " + *target.Ref
+	}
+
+	arn, err := aws.ResolveTarget(target, map[string]string{})
+	if err != nil {
+		return "[unresolved]"
+	}
+	return arn
+}
+
+// imageTag returns the tag or digest of an image URI, e.g.
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com/orders:v1.2 -> v1.2
+func imageTag(uri string) string {
+	if _, digest, found := strings.Cut(uri, "@"); found {
+		return digest
+	}
+
+	name := uri[strings.LastIndex(uri, "/")+1:]
+	if _, tag, found := strings.Cut(name, ":"); found {
+		return tag
+	}
+	return "latest"
+}
+
+func describeVpc(vpc *types.LambdaVpcConfig) string {
+	if vpc == nil || len(vpc.SubnetIds) == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d subnet(s), %d security group(s)", len(vpc.SubnetIds), len(vpc.SecurityGroupIds))
+}
+
+func describeDeadLetter(deadLetter *types.LambdaDeadLetterConfig) string {
+	if deadLetter == nil || deadLetter.TargetArn == "" {
+		return "none"
+	}
+	return deadLetter.TargetArn
+}
+
+func describeLogging(logging *types.LambdaLoggingConfig) string {
+	if logging == nil {
+		return "default"
+	}
+
+	description := helpers.PtrOrDefault(logging.LogFormat, "Text")
+	if logging.LogGroup != nil {
+		description += " to " + *logging.LogGroup
+	}
+	return description
+}
+
+func describeConcurrency(reserved *uint16) string {
+	if reserved == nil {
+		return "unreserved"
+	}
+	return fmt.Sprintf("%d reserved", *reserved)
+}
+
+func describeAliases(aliases []types.LambdaAlias) string {
+	if len(aliases) == 0 {
+		return "none"
+	}
+
+	names := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		if alias.RoutingConfig != nil {
+			names = append(names, fmt.Sprintf("%s (%s canary)", alias.Name, aws.FormatWeight(alias.RoutingConfig.Weight)))
+		} else {
+			names = append(names, alias.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func describeEventSources(sources []types.LambdaEventSource) string {
+	if sources == nil {
+		return "not managed"
+	}
+	return fmt.Sprintf("%d event source(s)", len(sources))
+}
+
+func describeEventSourceTarget(source types.LambdaEventSource) string {
+	if source.SourceArn != nil {
+		return *source.SourceArn
+	}
+	if source.Source != nil {
+		return describeTarget(*source.Source)
+	}
+	return "[source not set]"
+}
+
+func describeSchedules(schedules []types.LambdaSchedule) string {
+	if schedules == nil {
+		return "not managed"
+	}
+	return fmt.Sprintf("%d schedule(s)", len(schedules))
+}
+
+func describeSchedule(schedule types.LambdaSchedule) string {
+	description := schedule.Expression
+	if schedule.Timezone != nil {
+		description += " " + *schedule.Timezone
+	}
+	if schedule.Enabled != nil && !*schedule.Enabled {
+		description += " (disabled)"
+	}
+	return description
+}
+
+func describeNotifications(notifications []types.S3Notification) string {
+	if notifications == nil {
+		return "not managed"
+	}
+	return fmt.Sprintf("%d notification(s)", len(notifications))
+}
+
+// describeNotification shows a notification's events, filters and target,
+// e.g. s3:ObjectCreated:* uploads/*.png -> ref processor
+func describeNotification(notification types.S3Notification) string {
+	description := strings.Join(notification.Events, ", ")
+	if notification.Prefix != nil || notification.Suffix != nil {
+		description += " " + helpers.PtrOrDefault(notification.Prefix, "") + "*" + helpers.PtrOrDefault(notification.Suffix, "")
+	}
+	return description + " -> " + describeTarget(notification.Target)
+}
+
+func describeRetention(retain *uint16) string {
+	if retain == nil {
+		return "keep all"
+	}
+	return fmt.Sprintf("keep newest %d", *retain)
+}
+
+func describeEnabled(stage *types.Stage) string {
+	if enabled, err := stage.IsEnabled(); err != nil || !enabled {
+		return "disabled"
+	}
+	return "enabled"
+}
+
+func describeState(st *state.State, resourceType, name string) string {
+	resource, exists := st.Get(resourceType, name)
+	if !exists {
+		return "not managed"
+	}
+
+	if resource.Arn != "" {
+		return fmt.Sprintf("managed (%s)", resource.Arn)
+	}
+
+	if resource.Id != "" {
+		return fmt.Sprintf("managed (%s)", resource.Id)
+	}
+
+	return "managed"
+}
+
 func PrintMapAligned(prefix string, m map[string]string) {
 	// First, find the longest key
 	maxKeyLen := 0
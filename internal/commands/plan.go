@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/plan"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/types"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+func HandlePlanCommand(config types.LabradorConfig, st *state.State, stageTypesMap *map[string]bool, existingLambdas map[string]lambdaTypes.FunctionConfiguration, existingBuckets map[string]bool, existingApiGateways map[string]string, pruneRemoved bool) (*plan.Plan, error) {
+	p, err := plan.Build(config, st, stageTypesMap, existingLambdas, existingBuckets, existingApiGateways, pruneRemoved)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Print(p)
+	return p, nil
+}
+
+// HandleApplyPlan deploys exactly what a saved plan describes. The plan is rebuilt
+// against the live account first and refused if anything has changed since it was made.
+func HandleApplyPlan(config types.LabradorConfig, st *state.State, saved *plan.Plan, opts DeployOptions, existingLambdas map[string]lambdaTypes.FunctionConfiguration, existingBuckets map[string]bool, existingApiGateways map[string]string) error {
+	for _, resource := range saved.Resources {
+		if resource.Error != "" {
+			return fmt.Errorf("plan could not be completed for %s %s: %s", resource.Type, resource.Name, resource.Error)
+		}
+	}
+
+	stageTypesMap := make(map[string]bool)
+	for _, stageType := range saved.StageTypes {
+		stageTypesMap[stageType] = true
+	}
+
+	fresh, err := plan.Build(config, st, &stageTypesMap, existingLambdas, existingBuckets, existingApiGateways, saved.PruneRemoved)
+	if err != nil {
+		return err
+	}
+
+	differences := plan.Compare(saved, fresh)
+	if len(differences) > 0 {
+		for _, difference := range differences {
+			console.Warn(difference)
+		}
+		return fmt.Errorf("the plan is out of date, run labrador plan again")
+	}
+
+	if len(saved.Selection()) == 0 {
+		console.Info("Plan has no changes to apply")
+		return nil
+	}
+
+	opts.Selection = saved.Selection()
+	opts.PruneRemoved = saved.PruneRemoved
+	return HandleDeployCommand(config, st, &stageTypesMap, existingLambdas, existingBuckets, &existingApiGateways, opts)
+}
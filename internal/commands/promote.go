@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+// HandlePromoteCommand finishes a weighted rollout by sending all of an
+// alias's traffic to the newest version
+func HandlePromoteCommand(config types.LabradorConfig, functionName string, aliasName string) error {
+	for _, stage := range config.Project.Stages {
+		for _, functionData := range stage.Functions {
+			for _, fn := range functionData.Functions {
+				if fn.Name != functionName {
+					continue
+				}
+
+				if !hasAlias(fn, aliasName) {
+					console.Warnf("Alias %q is not declared for lambda %q. The next deploy won't manage it", aliasName, functionName)
+				}
+
+				return aws.PromoteAlias(*fn.Region, fn.Name, aliasName, console.Std)
+			}
+		}
+	}
+
+	return fmt.Errorf("lambda %q is not part of the project", functionName)
+}
+
+func hasAlias(fn types.LambdaConfig, aliasName string) bool {
+	for _, alias := range fn.Aliases {
+		if alias.Name == aliasName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+// HandlePruneCommand deletes the published versions of every function with
+// retainVersions that are beyond its retention count and not behind an alias.
+// functionName restricts it to one function.
+func HandlePruneCommand(config types.LabradorConfig, st *state.State, functionName string, isDryRun bool) error {
+	stageTypesMap := map[string]bool{"lambda": true}
+	found := false
+	failed := 0
+
+	for _, stage := range config.Project.Stages {
+		if !helpers.IsStageActionable(&stage, &stageTypesMap, st.Environment) {
+			continue
+		}
+
+		for _, functionData := range stage.Functions {
+			for _, fn := range functionData.Functions {
+				if functionName != "" && fn.Name != functionName {
+					continue
+				}
+				found = true
+
+				if fn.RetainVersions == nil {
+					console.Debugf("Skipping lambda %s because retainVersions is not set", fn.Name)
+					continue
+				}
+
+				if !st.IsManaged("lambda", fn.Name) {
+					console.Debugf("Skipping lambda %s because it is not managed by Labrador", fn.Name)
+					continue
+				}
+
+				if err := pruneVersions(fn, isDryRun, console.Std); err != nil {
+					console.Error(err.Error())
+					failed++
+				}
+			}
+		}
+	}
+
+	if functionName != "" && !found {
+		return fmt.Errorf("lambda %q is not part of the project", functionName)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to prune versions of %d lambda(s)", failed)
+	}
+
+	return nil
+}
+
+// pruneVersions deletes a function's stale versions, or only lists them on a dry run
+func pruneVersions(fn types.LambdaConfig, isDryRun bool, out console.Printer) error {
+	stale, err := aws.StaleVersions(*fn.Region, fn.Name, int(*fn.RetainVersions))
+	if err != nil {
+		return err
+	}
+
+	if len(stale) == 0 {
+		out.Debugf("Lambda %s has no versions to prune", fn.Name)
+		return nil
+	}
+
+	for _, version := range stale {
+		if isDryRun {
+			out.Infof("Would delete version %s of lambda %s", version, fn.Name)
+			continue
+		}
+
+		if err := aws.DeleteLambdaVersion(*fn.Region, fn.Name, version); err != nil {
+			return err
+		}
+		out.Infof("Deleted version %s of lambda %s", version, fn.Name)
+	}
+
+	return nil
+}
+
+// pruneStageVersions cleans up old versions once a lambda stage has deployed.
+// A failure is only reported, since the deploy itself has already succeeded.
+func pruneStageVersions(stage *types.Stage, opts *DeployOptions) {
+	for _, functionData := range stage.Functions {
+		for _, fn := range functionData.Functions {
+			if fn.RetainVersions == nil || !opts.isSelected("lambda", fn.Name) {
+				continue
+			}
+
+			if err := pruneVersions(fn, false, console.Std); err != nil {
+				console.Warnf("Failed to prune old versions of lambda %s: %s", fn.Name, err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package commands
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
+	internalTypes "github.com/DQGriffin/labrador/internal/types"
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+// snapshot is what a resource looked like before the deploy touched it
+type snapshot struct {
+	resourceType string
+	name         string
+	region       string
+	// created resources didn't exist before the deploy, so rolling back deletes them
+	created  bool
+	previous *state.ResourceState
+	lambda   *aws.LambdaSnapshot
+	lambdaFn types.LambdaConfig
+	bucket   *types.S3Settings
+	// notifications is only set when the deploy manages the bucket's notifications
+	notifications []aws.BucketNotification
+	api           *aws.LiveApiGateway
+}
+
+// stageSnapshots collects snapshots from a stage whose onError is rollback.
+// A nil *stageSnapshots means no snapshots are taken.
+type stageSnapshots struct {
+	mu    sync.Mutex
+	items []snapshot
+}
+
+func (s *stageSnapshots) add(snap snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, snap)
+}
+
+// created records that the deploy created a resource
+func (s *stageSnapshots) created(resourceType, name, region string) {
+	if s == nil {
+		return
+	}
+
+	s.add(snapshot{resourceType: resourceType, name: name, region: region, created: true})
+}
+
+func (s *stageSnapshots) lambdaUpdated(st *state.State, fn types.LambdaConfig, out console.Printer) error {
+	if s == nil {
+		return nil
+	}
+
+	previous, err := aws.SnapshotLambda(fn, out)
+	if err != nil {
+		return fmt.Errorf("could not snapshot lambda for rollback: %w", err)
+	}
+
+	s.add(snapshot{resourceType: "lambda", name: fn.Name, region: *fn.Region, previous: previousState(st, "lambda", fn.Name), lambda: &previous, lambdaFn: fn})
+	return nil
+}
+
+func (s *stageSnapshots) bucketUpdated(st *state.State, bucket types.S3Settings) error {
+	if s == nil {
+		return nil
+	}
+
+	ctx, cfg, err := aws.GetConfig(*bucket.Region)
+	if err != nil {
+		return err
+	}
+
+	previous, err := aws.GetBucketSettings(ctx, *aws.GetClient(cfg), *bucket.Name, *bucket.Region)
+	if err != nil {
+		return fmt.Errorf("could not snapshot bucket for rollback: %w", err)
+	}
+
+	var notifications []aws.BucketNotification
+	if bucket.Notifications != nil {
+		notifications, err = aws.ListBucketNotifications(ctx, aws.GetClient(cfg), *bucket.Name)
+		if err != nil {
+			return fmt.Errorf("could not snapshot bucket for rollback: %w", err)
+		}
+	}
+
+	s.add(snapshot{resourceType: "s3", name: *bucket.Name, region: *bucket.Region, previous: previousState(st, "s3", *bucket.Name), bucket: &previous, notifications: notifications})
+	return nil
+}
+
+func (s *stageSnapshots) apiGatewayUpdated(st *state.State, gateway types.ApiGatewaySettings, apiId string) error {
+	if s == nil {
+		return nil
+	}
+
+	previous, err := aws.GetApiGateway(*gateway.Region, apiId)
+	if err != nil {
+		return fmt.Errorf("could not snapshot API for rollback: %w", err)
+	}
+
+	s.add(snapshot{resourceType: "api", name: *gateway.Name, region: *gateway.Region, previous: previousState(st, "api", *gateway.Name), api: &previous})
+	return nil
+}
+
+// rollbackStage restores every resource the stage touched and deletes the ones it created
+func rollbackStage(stage *types.Stage, st *state.State, snapshots *stageSnapshots, r *runner) {
+	if snapshots == nil || len(snapshots.items) == 0 {
+		return
+	}
+
+	console.Headingf("[Rollback - %s]", stage.Name)
+
+	var tasks []resourceTask
+	for _, snap := range snapshots.items {
+		tasks = append(tasks, resourceTask{
+			title: fmt.Sprintf("rollback %s %s", snap.resourceType, snap.name),
+			run: func(out console.Printer) error {
+				return restoreSnapshot(snap, st, out)
+			},
+		})
+	}
+
+	if r.runRollback(tasks) {
+		console.Infof("Rolled back stage %s", stage.Name)
+	} else {
+		console.Errorf("Stage %s could not be fully rolled back", stage.Name)
+	}
+}
+
+func restoreSnapshot(snap snapshot, st *state.State, out console.Printer) error {
+	if snap.created {
+		// Only delete what the deploy recorded, never a resource it couldn't confirm it owns
+		recorded, exists := st.Get(snap.resourceType, snap.name)
+		if !exists {
+			out.Warnf("Not deleting %s %s because it is not in the state", snap.resourceType, snap.name)
+			return nil
+		}
+		return destroyResource(internalTypes.UniversalResourceDefinition{
+			Name:         snap.name,
+			Id:           recorded.Id,
+			ResourceType: snap.resourceType,
+			Region:       snap.region,
+		}, st, true, out)
+	}
+
+	var err error
+	switch {
+	case snap.lambda != nil:
+		err = aws.RestoreLambda(*snap.lambda, snap.lambdaFn, out)
+	case snap.bucket != nil:
+		err = aws.RestoreBucket(*snap.bucket, out)
+		if err == nil && snap.notifications != nil {
+			err = aws.RestoreBucketNotifications(snap.name, snap.region, snap.notifications, out)
+		}
+	case snap.api != nil:
+		err = aws.RestoreApiGateway(*snap.api, snap.region, out)
+	}
+	if err != nil {
+		return err
+	}
+
+	// A resource that was taken over during the deploy goes back to being unmanaged
+	if snap.previous == nil {
+		return st.Remove(snap.resourceType, snap.name)
+	}
+	return st.Record(*snap.previous)
+}
+
+func previousState(st *state.State, resourceType, name string) *state.ResourceState {
+	previous, exists := st.Get(resourceType, name)
+	if !exists {
+		return nil
+	}
+	return &previous
+}
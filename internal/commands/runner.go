@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+)
+
+// resourceTask is a single create, update or delete. It writes to out rather
+// than the console so its output can be kept together.
+type resourceTask struct {
+	title string
+	run   func(out console.Printer) error
+}
+
+// runner bounds how many resource tasks run at once, across every stage, and
+// collects their failures so they can be reported together at the end
+type runner struct {
+	slots    chan struct{}
+	mu       sync.Mutex
+	failures []error
+	stopped  bool
+}
+
+func newRunner(parallelism int) *runner {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	return &runner{slots: make(chan struct{}, parallelism)}
+}
+
+// runAll runs the tasks concurrently and returns once they have all finished,
+// reporting whether every task succeeded. Each task's output is printed in one
+// piece when it completes. If stopOnFailure is set, a failure stops the deploy
+// and tasks that haven't started yet are not run.
+func (r *runner) runAll(tasks []resourceTask, stopOnFailure bool) bool {
+	return r.run(tasks, stopOnFailure, false)
+}
+
+// runRollback runs rollback tasks. They run even after the deploy has been stopped.
+func (r *runner) runRollback(tasks []resourceTask) bool {
+	return r.run(tasks, false, true)
+}
+
+func (r *runner) run(tasks []resourceTask, stopOnFailure bool, ignoreStop bool) bool {
+	var wg sync.WaitGroup
+	var failed bool
+	var failedMu sync.Mutex
+
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task resourceTask) {
+			defer wg.Done()
+
+			r.slots <- struct{}{}
+			defer func() { <-r.slots }()
+
+			var err error
+			if !ignoreStop && r.isStopped() {
+				err = fmt.Errorf("not started because the deploy was stopped")
+			} else {
+				group := console.NewGroup(task.title)
+				err = task.run(group)
+				if err != nil {
+					group.Error(err.Error())
+				}
+				group.Flush()
+			}
+
+			if err != nil {
+				failedMu.Lock()
+				failed = true
+				failedMu.Unlock()
+
+				r.fail(fmt.Errorf("%s: %w", task.title, err))
+				if stopOnFailure {
+					r.stop()
+				}
+			}
+		}(task)
+	}
+
+	wg.Wait()
+	return !failed
+}
+
+func (r *runner) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, err)
+}
+
+// stop prevents any further tasks, and stages, from starting
+func (r *runner) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+}
+
+func (r *runner) isStopped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopped
+}
+
+// report prints every failure and returns an error if there were any
+func (r *runner) report() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.failures) == 0 {
+		return nil
+	}
+
+	console.Errorf("%d operation(s) failed:", len(r.failures))
+	for _, err := range r.failures {
+		console.Errorf("- %s", err.Error())
+	}
+
+	return fmt.Errorf("%d operation(s) failed", len(r.failures))
+}
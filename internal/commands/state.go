@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+func HandleStateLock(config types.LabradorConfig, env string) error {
+	backend, err := state.NewBackend(config.Project.State, config.Project.Name, env)
+	if err != nil {
+		return err
+	}
+
+	info := state.NewLockInfo("manual", config.Project.State)
+	err = backend.Lock(info)
+	if err != nil {
+		return err
+	}
+
+	console.Infof("Locked state at %s", backend.Describe())
+	console.Infof("Owner: %s, expires %s", info.Owner, info.Expires.Local().Format("2006-01-02 15:04:05"))
+	console.Infof("Release it with labrador state unlock --id %s", info.ID)
+	return nil
+}
+
+// HandleStateUnlock releases the lock with the given ID, or any lock when force is set
+func HandleStateUnlock(config types.LabradorConfig, env, id string, force bool) error {
+	backend, err := state.NewBackend(config.Project.State, config.Project.Name, env)
+	if err != nil {
+		return err
+	}
+
+	if force {
+		err = backend.ForceUnlock()
+	} else {
+		err = backend.Unlock(id)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	console.Infof("Unlocked state at %s", backend.Describe())
+	return nil
+}
@@ -0,0 +1,196 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+// StageGraph is the dependency graph built from each stage's dependsOn list
+type StageGraph struct {
+	stages       []types.Stage
+	index        map[string]int
+	dependencies [][]int
+}
+
+// NewStageGraph builds the graph, failing if a stage name is used twice or a
+// stage depends on a stage that doesn't exist
+func NewStageGraph(stages []types.Stage) (*StageGraph, error) {
+	index := make(map[string]int)
+	for i, stage := range stages {
+		if _, exists := index[stage.Name]; exists {
+			return nil, fmt.Errorf("stage name %q is used more than once", stage.Name)
+		}
+		index[stage.Name] = i
+	}
+
+	g := &StageGraph{
+		stages:       stages,
+		index:        index,
+		dependencies: make([][]int, len(stages)),
+	}
+
+	for i, stage := range stages {
+		for _, dependency := range stage.DependsOn {
+			j, exists := index[dependency]
+			if !exists {
+				return nil, fmt.Errorf("stage %q depends on unknown stage %q", stage.Name, dependency)
+			}
+			g.dependencies[i] = append(g.dependencies[i], j)
+		}
+	}
+
+	return g, nil
+}
+
+// Levels groups the stages so that every stage comes after the stages it depends on.
+// Stages in the same level don't depend on each other. Within a level stages keep
+// the order they have in the project file.
+func (g *StageGraph) Levels() ([][]types.Stage, error) {
+	remaining := make([]int, len(g.stages))
+	dependents := make([][]int, len(g.stages))
+	for i, dependencies := range g.dependencies {
+		remaining[i] = len(dependencies)
+		for _, j := range dependencies {
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	done := make([]bool, len(g.stages))
+	var levels [][]types.Stage
+	placed := 0
+
+	for placed < len(g.stages) {
+		var ready []int
+		for i := range g.stages {
+			if !done[i] && remaining[i] == 0 {
+				ready = append(ready, i)
+			}
+		}
+
+		if len(ready) == 0 {
+			return nil, fmt.Errorf("stage dependencies contain a cycle: %s", g.describeCycle(done))
+		}
+
+		var level []types.Stage
+		for _, i := range ready {
+			done[i] = true
+			level = append(level, g.stages[i])
+			for _, dependent := range dependents[i] {
+				remaining[dependent] -= 1
+			}
+		}
+
+		levels = append(levels, level)
+		placed += len(ready)
+	}
+
+	return levels, nil
+}
+
+// DependsOn reports whether a stage depends on another, directly or through
+// the stages it depends on
+func (g *StageGraph) DependsOn(stage, dependency string) bool {
+	from, exists := g.index[stage]
+	if !exists {
+		return false
+	}
+	to, exists := g.index[dependency]
+	if !exists {
+		return false
+	}
+
+	visited := make([]bool, len(g.stages))
+	pending := []int{from}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for _, j := range g.dependencies[current] {
+			if j == to {
+				return true
+			}
+			if !visited[j] {
+				visited[j] = true
+				pending = append(pending, j)
+			}
+		}
+	}
+	return false
+}
+
+// Order returns the stages in an order that satisfies every dependsOn
+func (g *StageGraph) Order() ([]types.Stage, error) {
+	levels, err := g.Levels()
+	if err != nil {
+		return nil, err
+	}
+
+	var ordered []types.Stage
+	for _, level := range levels {
+		ordered = append(ordered, level...)
+	}
+	return ordered, nil
+}
+
+// OrderStages is a shortcut for building the graph and ordering it
+func OrderStages(stages []types.Stage) ([]types.Stage, error) {
+	g, err := NewStageGraph(stages)
+	if err != nil {
+		return nil, err
+	}
+	return g.Order()
+}
+
+// ReverseOrderStages orders stages so that dependents come before their dependencies,
+// which is the order they need to be destroyed in
+func ReverseOrderStages(stages []types.Stage) ([]types.Stage, error) {
+	ordered, err := OrderStages(stages)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+		ordered[i], ordered[j] = ordered[j], ordered[i]
+	}
+	return ordered, nil
+}
+
+// describeCycle walks the unplaced stages until it comes back to one it has
+// already visited and renders that loop, e.g. "a -> b -> a"
+func (g *StageGraph) describeCycle(done []bool) string {
+	start := -1
+	for i := range g.stages {
+		if !done[i] {
+			start = i
+			break
+		}
+	}
+
+	visited := make(map[int]int)
+	var path []int
+	current := start
+	for {
+		if position, seen := visited[current]; seen {
+			path = append(path[position:], current)
+			break
+		}
+		visited[current] = len(path)
+		path = append(path, current)
+
+		// Every unplaced stage has at least one unplaced dependency
+		for _, j := range g.dependencies[current] {
+			if !done[j] {
+				current = j
+				break
+			}
+		}
+	}
+
+	names := make([]string, len(path))
+	for i, stage := range path {
+		names[i] = g.stages[stage].Name
+	}
+	return strings.Join(names, " -> ")
+}
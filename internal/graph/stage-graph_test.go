@@ -0,0 +1,184 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+func stage(name string, dependsOn ...string) types.Stage {
+	return types.Stage{Name: name, DependsOn: dependsOn}
+}
+
+func levelNames(levels [][]types.Stage) [][]string {
+	names := make([][]string, len(levels))
+	for i, level := range levels {
+		for _, s := range level {
+			names[i] = append(names[i], s.Name)
+		}
+	}
+	return names
+}
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []types.Stage
+		want   [][]string
+	}{
+		{
+			name:   "no dependencies share one level in file order",
+			stages: []types.Stage{stage("c"), stage("a"), stage("b")},
+			want:   [][]string{{"c", "a", "b"}},
+		},
+		{
+			name:   "chain",
+			stages: []types.Stage{stage("api", "lambda"), stage("lambda", "s3"), stage("s3")},
+			want:   [][]string{{"s3"}, {"lambda"}, {"api"}},
+		},
+		{
+			name:   "diamond",
+			stages: []types.Stage{stage("top"), stage("left", "top"), stage("right", "top"), stage("bottom", "left", "right")},
+			want:   [][]string{{"top"}, {"left", "right"}, {"bottom"}},
+		},
+		{
+			name:   "independent stage joins the first level",
+			stages: []types.Stage{stage("b", "a"), stage("a"), stage("other")},
+			want:   [][]string{{"a", "other"}, {"b"}},
+		},
+		{
+			name:   "empty",
+			stages: nil,
+			want:   [][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewStageGraph(tt.stages)
+			if err != nil {
+				t.Fatalf("NewStageGraph: %v", err)
+			}
+
+			levels, err := g.Levels()
+			if err != nil {
+				t.Fatalf("Levels: %v", err)
+			}
+
+			if got := levelNames(levels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("levels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevelsCycle(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []types.Stage
+		cycle  string
+	}{
+		{
+			name:   "self",
+			stages: []types.Stage{stage("a", "a")},
+			cycle:  "a -> a",
+		},
+		{
+			name:   "two stages",
+			stages: []types.Stage{stage("a", "b"), stage("b", "a")},
+			cycle:  "a -> b -> a",
+		},
+		{
+			name:   "cycle behind a placed stage",
+			stages: []types.Stage{stage("root"), stage("x", "root", "z"), stage("y", "x"), stage("z", "y")},
+			cycle:  "x -> z -> y -> x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewStageGraph(tt.stages)
+			if err != nil {
+				t.Fatalf("NewStageGraph: %v", err)
+			}
+
+			_, err = g.Levels()
+			if err == nil {
+				t.Fatal("expected a cycle error")
+			}
+			if !strings.Contains(err.Error(), tt.cycle) {
+				t.Errorf("error %q does not describe cycle %q", err, tt.cycle)
+			}
+		})
+	}
+}
+
+func TestNewStageGraphErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []types.Stage
+		want   string
+	}{
+		{
+			name:   "duplicate name",
+			stages: []types.Stage{stage("a"), stage("a")},
+			want:   `stage name "a" is used more than once`,
+		},
+		{
+			name:   "unknown dependency",
+			stages: []types.Stage{stage("a", "missing")},
+			want:   `stage "a" depends on unknown stage "missing"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewStageGraph(tt.stages)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	g, err := NewStageGraph([]types.Stage{stage("api", "lambda"), stage("lambda", "s3"), stage("s3"), stage("other")})
+	if err != nil {
+		t.Fatalf("NewStageGraph returned error: %v", err)
+	}
+
+	tests := []struct {
+		stage, dependency string
+		want              bool
+	}{
+		{"api", "lambda", true},
+		{"api", "s3", true},
+		{"lambda", "api", false},
+		{"other", "lambda", false},
+		{"api", "api", false},
+		{"api", "missing", false},
+	}
+
+	for _, tt := range tests {
+		if got := g.DependsOn(tt.stage, tt.dependency); got != tt.want {
+			t.Errorf("DependsOn(%q, %q) = %v, want %v", tt.stage, tt.dependency, got, tt.want)
+		}
+	}
+}
+
+func TestReverseOrderStages(t *testing.T) {
+	ordered, err := ReverseOrderStages([]types.Stage{stage("api", "lambda"), stage("lambda", "s3"), stage("s3")})
+	if err != nil {
+		t.Fatalf("ReverseOrderStages: %v", err)
+	}
+
+	var names []string
+	for _, s := range ordered {
+		names = append(names, s.Name)
+	}
+	if want := []string{"api", "lambda", "s3"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("order = %v, want %v", names, want)
+	}
+}
@@ -1,10 +1,14 @@
 package helpers
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
+	"slices"
+	"strings"
 
 	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/state"
 	"github.com/DQGriffin/labrador/internal/validation"
 	"github.com/DQGriffin/labrador/pkg/interpolation"
 	"github.com/DQGriffin/labrador/pkg/types"
@@ -12,10 +16,12 @@ import (
 	"github.com/joho/godotenv"
 )
 
-func RunHooks(hookType, workingDir string, commands *[]string, suppressStdout, suppressStderr, stopOnError bool) {
+// RunHooks runs a stage's hook commands. With stopOnError, the first failing
+// command ends the run and its error is returned.
+func RunHooks(hookType, workingDir string, commands *[]string, suppressStdout, suppressStderr, stopOnError bool) error {
 	totalCommands := len(*commands)
 	if totalCommands == 0 {
-		return
+		return nil
 	}
 
 	console.Headingf("[%s hooks]", hookType)
@@ -34,7 +40,7 @@ func RunHooks(hookType, workingDir string, commands *[]string, suppressStdout, s
 			cwd, err := os.Getwd()
 			if err != nil {
 				console.Errorf("hook cannot be executed. working directory could not be set. %s", err.Error())
-				return
+				return nil
 			}
 			wd = cwd
 		}
@@ -53,29 +59,146 @@ func RunHooks(hookType, workingDir string, commands *[]string, suppressStdout, s
 		err := execCmd.Run()
 		if err != nil {
 			if stopOnError {
-				console.Fatalf("%s hook %q failed: %s", hookType, command, err.Error())
-			} else {
-				console.Warnf("%s hook %q failed: %s", hookType, command, err.Error())
+				return fmt.Errorf("%s hook %q failed: %w", hookType, command, err)
 			}
+			console.Warnf("%s hook %q failed: %s", hookType, command, err.Error())
+		} else {
+			successfulCommands += 1
 		}
-		successfulCommands += 1
 		console.Info()
 	}
 
 	console.Infof("Finished running %s hooks", hookType)
 	console.Infof("%d total, %d successful, %d failed", totalCommands, successfulCommands, totalCommands-successfulCommands)
+	return nil
 }
 
 func AsPtr[T any](v T) *T {
 	return &v
 }
 
-func IsStageActionable(stage *types.Stage, stageTypesMap *map[string]bool) bool {
-	if len(*stageTypesMap) == 0 {
-		return true
+// IsStageActionable reports whether a stage runs for the selected stage types and environment
+func IsStageActionable(stage *types.Stage, stageTypesMap *map[string]bool, env string) bool {
+	return StageExclusionReason(stage, stageTypesMap, env) == ""
+}
+
+// StageExclusionReason explains why a stage won't run, or returns "" if it will.
+// A stage with no environments listed runs in every environment.
+func StageExclusionReason(stage *types.Stage, stageTypesMap *map[string]bool, env string) string {
+	if enabled, err := stage.IsEnabled(); err != nil || !enabled {
+		return "stage is disabled"
+	}
+
+	if len(*stageTypesMap) > 0 && !(*stageTypesMap)[stage.Type] {
+		return fmt.Sprintf("stage type %s was not selected", stage.Type)
+	}
+
+	if len(stage.Environments) > 0 && !slices.Contains(stage.Environments, env) {
+		return fmt.Sprintf("only runs in %s", strings.Join(stage.Environments, ", "))
+	}
+
+	return ""
+}
+
+// ApplyStageOverrides switches stages on or off by name, overriding their enabled setting
+func ApplyStageOverrides(project *types.Project, enable, disable []string) error {
+	for _, name := range enable {
+		if slices.Contains(disable, name) {
+			return fmt.Errorf("stage %q can't be both enabled and disabled", name)
+		}
+	}
+
+	overrides := make(map[string]bool)
+	for _, name := range enable {
+		overrides[name] = true
+	}
+	for _, name := range disable {
+		overrides[name] = false
+	}
+
+	for name, enabled := range overrides {
+		index := slices.IndexFunc(project.Stages, func(stage types.Stage) bool {
+			return stage.Name == name
+		})
+		if index < 0 {
+			return fmt.Errorf("stage %q does not exist", name)
+		}
+
+		project.Stages[index].Enabled = types.NewToggle(enabled)
 	}
 
-	return (*stageTypesMap)[stage.Type]
+	return nil
+}
+
+// StageResourceNames returns the names of every resource defined in a stage's config
+func StageResourceNames(stage *types.Stage) map[string]bool {
+	names := make(map[string]bool)
+
+	for _, fnConfig := range stage.Functions {
+		for _, fn := range fnConfig.Functions {
+			names[fn.Name] = true
+		}
+	}
+
+	for _, bucketConfig := range stage.Buckets {
+		for _, bucket := range bucketConfig.Buckets {
+			names[PtrOrDefault(bucket.Name, "")] = true
+		}
+	}
+
+	for _, gatewayConfig := range stage.Gateways {
+		for _, gateway := range gatewayConfig.Gateways {
+			names[PtrOrDefault(gateway.Name, "")] = true
+		}
+	}
+
+	return names
+}
+
+// OrphanedResources returns the managed resources recorded against a stage
+// that have since been removed from its config
+func OrphanedResources(stage *types.Stage, st *state.State) []state.ResourceState {
+	names := StageResourceNames(stage)
+
+	var orphans []state.ResourceState
+	for _, resource := range st.StageResources(stage.Name) {
+		if !names[resource.Name] {
+			orphans = append(orphans, resource)
+		}
+	}
+
+	return orphans
+}
+
+// RemovedResourceRetention explains why deploy leaves a resource that was
+// removed from its stage's config in place, or returns "" if it may delete it.
+// Buckets are never deleted this way, and nothing is without --prune-removed.
+func RemovedResourceRetention(stage *types.Stage, resource state.ResourceState, pruneRemoved bool) string {
+	if resource.Type == "s3" {
+		return "deploy never deletes buckets"
+	}
+
+	if resource.OnDelete == "skip" || stageDefaultOnDelete(stage) == "skip" {
+		return "onDelete is skip"
+	}
+
+	if !pruneRemoved {
+		return "deploy with --prune-removed to delete it"
+	}
+
+	return ""
+}
+
+// stageDefaultOnDelete returns the onDelete the stage's defaults give its resources.
+// Lambda defaults don't have one.
+func stageDefaultOnDelete(stage *types.Stage) string {
+	for _, gatewayConfig := range stage.Gateways {
+		if gatewayConfig.Defaults != nil && gatewayConfig.Defaults.OnDelete != nil {
+			return *gatewayConfig.Defaults.OnDelete
+		}
+	}
+
+	return ""
 }
 
 func PtrOrDefault[T any](ptr *T, fallback T) T {
@@ -111,32 +234,66 @@ func LoadEnvFile(path string) error {
 	return nil // silently skip if file not found
 }
 
-func LoadProject(filepath string) (types.LabradorConfig, error) {
+// LoadState reads the state for the project in the given environment without locking it
+func LoadState(config types.LabradorConfig, env string) (*state.State, error) {
+	backend, err := state.NewBackend(config.Project.State, config.Project.Name, env)
+	if err != nil {
+		return nil, err
+	}
+
+	console.Debugf("Reading state from %s", backend.Describe())
+	return state.Load(backend, config.Project.Name, env)
+}
+
+// LockState locks the state for the project in the given environment and reads it.
+// Callers must call Unlock on the returned state when they are done.
+func LockState(config types.LabradorConfig, env string, operation string) (*state.State, error) {
+	backend, err := state.NewBackend(config.Project.State, config.Project.Name, env)
+	if err != nil {
+		return nil, err
+	}
+
+	console.Debugf("Locking state at %s", backend.Describe())
+	return state.LockAndLoad(backend, config.Project.Name, env, state.NewLockInfo(operation, config.Project.State))
+}
+
+// LoadProject reads the project and its stage configs with the overlays for env
+// merged in. An empty env selects the environment named in the project file.
+func LoadProject(filepath, env string) (types.LabradorConfig, error) {
 	var config types.LabradorConfig
 
-	project, err := utils.ReadProjectData(filepath)
+	project, err := utils.ReadProjectData(filepath, env)
+	if err == nil && env == "" {
+		env = project.Environment
+		project, err = utils.ReadProjectData(filepath, env)
+	}
+
 	if err != nil {
-		console.Errorf("Unable to read project config from %s\n", filepath)
-		console.Fatal(err.Error())
+		return config, fmt.Errorf("unable to read project config from %s: %w", filepath, err)
 	}
+	project.Environment = env
 
-	errs := validation.ValidateProject(project)
-	if len(errs) > 0 {
-		console.Error("Errors validating project config")
-		for _, err := range errs {
-			console.Info(err)
-		}
-		os.Exit(1)
+	if errs := validation.ValidateProject(project); len(errs) > 0 {
+		return config, validationError("project", errs)
 	}
 
 	interpolation.InterpolateProjectVariables(&project)
+
+	if err := validation.ValidateStageToggles(project.Stages); err != nil {
+		return config, validationError("project", []error{err})
+	}
+
+	if err := validation.ValidateStageDependencies(project.Stages); err != nil {
+		return config, validationError("project", []error{err})
+	}
+
 	project.Variables["project_name"] = project.Name
 	project.Variables["env"] = project.Environment
 
-	functionData, readErr := utils.ReadFunctionConfigs(&project.Stages)
+	functionData, readErr := utils.ReadFunctionConfigs(&project.Stages, env)
 
 	if readErr != nil {
-		console.Fatal(readErr)
+		return config, readErr
 	}
 
 	for i := range functionData {
@@ -148,33 +305,54 @@ func LoadProject(filepath string) (types.LabradorConfig, error) {
 			interpolation.Interpolate(&functionData[i].Functions[functionIndex], project.Variables)
 		}
 
+		if errs := validation.ValidateFunctions(functionData[i]); len(errs) > 0 {
+			return config, validationError("function", errs)
+		}
+
 		config.FunctionData = append(config.FunctionData, functionData[i])
 	}
 
-	s3Configs, s3Err := utils.ReadS3Configs(&project.Stages)
+	s3Configs, s3Err := utils.ReadS3Configs(&project.Stages, env)
 
 	if s3Err != nil {
-		console.Fatal(s3Err)
+		return config, s3Err
 	}
 
 	for i := range s3Configs {
 		interpolation.Interpolate(&s3Configs[i], project.Variables)
 
+		if errs := validation.ValidateBuckets(s3Configs[i]); len(errs) > 0 {
+			return config, validationError("s3", errs)
+		}
+
 		// for functionIndex := range functionData[i] {
 		// 	project.Variables["name"] = functionData[i].Functions[functionIndex].Name
 		// 	interpolation.Interpolate(&functionData[i].Functions[functionIndex], project.Variables)
 		// }
 	}
 
-	gatewayConfigs, gatewayErr := utils.ReadApiGatewayConfigs(&project.Stages)
+	gatewayConfigs, gatewayErr := utils.ReadApiGatewayConfigs(&project.Stages, env)
 	if gatewayErr != nil {
-		console.Fatal(gatewayErr)
+		return config, gatewayErr
 	}
 
 	for i := range gatewayConfigs {
 		interpolation.Interpolate(&gatewayConfigs[i], project.Variables)
 	}
 
+	if errs := validation.ValidateRefDependencies(project.Stages); len(errs) > 0 {
+		return config, validationError("project", errs)
+	}
+
 	config.Project = project
 	return config, nil
 }
+
+// validationError prints each validation error and returns one error that sums them up
+func validationError(configType string, errs []error) error {
+	console.Errorf("Errors validating %s config", configType)
+	for _, err := range errs {
+		console.Info(err)
+	}
+	return fmt.Errorf("%d error(s) in %s config", len(errs), configType)
+}
@@ -0,0 +1,309 @@
+package packaging
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const cacheDir = ".labrador/cache"
+
+// Every entry gets the same timestamp so the same files always produce the same zip
+var fixedTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Package is a function's deployment package, ready to upload
+type Package struct {
+	Path       string
+	ZipFile    []byte
+	CodeSha256 string
+}
+
+type file struct {
+	path string
+	name string
+	mode fs.FileMode
+}
+
+// Build returns the deployment package for a function's code. code is a zip
+// file, which is used as-is, a directory, or a glob such as src/*.mjs. Files
+// are filtered by the include and exclude patterns, which match paths relative
+// to the directory (or the glob's base directory) and support **.
+func Build(code string, include, exclude []string) (*Package, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	if !hasMeta(code) {
+		info, err := os.Stat(code)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read code %s: %w", code, err)
+		}
+
+		if !info.IsDir() && strings.EqualFold(filepath.Ext(code), ".zip") {
+			data, err := os.ReadFile(code)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read zip %s: %w", code, err)
+			}
+			return &Package{Path: code, ZipFile: data, CodeSha256: codeSha256(data)}, nil
+		}
+	}
+
+	files, err := collect(code, include, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files matched %s", code)
+	}
+
+	key, err := cacheKey(files)
+	if err != nil {
+		return nil, err
+	}
+
+	cachePath := filepath.Join(cacheDir, key+".zip")
+	if data, err := os.ReadFile(cachePath); err == nil {
+		return &Package{Path: cachePath, ZipFile: data, CodeSha256: codeSha256(data)}, nil
+	}
+
+	data, err := archive(files)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeCache(cachePath, data); err != nil {
+		return nil, err
+	}
+
+	return &Package{Path: cachePath, ZipFile: data, CodeSha256: codeSha256(data)}, nil
+}
+
+// collect lists the files a package is built from, sorted by their name in the zip
+func collect(code string, include, exclude []string) ([]file, error) {
+	root := code
+	pattern := "**"
+
+	if hasMeta(code) {
+		root, pattern = splitGlob(code)
+	} else if info, err := os.Stat(code); err == nil && !info.IsDir() {
+		root, pattern = filepath.Dir(code), filepath.Base(code)
+	}
+
+	var files []file
+	err := filepath.WalkDir(root, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// The package cache lives under .labrador, so packaging the project root
+		// must not pick up earlier packages
+		if entry.IsDir() {
+			if entry.Name() == ".labrador" && current != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, current)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if !match(pattern, name) || !matchesAny(include, name, true) || matchesAny(exclude, name, false) {
+			return nil
+		}
+
+		info, err := os.Stat(current)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		files = append(files, file{path: current, name: name, mode: fileMode(info.Mode())})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read code %s: %w", code, err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+
+	return files, nil
+}
+
+// archive zips files with fixed timestamps, so identical files give an identical zip
+func archive(files []file) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+
+	for _, f := range files {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.path, err)
+		}
+
+		header := &zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: fixedTime,
+		}
+		header.SetMode(f.mode)
+
+		entry, err := writer.CreateHeader(header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to package: %w", f.name, err)
+		}
+
+		if _, err := entry.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to add %s to package: %w", f.name, err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write package: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// cacheKey hashes the name, mode, and content of every file in a package
+func cacheKey(files []file) (string, error) {
+	hash := sha256.New()
+	for _, f := range files {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", f.path, err)
+		}
+
+		content := sha256.Sum256(data)
+		fmt.Fprintf(hash, "%s\x00%o\x00%x\n", f.name, f.mode, content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func writeCache(cachePath string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(cachePath), err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(cachePath), "package-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to cache package: %w", err)
+	}
+
+	_, writeErr := temp.Write(data)
+	closeErr := temp.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("failed to cache package: %w", err)
+	}
+
+	if err := os.Rename(temp.Name(), cachePath); err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("failed to cache package: %w", err)
+	}
+
+	return nil
+}
+
+// codeSha256 returns a package's hash in the form Lambda reports it as CodeSha256
+func codeSha256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// fileMode keeps whether a file is executable and nothing else about its permissions
+func fileMode(mode fs.FileMode) fs.FileMode {
+	if mode&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// splitGlob splits a glob into the directory before its first wildcard and the
+// rest of the pattern, e.g. src/**/*.mjs -> src, **/*.mjs
+func splitGlob(glob string) (string, string) {
+	parts := strings.Split(filepath.ToSlash(glob), "/")
+	for i, part := range parts {
+		if hasMeta(part) {
+			root := strings.Join(parts[:i], "/")
+			if root == "" {
+				root = "."
+			}
+			return filepath.FromSlash(root), strings.Join(parts[i:], "/")
+		}
+	}
+	return ".", glob
+}
+
+func matchesAny(patterns []string, name string, emptyResult bool) bool {
+	if len(patterns) == 0 {
+		return emptyResult
+	}
+
+	// A pattern without a slash matches the file name in any directory, like a .gitignore entry
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		if match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether a slash-separated path matches a pattern, where **
+// matches any number of directories
+func match(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	matched, err := path.Match(pattern[0], name[0])
+	if err != nil || !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
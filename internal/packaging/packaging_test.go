@@ -0,0 +1,261 @@
+package packaging
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// project writes files under a temporary directory and makes it the working
+// directory, so the package cache stays out of the source tree
+func project(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	return dir
+}
+
+func zipNames(t *testing.T, data []byte) []string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+
+	var names []string
+	for _, f := range reader.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestBuildSelectsFiles(t *testing.T) {
+	files := map[string]string{
+		"src/index.mjs":           "export const handler = 1",
+		"src/lib/util.mjs":        "export const util = 1",
+		"src/lib/util.test.mjs":   "test",
+		"src/README.md":           "docs",
+		"src/node_modules/a/a.js": "a",
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{
+			name: "directory",
+			code: "src",
+			want: []string{"README.md", "index.mjs", "lib/util.mjs", "lib/util.test.mjs", "node_modules/a/a.js"},
+		},
+		{
+			name: "glob in the top directory",
+			code: "src/*.mjs",
+			want: []string{"index.mjs"},
+		},
+		{
+			name: "recursive glob",
+			code: "src/**/*.mjs",
+			want: []string{"index.mjs", "lib/util.mjs", "lib/util.test.mjs"},
+		},
+		{
+			name:    "exclude by file name in any directory",
+			code:    "src",
+			exclude: []string{"*.test.mjs", "*.md"},
+			want:    []string{"index.mjs", "lib/util.mjs", "node_modules/a/a.js"},
+		},
+		{
+			name:    "include and exclude by path",
+			code:    "src",
+			include: []string{"**/*.mjs", "node_modules/**"},
+			exclude: []string{"lib/*.test.mjs"},
+			want:    []string{"index.mjs", "lib/util.mjs", "node_modules/a/a.js"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project(t, files)
+
+			pkg, err := Build(tt.code, tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			if got := zipNames(t, pkg.ZipFile); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildIsDeterministic(t *testing.T) {
+	dir := project(t, map[string]string{
+		"src/b.mjs": "b",
+		"src/a.mjs": "a",
+	})
+
+	first, err := Build("src", nil, nil)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	// Touching the files and dropping the cache must still give the same bytes
+	later := time.Now().Add(time.Hour)
+	for _, name := range []string{"src/a.mjs", "src/b.mjs"} {
+		if err := os.Chtimes(filepath.Join(dir, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(dir, cacheDir)); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := Build("src", nil, nil)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if !bytes.Equal(first.ZipFile, second.ZipFile) || first.CodeSha256 != second.CodeSha256 {
+		t.Error("building the same files twice gave different packages")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "src/a.mjs"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	third, err := Build("src", nil, nil)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if third.CodeSha256 == first.CodeSha256 {
+		t.Error("changing a file did not change the package")
+	}
+}
+
+func TestBuildSkipsPackageCache(t *testing.T) {
+	project(t, map[string]string{"index.mjs": "x"})
+
+	if _, err := Build(".", nil, nil); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	pkg, err := Build(".", nil, []string{"nothing"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if got := zipNames(t, pkg.ZipFile); !reflect.DeepEqual(got, []string{"index.mjs"}) {
+		t.Errorf("files = %v, want only index.mjs", got)
+	}
+}
+
+func TestBuildUsesZipAsIs(t *testing.T) {
+	project(t, map[string]string{"function.zip": "not really a zip"})
+
+	pkg, err := Build("function.zip", nil, nil)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if string(pkg.ZipFile) != "not really a zip" || pkg.Path != "function.zip" {
+		t.Errorf("zip was not used as-is: %q from %s", pkg.ZipFile, pkg.Path)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	project(t, map[string]string{"src/index.mjs": "x"})
+
+	tests := []struct {
+		name    string
+		code    string
+		exclude []string
+	}{
+		{name: "missing code", code: "missing"},
+		{name: "nothing matched", code: "src/*.py"},
+		{name: "invalid pattern", code: "src", exclude: []string{"["}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Build(tt.code, nil, tt.exclude); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "**", name: "a/b/c.js", want: true},
+		{pattern: "*.js", name: "a.js", want: true},
+		{pattern: "*.js", name: "a/b.js", want: false},
+		{pattern: "**/*.js", name: "b.js", want: true},
+		{pattern: "**/*.js", name: "a/b/c.js", want: true},
+		{pattern: "a/**/c.js", name: "a/c.js", want: true},
+		{pattern: "a/**/c.js", name: "a/x/y/c.js", want: true},
+		{pattern: "a/**/c.js", name: "b/x/c.js", want: false},
+		{pattern: "a/**", name: "a", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("match(%q, %q) = %t, want %t", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitGlob(t *testing.T) {
+	tests := []struct {
+		glob    string
+		root    string
+		pattern string
+	}{
+		{glob: "src/*.mjs", root: "src", pattern: "*.mjs"},
+		{glob: "src/**/*.mjs", root: "src", pattern: "**/*.mjs"},
+		{glob: "*.py", root: ".", pattern: "*.py"},
+		{glob: "a/b/[xy].js", root: filepath.FromSlash("a/b"), pattern: "[xy].js"},
+	}
+
+	for _, tt := range tests {
+		root, pattern := splitGlob(tt.glob)
+		if root != tt.root || pattern != tt.pattern {
+			t.Errorf("splitGlob(%q) = %q, %q, want %q, %q", tt.glob, root, pattern, tt.root, tt.pattern)
+		}
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		want os.FileMode
+	}{
+		{mode: 0o600, want: 0o644},
+		{mode: 0o644, want: 0o644},
+		{mode: 0o700, want: 0o755},
+		{mode: 0o750, want: 0o755},
+	}
+
+	for _, tt := range tests {
+		if got := fileMode(tt.mode); got != tt.want {
+			t.Errorf("fileMode(%o) = %o, want %o", tt.mode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+func planApiGateway(stage *types.Stage, gateway types.ApiGatewaySettings, st *state.State, existingApiGateways map[string]string, refMap map[string]string) ResourcePlan {
+	resource := ResourcePlan{
+		Type:   "api",
+		Name:   helpers.PtrOrDefault(gateway.Name, ""),
+		Stage:  stage.Name,
+		Region: helpers.PtrOrDefault(gateway.Region, ""),
+	}
+
+	apiId := existingApiGateways[resource.Name]
+	if apiId == "" {
+		resource.Action = ActionCreate
+		resource.Changes = DiffApiGateway(gateway, aws.LiveApiGateway{}, refMap)
+		return resource
+	}
+
+	adopting := !st.IsManaged("api", resource.Name)
+	if adopting && !planTakeOver(&resource, stage) {
+		return resource
+	}
+
+	live, err := aws.GetApiGateway(resource.Region, apiId)
+	if err != nil {
+		resource.Action = adoptOr(adopting, ActionUpdate)
+		resource.Error = err.Error()
+		return resource
+	}
+
+	resource.Changes = DiffApiGateway(gateway, live, refMap)
+	resource.Action = adoptOr(adopting, actionFor(resource.Changes))
+	return resource
+}
+
+// DiffApiGateway compares the stages, integrations, and routes in the config
+// with the live API. Integrations are matched by the target they point at,
+// since deploy recreates them and their IDs change on every update.
+func DiffApiGateway(gateway types.ApiGatewaySettings, live aws.LiveApiGateway, refMap map[string]string) []Change {
+	var changes []Change
+
+	compare(&changes, "description", live.Description, helpers.PtrOrDefault(gateway.Description, ""))
+
+	if gateway.Stages != nil {
+		for _, stage := range *gateway.Stages {
+			if _, exists := live.Stages[stage.Name]; !exists {
+				changes = append(changes, Change{Op: ChangeAdd, Field: "stage " + stage.Name})
+			}
+		}
+	}
+
+	// Integration ref -> target the integration points at
+	configTargets := make(map[string]string)
+	wantedIntegrations := make(map[string]bool)
+	for _, integration := range gateway.Integrations {
+		target := resolveTargetForDiff(integration.Target, refMap)
+		configTargets[integration.Ref] = target
+		wantedIntegrations[target] = true
+	}
+
+	// Integration ID -> target the live integration points at
+	liveTargets := make(map[string]string)
+	liveIntegrations := make(map[string]bool)
+	for id, integration := range live.Integrations {
+		target := helpers.PtrOrDefault(integration.IntegrationUri, "")
+		liveTargets[id] = target
+		liveIntegrations[target] = true
+	}
+
+	for _, target := range sortedKeys(wantedIntegrations) {
+		if !liveIntegrations[target] {
+			changes = append(changes, Change{Op: ChangeAdd, Field: "integration " + target})
+		}
+	}
+	for _, target := range sortedKeys(liveIntegrations) {
+		if !wantedIntegrations[target] {
+			changes = append(changes, Change{Op: ChangeRemove, Field: "integration " + target})
+		}
+	}
+
+	wantedRoutes := make(map[string]string)
+	for _, route := range gateway.Routes {
+		routeKey := fmt.Sprintf("%s %s", route.Method, route.Route)
+		wantedRoutes[routeKey] = configTargets[helpers.PtrOrDefault(route.Target.Ref, "")]
+	}
+
+	liveRoutes := make(map[string]string)
+	for routeKey, route := range live.Routes {
+		integrationId := strings.TrimPrefix(helpers.PtrOrDefault(route.Target, ""), "integrations/")
+		liveRoutes[routeKey] = liveTargets[integrationId]
+	}
+
+	for _, routeKey := range sortedKeys(wantedRoutes) {
+		liveTarget, exists := liveRoutes[routeKey]
+		if !exists {
+			changes = append(changes, Change{Op: ChangeAdd, Field: "route " + routeKey})
+		} else if liveTarget != wantedRoutes[routeKey] {
+			changes = append(changes, Change{Op: ChangeUpdate, Field: "route " + routeKey, Before: liveTarget, After: wantedRoutes[routeKey]})
+		}
+	}
+	for _, routeKey := range sortedKeys(liveRoutes) {
+		if _, exists := wantedRoutes[routeKey]; !exists {
+			changes = append(changes, Change{Op: ChangeRemove, Field: "route " + routeKey})
+		}
+	}
+
+	return changes
+}
+
+func resolveTargetForDiff(target types.ResourceTarget, refMap map[string]string) string {
+	arn, err := aws.ResolveTarget(target, refMap)
+	if err != nil {
+		return "[unresolved]"
+	}
+	return arn
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,116 @@
+package plan
+
+import (
+	"time"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/state"
+)
+
+type DriftStatus string
+
+const (
+	DriftInSync  DriftStatus = "in-sync"
+	DriftChanged DriftStatus = "drifted"
+	// DriftMissing is a managed resource that no longer exists in AWS
+	DriftMissing DriftStatus = "missing"
+	DriftError   DriftStatus = "error"
+)
+
+// ResourceDrift compares a managed resource with its config. Changes go from the
+// live value (before) to the configured value (after).
+type ResourceDrift struct {
+	Type    string      `json:"type"`
+	Name    string      `json:"name"`
+	Stage   string      `json:"stage"`
+	Region  string      `json:"region"`
+	Status  DriftStatus `json:"status"`
+	Changes []Change    `json:"changes,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+type DriftReport struct {
+	Project     string          `json:"project"`
+	Environment string          `json:"environment"`
+	CheckedAt   time.Time       `json:"checkedAt"`
+	Resources   []ResourceDrift `json:"resources"`
+}
+
+// DetectDrift picks the resources Labrador manages out of a plan and reports the
+// ones whose live settings no longer match the config. Unmanaged resources and
+// resources removed from the config aren't drift, so they are left out.
+func DetectDrift(p *Plan, st *state.State) *DriftReport {
+	report := &DriftReport{
+		Project:     p.Project,
+		Environment: p.Environment,
+		CheckedAt:   time.Now().UTC(),
+		Resources:   []ResourceDrift{},
+	}
+
+	for _, resource := range p.Resources {
+		if resource.Action == ActionDelete || resource.Action == ActionRetain || !st.IsManaged(resource.Type, resource.Name) {
+			continue
+		}
+
+		drift := ResourceDrift{
+			Type:   resource.Type,
+			Name:   resource.Name,
+			Stage:  resource.Stage,
+			Region: resource.Region,
+		}
+
+		switch {
+		case resource.Error != "":
+			drift.Status = DriftError
+			drift.Error = resource.Error
+		case resource.Action == ActionCreate:
+			drift.Status = DriftMissing
+		case resource.Action == ActionUpdate:
+			drift.Status = DriftChanged
+			drift.Changes = resource.Changes
+		default:
+			drift.Status = DriftInSync
+		}
+
+		report.Resources = append(report.Resources, drift)
+	}
+
+	return report
+}
+
+func (r *DriftReport) Count(status DriftStatus) int {
+	count := 0
+	for _, resource := range r.Resources {
+		if resource.Status == status {
+			count += 1
+		}
+	}
+	return count
+}
+
+// HasDrift reports whether any managed resource was changed or deleted outside Labrador
+func (r *DriftReport) HasDrift() bool {
+	return r.Count(DriftChanged) > 0 || r.Count(DriftMissing) > 0
+}
+
+func PrintDrift(r *DriftReport) {
+	for _, resource := range r.Resources {
+		switch resource.Status {
+		case DriftChanged:
+			console.Infof("~ %s %s (%s) has drifted (live -> config)", resource.Type, resource.Name, resource.Region)
+			for _, change := range resource.Changes {
+				console.Infof("    %s", change)
+			}
+		case DriftMissing:
+			console.Infof("- %s %s (%s) was deleted outside Labrador", resource.Type, resource.Name, resource.Region)
+		case DriftError:
+			console.Errorf("could not read live configuration for %s %s: %s", resource.Type, resource.Name, resource.Error)
+		case DriftInSync:
+			console.Debugf("%s %s matches its config", resource.Type, resource.Name)
+		}
+	}
+
+	console.Info()
+	console.Infof("Drift check complete: %d drifted, %d missing, %d in sync, %d could not be checked",
+		r.Count(DriftChanged), r.Count(DriftMissing), r.Count(DriftInSync), r.Count(DriftError))
+}
@@ -0,0 +1,373 @@
+package plan
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/packaging"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/types"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+func planLambda(stage *types.Stage, fn types.LambdaConfig, st *state.State, existingLambdas map[string]lambdaTypes.FunctionConfiguration, refMap map[string]string) ResourcePlan {
+	resource := ResourcePlan{
+		Type:   "lambda",
+		Name:   fn.Name,
+		Stage:  stage.Name,
+		Region: helpers.PtrOrDefault(fn.Region, ""),
+	}
+
+	if _, exists := existingLambdas[fn.Name]; !exists {
+		resource.Action = ActionCreate
+		resource.Changes = DiffLambda(fn, lambdaTypes.FunctionConfiguration{})
+		compareAliases(&resource.Changes, fn, nil)
+		if err := diffEventSources(&resource.Changes, fn, refMap, false); err != nil {
+			resource.Error = err.Error()
+		}
+		compareSchedules(&resource.Changes, fn, nil)
+		return resource
+	}
+
+	adopting := !st.IsManaged("lambda", fn.Name)
+	if adopting && !planTakeOver(&resource, stage) {
+		return resource
+	}
+
+	ctx, cfg, err := aws.GetConfig(resource.Region)
+	if err != nil {
+		resource.Action = adoptOr(adopting, ActionUpdate)
+		resource.Error = err.Error()
+		return resource
+	}
+
+	live, err := aws.GetLambda(ctx, cfg, fn.Name)
+	if err != nil {
+		resource.Action = adoptOr(adopting, ActionUpdate)
+		resource.Error = err.Error()
+		return resource
+	}
+
+	fn.Layers, err = aws.ResolveLayers(resource.Region, fn.Layers)
+	if err != nil {
+		resource.Action = adoptOr(adopting, ActionUpdate)
+		resource.Error = err.Error()
+		return resource
+	}
+
+	resource.Changes = DiffLambda(fn, live)
+	if err := diffLambdaCode(&resource.Changes, fn, live); err != nil {
+		resource.Error = err.Error()
+	}
+
+	if err := diffReservedConcurrency(&resource.Changes, fn); err != nil {
+		resource.Error = err.Error()
+	}
+
+	if err := diffLambdaAliases(&resource.Changes, fn); err != nil {
+		resource.Error = err.Error()
+	}
+
+	if err := diffEventSources(&resource.Changes, fn, refMap, true); err != nil {
+		resource.Error = err.Error()
+	}
+
+	if err := diffSchedules(&resource.Changes, fn, helpers.PtrOrDefault(live.FunctionArn, "")); err != nil {
+		resource.Error = err.Error()
+	}
+
+	resource.Action = adoptOr(adopting, actionFor(resource.Changes))
+	return resource
+}
+
+// diffLambdaCode compares a function's package hash, or its image, and its
+// architecture with the live function
+func diffLambdaCode(changes *[]Change, fn types.LambdaConfig, live lambdaTypes.FunctionConfiguration) error {
+	if fn.Architecture != nil {
+		compare(changes, "architecture", aws.LiveArchitecture(live), *fn.Architecture)
+	}
+
+	if fn.IsImage() {
+		imageUri, err := aws.GetLambdaImageUri(*fn.Region, fn.Name)
+		if err != nil {
+			return err
+		}
+
+		compare(changes, "image", imageUri, formatPtr(fn.ImageUri))
+		return nil
+	}
+
+	if fn.Code == nil || *fn.Code == "" {
+		return nil
+	}
+
+	pkg, err := packaging.Build(*fn.Code, fn.Include, fn.Exclude)
+	if err != nil {
+		return err
+	}
+
+	compare(changes, "code", helpers.PtrOrDefault(live.CodeSha256, ""), pkg.CodeSha256)
+	return nil
+}
+
+// diffReservedConcurrency compares a function's reserved concurrency with the
+// live value. It's only managed when the function sets reservedConcurrency.
+func diffReservedConcurrency(changes *[]Change, fn types.LambdaConfig) error {
+	if fn.ReservedConcurrency == nil {
+		return nil
+	}
+
+	live, err := aws.GetReservedConcurrency(*fn.Region, fn.Name)
+	if err != nil {
+		return err
+	}
+
+	compare(changes, "reservedConcurrency", formatPtr(live), formatPtr(fn.ReservedConcurrency))
+	return nil
+}
+
+// diffLambdaAliases compares a function's aliases with the live ones. Aliases
+// that aren't in the config are left alone by deploy, so they aren't reported.
+func diffLambdaAliases(changes *[]Change, fn types.LambdaConfig) error {
+	if len(fn.Aliases) == 0 {
+		return nil
+	}
+
+	live, err := aws.ListLambdaAliases(*fn.Region, fn.Name)
+	if err != nil {
+		return err
+	}
+
+	compareAliases(changes, fn, live)
+	return nil
+}
+
+func compareAliases(changes *[]Change, fn types.LambdaConfig, live map[string]lambdaTypes.AliasConfiguration) {
+	for _, alias := range fn.Aliases {
+		field := "alias." + alias.Name
+		existing, exists := live[alias.Name]
+		if !exists {
+			compare(changes, field, "", describeAlias(alias))
+			continue
+		}
+
+		compare(changes, field+".description", formatPtr(existing.Description), formatPtr(alias.Description))
+
+		// A weighted alias that was promoted points at a single version, which
+		// isn't a change until the next version is published
+		canary, weight := aws.AliasWeight(existing)
+		if canary == "" {
+			continue
+		}
+
+		target := ""
+		if alias.RoutingConfig != nil {
+			target = aws.FormatWeight(alias.RoutingConfig.Weight)
+		}
+		compare(changes, field+".weight", aws.FormatWeight(weight), target)
+	}
+}
+
+func describeAlias(alias types.LambdaAlias) string {
+	if alias.RoutingConfig == nil {
+		return "latest version"
+	}
+	return fmt.Sprintf("latest version, %s to each new version", aws.FormatWeight(alias.RoutingConfig.Weight))
+}
+
+// diffEventSources compares a function's event sources with its live mappings.
+// Mappings are only removed when the function sets eventSources, so without
+// it nothing is reported.
+func diffEventSources(changes *[]Change, fn types.LambdaConfig, refMap map[string]string, exists bool) error {
+	if fn.EventSources == nil {
+		return nil
+	}
+
+	sources, err := aws.ResolveEventSources(fn, refMap)
+	if err != nil {
+		return err
+	}
+
+	live := make(map[string]lambdaTypes.EventSourceMappingConfiguration)
+	if exists {
+		live, err = aws.ListEventSourceMappings(*fn.Region, fn.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, source := range sources {
+		wanted[source.SourceArn] = true
+		field := "eventSource." + source.SourceArn
+
+		mapping, found := live[source.SourceArn]
+		if !found {
+			compare(changes, field, "", describeEventSource(source.Config))
+			continue
+		}
+
+		for _, change := range aws.DiffEventSource(source, mapping) {
+			compare(changes, field+"."+change.Field, change.Before, change.After)
+		}
+	}
+
+	for _, arn := range sortedKeys(live) {
+		if !wanted[arn] {
+			compare(changes, "eventSource."+arn, strings.ToLower(helpers.PtrOrDefault(live[arn].State, "mapped")), "")
+		}
+	}
+
+	return nil
+}
+
+func describeEventSource(source types.LambdaEventSource) string {
+	state := "enabled"
+	if source.Enabled != nil && !*source.Enabled {
+		state = "disabled"
+	}
+
+	if source.BatchSize == nil {
+		return state
+	}
+	return fmt.Sprintf("%s, batch size %d", state, *source.BatchSize)
+}
+
+// diffSchedules compares a function's schedules with the live rules and
+// Scheduler schedules. Like event sources, they're only managed when the
+// function sets schedules.
+func diffSchedules(changes *[]Change, fn types.LambdaConfig, functionArn string) error {
+	if fn.Schedules == nil {
+		return nil
+	}
+
+	live, err := aws.ListLambdaSchedules(*fn.Region, fn.Name, functionArn)
+	if err != nil {
+		return err
+	}
+
+	compareSchedules(changes, fn, live)
+	return nil
+}
+
+func compareSchedules(changes *[]Change, fn types.LambdaConfig, live map[string]aws.LiveSchedule) {
+	wanted := make(map[string]bool)
+	for _, schedule := range fn.Schedules {
+		name := aws.ScheduleName(fn.Name, schedule)
+		wanted[name] = true
+		field := "schedule." + schedule.Name
+
+		existing, found := live[name]
+		if !found {
+			compare(changes, field, "", schedule.Expression)
+			continue
+		}
+
+		for _, change := range aws.DiffSchedule(schedule, existing) {
+			compare(changes, field+"."+change.Field, change.Before, change.After)
+		}
+	}
+
+	for _, name := range sortedKeys(live) {
+		if !wanted[name] {
+			compare(changes, "schedule."+strings.TrimPrefix(name, fn.Name+"-"), live[name].Expression, "")
+		}
+	}
+}
+
+// DiffLambda compares the settings deploy applies to a function with its live configuration
+func DiffLambda(fn types.LambdaConfig, live lambdaTypes.FunctionConfiguration) []Change {
+	var changes []Change
+
+	compare(&changes, "description", formatPtr(live.Description), formatPtr(fn.Description))
+	compare(&changes, "handler", formatPtr(live.Handler), formatPtr(fn.Handler))
+	compare(&changes, "runtime", string(live.Runtime), formatPtr(fn.Runtime))
+	compare(&changes, "memory", formatPtr(live.MemorySize), formatPtr(fn.MemorySize))
+	compare(&changes, "timeout", formatPtr(live.Timeout), formatPtr(fn.Timeout))
+	compare(&changes, "role", formatPtr(live.Role), formatPtr(fn.RoleArn))
+
+	var liveEnvironment map[string]string
+	if live.Environment != nil {
+		liveEnvironment = live.Environment.Variables
+	}
+	compareMaps(&changes, "environment", liveEnvironment, fn.Environment, true)
+
+	var liveLayers []string
+	for _, layer := range live.Layers {
+		liveLayers = append(liveLayers, helpers.PtrOrDefault(layer.Arn, ""))
+	}
+	compare(&changes, "layers", strings.Join(liveLayers, ", "), strings.Join(fn.Layers, ", "))
+
+	liveStorage := int32(aws.DefaultEphemeralStorage)
+	if live.EphemeralStorage != nil && live.EphemeralStorage.Size != nil {
+		liveStorage = *live.EphemeralStorage.Size
+	}
+	compare(&changes, "ephemeralStorage", fmt.Sprint(liveStorage), fmt.Sprint(helpers.PtrOrDefault(fn.EphemeralStorage, aws.DefaultEphemeralStorage)))
+
+	var liveVpc lambdaTypes.VpcConfigResponse
+	if live.VpcConfig != nil {
+		liveVpc = *live.VpcConfig
+	}
+	vpc := helpers.PtrOrDefault(fn.VpcConfig, types.LambdaVpcConfig{})
+	compare(&changes, "vpcConfig.subnetIds", sortedJoin(liveVpc.SubnetIds), sortedJoin(vpc.SubnetIds))
+	compare(&changes, "vpcConfig.securityGroupIds", sortedJoin(liveVpc.SecurityGroupIds), sortedJoin(vpc.SecurityGroupIds))
+
+	liveTracing := aws.DefaultTracingMode
+	if live.TracingConfig != nil && live.TracingConfig.Mode != "" {
+		liveTracing = string(live.TracingConfig.Mode)
+	}
+	compare(&changes, "tracingConfig.mode", liveTracing, helpers.PtrOrDefault(fn.TracingConfig, types.LambdaTracingConfig{Mode: aws.DefaultTracingMode}).Mode)
+
+	var liveDeadLetter string
+	if live.DeadLetterConfig != nil {
+		liveDeadLetter = helpers.PtrOrDefault(live.DeadLetterConfig.TargetArn, "")
+	}
+	compare(&changes, "deadLetterConfig.targetArn", liveDeadLetter, helpers.PtrOrDefault(fn.DeadLetterConfig, types.LambdaDeadLetterConfig{}).TargetArn)
+
+	compare(&changes, "kmsKeyArn", formatPtr(live.KMSKeyArn), formatPtr(fn.KmsKeyArn))
+
+	// Logging is only managed when the function sets it
+	if fn.LoggingConfig != nil {
+		var liveLogging lambdaTypes.LoggingConfig
+		if live.LoggingConfig != nil {
+			liveLogging = *live.LoggingConfig
+		}
+
+		logging := fn.LoggingConfig
+		if logging.LogFormat != nil {
+			compare(&changes, "loggingConfig.logFormat", string(liveLogging.LogFormat), *logging.LogFormat)
+		}
+		if logging.LogGroup != nil {
+			compare(&changes, "loggingConfig.logGroup", formatPtr(liveLogging.LogGroup), *logging.LogGroup)
+		}
+		if logging.ApplicationLogLevel != nil {
+			compare(&changes, "loggingConfig.applicationLogLevel", string(liveLogging.ApplicationLogLevel), *logging.ApplicationLogLevel)
+		}
+		if logging.SystemLogLevel != nil {
+			compare(&changes, "loggingConfig.systemLogLevel", string(liveLogging.SystemLogLevel), *logging.SystemLogLevel)
+		}
+	}
+
+	if fn.IsImage() {
+		var liveImage lambdaTypes.ImageConfig
+		if live.ImageConfigResponse != nil && live.ImageConfigResponse.ImageConfig != nil {
+			liveImage = *live.ImageConfigResponse.ImageConfig
+		}
+
+		image := helpers.PtrOrDefault(fn.ImageConfig, types.LambdaImageConfig{})
+		compare(&changes, "imageConfig.command", strings.Join(liveImage.Command, " "), strings.Join(image.Command, " "))
+		compare(&changes, "imageConfig.entryPoint", strings.Join(liveImage.EntryPoint, " "), strings.Join(image.EntryPoint, " "))
+		compare(&changes, "imageConfig.workingDirectory", formatPtr(liveImage.WorkingDirectory), formatPtr(image.WorkingDirectory))
+	}
+
+	return changes
+}
+
+func sortedJoin(values []string) string {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return strings.Join(sorted, ", ")
+}
@@ -0,0 +1,120 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+)
+
+const planFileVersion = 1
+
+// Save writes the plan as JSON so it can be reviewed and applied later with deploy --plan
+func Save(p *Plan, path string) error {
+	p.Version = planFileVersion
+
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write plan to %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func Load(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan from %s: %w", path, err)
+	}
+
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode plan from %s: %w", path, err)
+	}
+
+	if p.Version != planFileVersion {
+		return nil, fmt.Errorf("plan file version %d is not supported", p.Version)
+	}
+
+	return &p, nil
+}
+
+// Selection returns the resources the plan will act on, keyed by type/name
+func (p *Plan) Selection() map[string]Action {
+	selection := make(map[string]Action)
+	for _, resource := range p.Resources {
+		if resource.Action == ActionCreate || resource.Action == ActionUpdate || resource.Action == ActionAdopt || resource.Action == ActionDelete {
+			selection[Key(resource.Type, resource.Name)] = resource.Action
+		}
+	}
+	return selection
+}
+
+// Compare reports every way the fresh plan differs from the saved one.
+// An empty result means the live state is the same as when the plan was made.
+func Compare(saved *Plan, fresh *Plan) []string {
+	var differences []string
+
+	if saved.Project != fresh.Project || saved.Environment != fresh.Environment {
+		differences = append(differences, fmt.Sprintf("plan is for %s (%s), not %s (%s)", saved.Project, saved.Environment, fresh.Project, fresh.Environment))
+		return differences
+	}
+
+	savedResources := indexResources(saved)
+	freshResources := indexResources(fresh)
+
+	keys := make(map[string]bool)
+	for key := range savedResources {
+		keys[key] = true
+	}
+	for key := range freshResources {
+		keys[key] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		before, inSaved := savedResources[key]
+		after, inFresh := freshResources[key]
+
+		switch {
+		case !inSaved:
+			differences = append(differences, fmt.Sprintf("%s would now %s", key, after.Action))
+		case !inFresh:
+			differences = append(differences, fmt.Sprintf("%s no longer needs to %s", key, before.Action))
+		case before.Action != after.Action:
+			differences = append(differences, fmt.Sprintf("%s was planned to %s but would now %s", key, before.Action, after.Action))
+		case !reflect.DeepEqual(before.Changes, after.Changes):
+			differences = append(differences, fmt.Sprintf("%s has changed since the plan was made", key))
+		}
+	}
+
+	return differences
+}
+
+func Key(resourceType, name string) string {
+	return resourceType + "/" + name
+}
+
+// indexResources keys the resources a plan would change. No-ops are left out
+// so that unrelated resources don't have to be identical.
+func indexResources(p *Plan) map[string]ResourcePlan {
+	resources := make(map[string]ResourcePlan)
+	for _, resource := range p.Resources {
+		if resource.Action == ActionNoop {
+			continue
+		}
+		resources[Key(resource.Type, resource.Name)] = resource
+	}
+	return resources
+}
@@ -0,0 +1,322 @@
+package plan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/graph"
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/internal/validation/constants"
+	"github.com/DQGriffin/labrador/pkg/types"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+type Action string
+
+const (
+	ActionCreate   Action = "create"
+	ActionUpdate   Action = "update"
+	ActionDelete   Action = "delete"
+	ActionNoop     Action = "no-op"
+	ActionConflict Action = "conflict"
+	// ActionAdopt takes over an existing resource that Labrador doesn't manage yet
+	ActionAdopt Action = "adopt"
+	// ActionRetain leaves a resource that was removed from the config in place
+	ActionRetain Action = "retain"
+)
+
+const (
+	ChangeAdd    = "add"
+	ChangeUpdate = "update"
+	ChangeRemove = "remove"
+)
+
+// Change is a single field level difference between the live resource and the config
+type Change struct {
+	Op     string `json:"op"`
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+type ResourcePlan struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Stage   string   `json:"stage"`
+	Region  string   `json:"region"`
+	Action  Action   `json:"action"`
+	Changes []Change `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+}
+
+// ExcludedStage is a stage the plan leaves out, and why
+type ExcludedStage struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type Plan struct {
+	Version        int             `json:"version"`
+	Project        string          `json:"project"`
+	Environment    string          `json:"environment"`
+	StageTypes     []string        `json:"stageTypes,omitempty"`
+	ExcludedStages []ExcludedStage `json:"excludedStages,omitempty"`
+	PruneRemoved   bool            `json:"pruneRemoved,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	Resources      []ResourcePlan  `json:"resources"`
+}
+
+func (c Change) String() string {
+	switch c.Op {
+	case ChangeAdd:
+		if c.After == "" {
+			return fmt.Sprintf("+ %s", c.Field)
+		}
+		return fmt.Sprintf("+ %s: %s", c.Field, c.After)
+	case ChangeRemove:
+		if c.Before == "" {
+			return fmt.Sprintf("- %s", c.Field)
+		}
+		return fmt.Sprintf("- %s: %s", c.Field, c.Before)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Field, c.Before, c.After)
+	}
+}
+
+func (p *Plan) Count(action Action) int {
+	count := 0
+	for _, resource := range p.Resources {
+		if resource.Action == action {
+			count += 1
+		}
+	}
+	return count
+}
+
+// Build compares every resource in the actionable stages with its live
+// configuration and works out what a deploy would do to it
+func Build(config types.LabradorConfig, st *state.State, stageTypesMap *map[string]bool, existingLambdas map[string]lambdaTypes.FunctionConfiguration, existingBuckets map[string]bool, existingApiGateways map[string]string, pruneRemoved bool) (*Plan, error) {
+	p := &Plan{
+		Project:      st.Project,
+		Environment:  st.Environment,
+		PruneRemoved: pruneRemoved,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	for stageType := range *stageTypesMap {
+		p.StageTypes = append(p.StageTypes, stageType)
+	}
+	sort.Strings(p.StageTypes)
+
+	// Follow the deploy order. Dependencies were validated when the project was loaded.
+	stages, err := graph.OrderStages(config.Project.Stages)
+	if err != nil {
+		stages = config.Project.Stages
+	}
+
+	refMap, err := aws.BuildRefMap(config.Project.Stages)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range stages {
+		if reason := helpers.StageExclusionReason(&stage, stageTypesMap, st.Environment); reason != "" {
+			p.ExcludedStages = append(p.ExcludedStages, ExcludedStage{Name: stage.Name, Reason: reason})
+			continue
+		}
+
+		switch stage.Type {
+		case "lambda":
+			for _, fnConfig := range stage.Functions {
+				for _, fn := range fnConfig.Functions {
+					p.Resources = append(p.Resources, planLambda(&stage, fn, st, existingLambdas, refMap))
+				}
+			}
+		case "s3":
+			for _, bucketConfig := range stage.Buckets {
+				for _, bucket := range bucketConfig.Buckets {
+					p.Resources = append(p.Resources, planBucket(&stage, bucket, st, existingBuckets, refMap))
+				}
+			}
+		case "api":
+			for _, gatewayConfig := range stage.Gateways {
+				for _, gateway := range gatewayConfig.Gateways {
+					p.Resources = append(p.Resources, planApiGateway(&stage, gateway, st, existingApiGateways, refMap))
+				}
+			}
+		}
+
+		for _, orphan := range helpers.OrphanedResources(&stage, st) {
+			resource := ResourcePlan{
+				Type:   orphan.Type,
+				Name:   orphan.Name,
+				Stage:  orphan.Stage,
+				Region: orphan.Region,
+				Action: ActionDelete,
+			}
+			if reason := helpers.RemovedResourceRetention(&stage, orphan, pruneRemoved); reason != "" {
+				resource.Action = ActionRetain
+				resource.Reason = reason
+			}
+			p.Resources = append(p.Resources, resource)
+		}
+	}
+
+	return p, nil
+}
+
+func Print(p *Plan) {
+	for _, stage := range p.ExcludedStages {
+		console.Infof("Skipping stage %s: %s", stage.Name, stage.Reason)
+	}
+	if len(p.ExcludedStages) > 0 {
+		console.Info()
+	}
+
+	for _, resource := range p.Resources {
+		switch resource.Action {
+		case ActionCreate:
+			console.Infof("+ %s %s (%s) will be created", resource.Type, resource.Name, resource.Region)
+		case ActionUpdate:
+			console.Infof("~ %s %s (%s) will be updated", resource.Type, resource.Name, resource.Region)
+			for _, change := range resource.Changes {
+				console.Infof("    %s", change)
+			}
+		case ActionDelete:
+			console.Infof("- %s %s (%s) will be destroyed", resource.Type, resource.Name, resource.Region)
+		case ActionAdopt:
+			console.Infof("~ %s %s (%s) will be taken over by Labrador", resource.Type, resource.Name, resource.Region)
+			for _, change := range resource.Changes {
+				console.Infof("    %s", change)
+			}
+		case ActionConflict:
+			console.Warnf("%s %s already exists but is not managed by Labrador (%s)", resource.Type, resource.Name, resource.Reason)
+		case ActionRetain:
+			console.Warnf("%s %s was removed from the config and will be left in place (%s)", resource.Type, resource.Name, resource.Reason)
+		case ActionNoop:
+			console.Debugf("%s %s is up to date", resource.Type, resource.Name)
+		}
+
+		if resource.Error != "" {
+			console.Errorf("could not read live configuration for %s %s: %s", resource.Type, resource.Name, resource.Error)
+		}
+	}
+
+	console.Info()
+	console.Infof("Plan complete: %d to create, %d to update, %d to take over, %d to destroy, %d unchanged, %d unmanaged",
+		p.Count(ActionCreate), p.Count(ActionUpdate), p.Count(ActionAdopt), p.Count(ActionDelete), p.Count(ActionNoop), p.Count(ActionConflict))
+}
+
+// planTakeOver handles a resource that exists but isn't managed by Labrador. It
+// returns false if the stage's onConflict leaves the resource as a conflict.
+func planTakeOver(resource *ResourcePlan, stage *types.Stage) bool {
+	if stage.OnConflict == constants.ON_CONFLICT_UPDATE {
+		return true
+	}
+
+	resource.Action = ActionConflict
+	if stage.OnConflict == constants.ON_CONFLICT_SKIP {
+		resource.Reason = "onConflict is skip, it will be left alone"
+	} else {
+		resource.Reason = "onConflict is stop, deploy will refuse to run"
+	}
+	return false
+}
+
+// adoptOr returns ActionAdopt for a resource being taken over, even if nothing
+// about it changes, since deploy still records it in the state
+func adoptOr(adopting bool, action Action) Action {
+	if adopting {
+		return ActionAdopt
+	}
+	return action
+}
+
+// actionFor turns the changes found for an existing resource into an action
+func actionFor(changes []Change) Action {
+	if len(changes) == 0 {
+		return ActionNoop
+	}
+	return ActionUpdate
+}
+
+func compare(changes *[]Change, field, before, after string) {
+	if before == after {
+		return
+	}
+
+	switch {
+	case before == "":
+		*changes = append(*changes, Change{Op: ChangeAdd, Field: field, After: after})
+	case after == "":
+		*changes = append(*changes, Change{Op: ChangeRemove, Field: field, Before: before})
+	default:
+		*changes = append(*changes, Change{Op: ChangeUpdate, Field: field, Before: before, After: after})
+	}
+}
+
+// compareMaps reports per-key differences. Values of sensitive maps, like
+// environment variables, are never written to the plan, only a digest of them.
+func compareMaps(changes *[]Change, field string, before, after map[string]string, sensitive bool) {
+	keys := make(map[string]bool)
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		beforeValue, inBefore := before[key]
+		afterValue, inAfter := after[key]
+
+		if inBefore && inAfter && beforeValue == afterValue {
+			continue
+		}
+
+		if sensitive {
+			beforeValue, afterValue = maskValue(beforeValue, inBefore), maskValue(afterValue, inAfter)
+		}
+
+		name := field + "." + key
+		switch {
+		case !inBefore:
+			*changes = append(*changes, Change{Op: ChangeAdd, Field: name, After: afterValue})
+		case !inAfter:
+			*changes = append(*changes, Change{Op: ChangeRemove, Field: name, Before: beforeValue})
+		default:
+			*changes = append(*changes, Change{Op: ChangeUpdate, Field: name, Before: beforeValue, After: afterValue})
+		}
+	}
+}
+
+// maskValue replaces a sensitive value with a short digest, so a saved plan
+// goes stale when the value changes without the value being written to it
+func maskValue(value string, present bool) string {
+	if !present {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("(sensitive %s)", hex.EncodeToString(sum[:])[:12])
+}
+
+func formatPtr[T any](ptr *T) string {
+	if ptr == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", *ptr)
+}
@@ -0,0 +1,105 @@
+package plan
+
+import (
+	"github.com/DQGriffin/labrador/internal/helpers"
+	"github.com/DQGriffin/labrador/internal/services/aws"
+	"github.com/DQGriffin/labrador/internal/state"
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+func planBucket(stage *types.Stage, bucket types.S3Settings, st *state.State, existingBuckets map[string]bool, refMap map[string]string) ResourcePlan {
+	resource := ResourcePlan{
+		Type:   "s3",
+		Name:   helpers.PtrOrDefault(bucket.Name, ""),
+		Stage:  stage.Name,
+		Region: helpers.PtrOrDefault(bucket.Region, ""),
+	}
+
+	if _, exists := existingBuckets[resource.Name]; !exists {
+		resource.Action = ActionCreate
+		resource.Changes = DiffBucket(bucket, types.S3Settings{})
+		if err := diffBucketNotifications(&resource.Changes, bucket, refMap, nil); err != nil {
+			resource.Error = err.Error()
+		}
+		return resource
+	}
+
+	adopting := !st.IsManaged("s3", resource.Name)
+	if adopting && !planTakeOver(&resource, stage) {
+		return resource
+	}
+
+	ctx, cfg, err := aws.GetConfig(resource.Region)
+	if err != nil {
+		resource.Action = adoptOr(adopting, ActionUpdate)
+		resource.Error = err.Error()
+		return resource
+	}
+
+	client := aws.GetClient(cfg)
+	live, err := aws.GetBucketSettings(ctx, *client, resource.Name, resource.Region)
+	if err != nil {
+		resource.Action = adoptOr(adopting, ActionUpdate)
+		resource.Error = err.Error()
+		return resource
+	}
+
+	resource.Changes = DiffBucket(bucket, live)
+
+	if bucket.Notifications != nil {
+		liveNotifications, err := aws.ListBucketNotifications(ctx, client, resource.Name)
+		if err == nil {
+			err = diffBucketNotifications(&resource.Changes, bucket, refMap, liveNotifications)
+		}
+		if err != nil {
+			resource.Error = err.Error()
+		}
+	}
+
+	resource.Action = adoptOr(adopting, actionFor(resource.Changes))
+	return resource
+}
+
+// DiffBucket compares the settings deploy applies to a bucket with its live settings
+func DiffBucket(bucket types.S3Settings, live types.S3Settings) []Change {
+	var changes []Change
+
+	compare(&changes, "versioning", formatPtr(live.Versioning), formatPtr(bucket.Versioning))
+	compare(&changes, "blockPublicAccess", formatPtr(live.BlockPublicAccess), formatPtr(bucket.BlockPublicAccess))
+	compareMaps(&changes, "tags", live.Tags, bucket.Tags, false)
+
+	return changes
+}
+
+// diffBucketNotifications compares a bucket's notifications with its live
+// Lambda notifications. Like event sources, they're only managed when the
+// bucket sets notifications.
+func diffBucketNotifications(changes *[]Change, bucket types.S3Settings, refMap map[string]string, live []aws.BucketNotification) error {
+	if bucket.Notifications == nil {
+		return nil
+	}
+
+	notifications, err := aws.ResolveBucketNotifications(bucket, refMap)
+	if err != nil {
+		return err
+	}
+
+	liveEvents := make(map[string]string)
+	for _, notification := range live {
+		liveEvents[notification.Key()] = notification.DescribeEvents()
+	}
+
+	wanted := make(map[string]bool)
+	for _, notification := range notifications {
+		wanted[notification.Key()] = true
+		compare(changes, "notification."+notification.Key(), liveEvents[notification.Key()], notification.DescribeEvents())
+	}
+
+	for _, key := range sortedKeys(liveEvents) {
+		if !wanted[key] {
+			compare(changes, "notification."+key, liveEvents[key], "")
+		}
+	}
+
+	return nil
+}
@@ -16,7 +16,56 @@ import (
 	gatewayTypes "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
 )
 
-func CreateApiGateway(gateway *types.ApiGatewaySettings) error {
+// LiveApiGateway is the live configuration of an HTTP API
+type LiveApiGateway struct {
+	ApiId        string
+	Description  string
+	Tags         map[string]string
+	Routes       map[string]gatewayTypes.Route
+	Integrations map[string]gatewayTypes.Integration
+	Stages       map[string]gatewayTypes.Stage
+}
+
+// GetApiGateway reads the live routes, integrations, and stages of an API
+func GetApiGateway(region string, apiId string) (LiveApiGateway, error) {
+	live := LiveApiGateway{ApiId: apiId}
+
+	ctx := context.TODO()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return live, err
+	}
+	client := apigatewayv2.NewFromConfig(cfg)
+
+	api, err := client.GetApi(ctx, &apigatewayv2.GetApiInput{
+		ApiId: aws.String(apiId),
+	})
+	if err != nil {
+		return live, fmt.Errorf("failed to get API %s: %w", apiId, err)
+	}
+	live.Description = aws.ToString(api.Description)
+	live.Tags = api.Tags
+
+	live.Routes, err = ListRoutes(&ctx, client, apiId)
+	if err != nil {
+		return live, fmt.Errorf("failed to list routes for API %s: %w", apiId, err)
+	}
+
+	live.Integrations, err = listIntegrations(&ctx, client, apiId)
+	if err != nil {
+		return live, fmt.Errorf("failed to list integrations for API %s: %w", apiId, err)
+	}
+
+	live.Stages, err = listStages(ctx, client, apiId)
+	if err != nil {
+		return live, fmt.Errorf("failed to list stages for API %s: %w", apiId, err)
+	}
+
+	return live, nil
+}
+
+// CreateApiGateway creates an API. refMap resolves integration targets that use a ref, see BuildRefMap.
+func CreateApiGateway(gateway *types.ApiGatewaySettings, refMap map[string]string, out console.Printer) (string, error) {
 	ctx := context.TODO()
 	cfg, _ := config.LoadDefaultConfig(ctx, config.WithRegion(*gateway.Region))
 	client := apigatewayv2.NewFromConfig(cfg)
@@ -28,23 +77,19 @@ func CreateApiGateway(gateway *types.ApiGatewaySettings) error {
 		Tags:         gateway.Tags,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create API: %w", err)
+		return "", fmt.Errorf("failed to create API: %w", err)
 	}
 	apiID := *apiOut.ApiId
-	console.Info("Created API: ", apiID)
+	out.Info("Created API: ", apiID)
 
-	m := make(map[string]string)
-	settingsErr := setApiGatewaySettings(gateway, &m, ctx, *client, apiID)
+	settingsErr := setApiGatewaySettings(gateway, &refMap, ctx, *client, apiID, out)
 
-	if settingsErr != nil {
-		console.Error(settingsErr.Error())
-	}
-
-	return nil
+	// The API itself exists at this point, so hand back its ID even if the settings failed
+	return apiID, settingsErr
 }
 
-func UpdateApiGateway(gateway *types.ApiGatewaySettings, apiId string) error {
-	console.Infof("Updating API Gateway %s", *gateway.Name)
+func UpdateApiGateway(gateway *types.ApiGatewaySettings, apiId string, refMap map[string]string, out console.Printer) error {
+	out.Infof("Updating API Gateway %s", *gateway.Name)
 	ctx := context.TODO()
 	cfg, _ := config.LoadDefaultConfig(ctx, config.WithRegion(*gateway.Region))
 	client := apigatewayv2.NewFromConfig(cfg)
@@ -58,52 +103,70 @@ func UpdateApiGateway(gateway *types.ApiGatewaySettings, apiId string) error {
 		return err
 	}
 
-	refMap := make(map[string]string)
-
 	existingIntegrations, intErr := listIntegrations(&ctx, client, apiId)
 	if intErr != nil {
-		console.Debug("Something went wrong listing integrations")
+		out.Debug("Something went wrong listing integrations")
 		return intErr
 	}
 
 	existingRoutes, routeErr := ListRoutes(&ctx, client, apiId)
 	if routeErr != nil {
-		console.Debug("Something went wrong listing routes")
+		out.Debug("Something went wrong listing routes")
 		return routeErr
 	}
 
-	deleteRoutes(&gateway.Routes, existingRoutes, ctx, client, apiId)
-	deleteIntegrations(&existingIntegrations, &ctx, client, apiId)
+	existingStages, stagesErr := listStages(ctx, client, apiId)
+	if stagesErr != nil {
+		out.Debug("Something went wrong listing stages")
+		return stagesErr
+	}
+
+	var missingStages []types.ApiGatewayStage
+	if gateway.Stages != nil {
+		for _, stage := range *gateway.Stages {
+			if _, exists := existingStages[stage.Name]; !exists {
+				missingStages = append(missingStages, stage)
+			}
+		}
+	}
+
+	stageErr := createStages(&missingStages, ctx, *client, apiId, out)
+	if stageErr != nil {
+		return stageErr
+	}
+
+	deleteRoutes(existingRoutes, ctx, client, apiId, out)
+	deleteIntegrations(&existingIntegrations, &ctx, client, apiId, out)
 
-	integrationRefs, err := addIntegrations(&gateway.Integrations, *gateway.Region, &refMap, ctx, *client, apiId)
+	integrationRefs, err := addIntegrations(&gateway.Integrations, *gateway.Region, &refMap, ctx, *client, apiId, out)
 
 	if err != nil {
 		return err
 	}
 
-	routesErr := addRoutes(&gateway.Routes, &integrationRefs, ctx, *client, apiId)
+	routesErr := addRoutes(&gateway.Routes, &integrationRefs, ctx, *client, apiId, out)
 	if routesErr != nil {
 		return routesErr
 	}
 
-	console.Infof("Finished updating API Gateway %s", *gateway.Name)
+	out.Infof("Finished updating API Gateway %s", *gateway.Name)
 	return nil
 }
 
-func setApiGatewaySettings(gateway *types.ApiGatewaySettings, refMap *map[string]string, ctx context.Context, client apigatewayv2.Client, apiId string) error {
-	stageErr := createStages(gateway.Stages, ctx, client, apiId)
+func setApiGatewaySettings(gateway *types.ApiGatewaySettings, refMap *map[string]string, ctx context.Context, client apigatewayv2.Client, apiId string, out console.Printer) error {
+	stageErr := createStages(gateway.Stages, ctx, client, apiId, out)
 
 	if stageErr != nil {
 		return stageErr
 	}
 
-	integrationRefs, err := addIntegrations(&gateway.Integrations, *gateway.Region, refMap, ctx, client, apiId)
+	integrationRefs, err := addIntegrations(&gateway.Integrations, *gateway.Region, refMap, ctx, client, apiId, out)
 
 	if err != nil {
 		return err
 	}
 
-	routeErr := addRoutes(&gateway.Routes, &integrationRefs, ctx, client, apiId)
+	routeErr := addRoutes(&gateway.Routes, &integrationRefs, ctx, client, apiId, out)
 	if routeErr != nil {
 		return routeErr
 	}
@@ -111,8 +174,8 @@ func setApiGatewaySettings(gateway *types.ApiGatewaySettings, refMap *map[string
 	return nil
 }
 
-func addIntegrations(integrations *[]types.ApiGatewayIntegration, region string, refMap *map[string]string, ctx context.Context, client apigatewayv2.Client, apiId string) (map[string]string, error) {
-	console.Info("Creating integrations")
+func addIntegrations(integrations *[]types.ApiGatewayIntegration, region string, refMap *map[string]string, ctx context.Context, client apigatewayv2.Client, apiId string, out console.Printer) (map[string]string, error) {
+	out.Info("Creating integrations")
 	integrationRefMap := make(map[string]string)
 
 	for _, integration := range *integrations {
@@ -144,11 +207,12 @@ func addIntegrations(integrations *[]types.ApiGatewayIntegration, region string,
 		arn := fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/*/*/*", region, accountId, apiId)
 
 		permission := &internalTypes.LambdaPermission{
-			FunctionName: integration.Target.External.Dynamic.Name,
+			FunctionName: lambdaNameFromTarget(integration.Target, targetArn),
 			Action:       "lambda:InvokeFunction",
 			Principal:    "apigateway.amazonaws.com",
 			StatementId:  fmt.Sprintf("apigateway-%s-invoke", apiId),
 			SourceArn:    arn,
+			Qualifier:    aws.ToString(integration.Target.Alias),
 		}
 
 		ctx, cfg, err := GetConfig(region)
@@ -156,24 +220,24 @@ func addIntegrations(integrations *[]types.ApiGatewayIntegration, region string,
 			return integrationRefMap, fmt.Errorf("failed to add permission to lambda: %w", err)
 		}
 
-		permErr := AddPermissionToLambda(ctx, cfg, *permission)
+		permErr := AddPermissionToLambda(ctx, cfg, *permission, out)
 		if permErr != nil {
 			if strings.Contains(permErr.Error(), "409") {
-				console.Debugf("Permission already exists for target %s", targetArn)
+				out.Debugf("Permission already exists for target %s", targetArn)
 			} else {
-				console.Error("failed to add permission to lambda: ", permErr.Error())
+				out.Error("failed to add permission to lambda: ", permErr.Error())
 			}
 		}
 
-		console.Info("Created integration: ", integrationID)
+		out.Info("Created integration: ", integrationID)
 	}
 
-	console.Info("Finished creating integrations")
+	out.Info("Finished creating integrations")
 	return integrationRefMap, nil
 }
 
-func addRoutes(routes *[]types.ApiGatewayRoute, refMap *map[string]string, ctx context.Context, client apigatewayv2.Client, apiId string) error {
-	console.Info("Creating routes")
+func addRoutes(routes *[]types.ApiGatewayRoute, refMap *map[string]string, ctx context.Context, client apigatewayv2.Client, apiId string, out console.Printer) error {
+	out.Info("Creating routes")
 	for _, route := range *routes {
 		integrationId := (*refMap)[*route.Target.Ref]
 
@@ -192,14 +256,14 @@ func addRoutes(routes *[]types.ApiGatewayRoute, refMap *map[string]string, ctx c
 			return fmt.Errorf("failed to create route: %w", err)
 		}
 
-		console.Infof("Created route %s", routeKey)
+		out.Infof("Created route %s", routeKey)
 	}
 
-	console.Info("Finished creating routes")
+	out.Info("Finished creating routes")
 	return nil
 }
 
-func createStages(stages *[]types.ApiGatewayStage, ctx context.Context, client apigatewayv2.Client, apiId string) error {
+func createStages(stages *[]types.ApiGatewayStage, ctx context.Context, client apigatewayv2.Client, apiId string, out console.Printer) error {
 	for _, stage := range *stages {
 		_, err := client.CreateStage(ctx, &apigatewayv2.CreateStageInput{
 			ApiId:       aws.String(apiId),
@@ -212,7 +276,7 @@ func createStages(stages *[]types.ApiGatewayStage, ctx context.Context, client a
 			return fmt.Errorf("failed to create stage %q: %w", stage.Name, err)
 		}
 
-		console.Infof("Created stage: %s", stage.Name)
+		out.Infof("Created stage: %s", stage.Name)
 	}
 	return nil
 }
@@ -232,30 +296,28 @@ func GetApiIDByName(ctx context.Context, client *apigatewayv2.Client, targetName
 	return "", fmt.Errorf("API with name %q not found", targetName)
 }
 
-func DestroyApiGateway(ctx context.Context, client apigatewayv2.Client, gatewayName string) error {
-	console.Infof("Deleting API Gateway: %s", gatewayName)
-	apiId, err := GetApiIDByName(ctx, &client, gatewayName)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			console.Infof("API gateway %s did not exist. No action taken", gatewayName)
-			return nil
-		}
-		return err
+// DestroyApiGateway deletes an API by the ID recorded in the state. Looking it
+// up by name could delete another API that happens to share the name.
+func DestroyApiGateway(ctx context.Context, client apigatewayv2.Client, apiId, gatewayName string, out console.Printer) error {
+	if apiId == "" {
+		return fmt.Errorf("no API ID is recorded for API gateway %s", gatewayName)
 	}
 
+	out.Infof("Deleting API Gateway: %s (%s)", gatewayName, apiId)
 	_, deleteErr := client.DeleteApi(ctx, &apigatewayv2.DeleteApiInput{
-		ApiId: &apiId,
+		ApiId: aws.String(apiId),
 	})
 
 	if deleteErr != nil {
-		if strings.Contains(deleteErr.Error(), "409") {
-			console.Infof("API gateway %s did not exist. No action taken", gatewayName)
+		var notFound *gatewayTypes.NotFoundException
+		if errors.As(deleteErr, &notFound) {
+			out.Infof("API gateway %s did not exist. No action taken", gatewayName)
 			return nil
 		}
 		return deleteErr
 	}
 
-	console.Infof("Deleted API Gateway: %s", gatewayName)
+	out.Infof("Deleted API Gateway: %s", gatewayName)
 	return nil
 }
 
@@ -370,24 +432,50 @@ func listIntegrations(ctx *context.Context, client *apigatewayv2.Client, apiId s
 	return integrations, nil
 }
 
-func deleteRoutes(routes *[]types.ApiGatewayRoute, existingRoutes map[string]gatewayTypes.Route, ctx context.Context, client *apigatewayv2.Client, apiID string) error {
-	console.Info("Deleting routes...")
-	for _, route := range *routes {
-		routeKey := fmt.Sprintf("%s %s", route.Method, route.Route)
-		console.Infof("Deleting route %s", routeKey)
-		targetRoute := existingRoutes[routeKey]
+func listStages(ctx context.Context, client *apigatewayv2.Client, apiId string) (map[string]gatewayTypes.Stage, error) {
+	var stages = make(map[string]gatewayTypes.Stage)
+
+	input := &apigatewayv2.GetStagesInput{
+		ApiId: &apiId,
+	}
+
+	for {
+		resp, err := client.GetStages(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, stage := range resp.Items {
+			stages[*stage.StageName] = stage
+		}
+
+		if resp.NextToken == nil {
+			break
+		}
+		input.NextToken = resp.NextToken
+	}
+
+	return stages, nil
+}
+
+// deleteRoutes removes every route on the API, including ones that were added
+// outside of Labrador, so the routes in the config are the only ones left
+func deleteRoutes(existingRoutes map[string]gatewayTypes.Route, ctx context.Context, client *apigatewayv2.Client, apiID string, out console.Printer) error {
+	out.Info("Deleting routes...")
+	for routeKey, route := range existingRoutes {
+		out.Infof("Deleting route %s", routeKey)
 
-		if targetRoute.RouteId == nil {
-			console.Warnf("route %s not found, skipping delete", routeKey)
+		if route.RouteId == nil {
+			out.Warnf("route %s has no ID, skipping delete", routeKey)
 			continue
 		}
 
-		err := deleteRoute(ctx, client, apiID, *targetRoute.RouteId)
+		err := deleteRoute(ctx, client, apiID, *route.RouteId)
 		if err != nil {
 			return err
 		}
 
-		console.Infof("Finished deleting route %s", routeKey)
+		out.Infof("Finished deleting route %s", routeKey)
 	}
 
 	return nil
@@ -401,15 +489,15 @@ func deleteRoute(ctx context.Context, client *apigatewayv2.Client, apiID, routeI
 	return err
 }
 
-func deleteIntegrations(existingIntegrations *map[string]gatewayTypes.Integration, ctx *context.Context, client *apigatewayv2.Client, apiID string) {
+func deleteIntegrations(existingIntegrations *map[string]gatewayTypes.Integration, ctx *context.Context, client *apigatewayv2.Client, apiID string, out console.Printer) {
 	for _, integration := range *existingIntegrations {
-		console.Infof("Deleting integration %s", *integration.IntegrationId)
+		out.Infof("Deleting integration %s", *integration.IntegrationId)
 		err := deleteIntegration(ctx, client, apiID, *integration.IntegrationId)
 		if err != nil {
-			console.Warnf("could not delete integration %s", *integration.IntegrationId)
+			out.Warnf("could not delete integration %s", *integration.IntegrationId)
 			continue
 		}
-		console.Infof("Deleted integration %s", *integration.IntegrationId)
+		out.Infof("Deleted integration %s", *integration.IntegrationId)
 	}
 }
 
@@ -0,0 +1,134 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	gatewayTypes "github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DiscoverLambdas returns the names of the functions in a region whose tags include every tag in filter
+func DiscoverLambdas(region string, filter map[string]string) ([]string, error) {
+	ctx := context.TODO()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	client := lambda.NewFromConfig(cfg)
+
+	var names []string
+	paginator := lambda.NewListFunctionsPaginator(client, &lambda.ListFunctionsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list lambdas: %w", err)
+		}
+
+		for _, fn := range page.Functions {
+			if len(filter) > 0 {
+				tags, err := client.ListTags(ctx, &lambda.ListTagsInput{Resource: fn.FunctionArn})
+				if err != nil {
+					return nil, fmt.Errorf("failed to list tags for lambda %s: %w", aws.ToString(fn.FunctionName), err)
+				}
+				if !matchesTags(tags.Tags, filter) {
+					continue
+				}
+			}
+
+			names = append(names, aws.ToString(fn.FunctionName))
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// DiscoverBuckets returns the names of the buckets in a region whose tags include every tag in filter
+func DiscoverBuckets(region string, filter map[string]string) ([]string, error) {
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return nil, err
+	}
+	client := GetClient(cfg)
+
+	var names []string
+	paginator := s3.NewListBucketsPaginator(client, &s3.ListBucketsInput{BucketRegion: aws.String(region)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list buckets: %w", err)
+		}
+
+		for _, bucket := range page.Buckets {
+			if len(filter) > 0 {
+				tagging, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: bucket.Name})
+				if err != nil && !strings.Contains(err.Error(), "NoSuchTagSet") {
+					return nil, fmt.Errorf("failed to get tags for bucket %s: %w", aws.ToString(bucket.Name), err)
+				}
+
+				tags := make(map[string]string)
+				if err == nil {
+					for _, tag := range tagging.TagSet {
+						tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+					}
+				}
+
+				if !matchesTags(tags, filter) {
+					continue
+				}
+			}
+
+			names = append(names, aws.ToString(bucket.Name))
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// DiscoverApiGateways returns the name and ID of the HTTP APIs in a region whose tags include every tag in filter
+func DiscoverApiGateways(region string, filter map[string]string) (map[string]string, error) {
+	ctx := context.TODO()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	client := apigatewayv2.NewFromConfig(cfg)
+
+	apis := make(map[string]string)
+	input := &apigatewayv2.GetApisInput{}
+	for {
+		output, err := client.GetApis(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list APIs: %w", err)
+		}
+
+		for _, api := range output.Items {
+			if api.ProtocolType != gatewayTypes.ProtocolTypeHttp || !matchesTags(api.Tags, filter) {
+				continue
+			}
+			apis[aws.ToString(api.Name)] = aws.ToString(api.ApiId)
+		}
+
+		if output.NextToken == nil {
+			return apis, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+func matchesTags(tags map[string]string, filter map[string]string) bool {
+	for key, value := range filter {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
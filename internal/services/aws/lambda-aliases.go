@@ -0,0 +1,230 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// ListLambdaAliases returns a function's aliases keyed by name
+func ListLambdaAliases(region, lambdaName string) (map[string]lambdaTypes.AliasConfiguration, error) {
+	aliases := make(map[string]lambdaTypes.AliasConfiguration)
+
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return aliases, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	paginator := lambda.NewListAliasesPaginator(lambda.NewFromConfig(cfg), &lambda.ListAliasesInput{
+		FunctionName: aws.String(lambdaName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return aliases, fmt.Errorf("failed to list aliases for lambda %s: %w", lambdaName, err)
+		}
+		for _, alias := range page.Aliases {
+			aliases[aws.ToString(alias.Name)] = alias
+		}
+	}
+
+	return aliases, nil
+}
+
+// AliasWeight returns the share of an alias's traffic routed to its additional
+// version, and that version. The version is "" when the alias isn't shifting traffic.
+func AliasWeight(alias lambdaTypes.AliasConfiguration) (string, float64) {
+	if alias.RoutingConfig == nil {
+		return "", 0
+	}
+	for version, weight := range alias.RoutingConfig.AdditionalVersionWeights {
+		return version, weight
+	}
+	return "", 0
+}
+
+// aliasesNeedUpdate reports whether any of a function's aliases is missing or no
+// longer matches its config, without regard to the version it points at
+func aliasesNeedUpdate(lambdaConfig types.LambdaConfig) (bool, error) {
+	if len(lambdaConfig.Aliases) == 0 {
+		return false, nil
+	}
+
+	live, err := ListLambdaAliases(*lambdaConfig.Region, lambdaConfig.Name)
+	if err != nil {
+		return false, err
+	}
+
+	for _, alias := range lambdaConfig.Aliases {
+		existing, exists := live[alias.Name]
+		if !exists || aws.ToString(existing.Description) != aws.ToString(alias.Description) {
+			return true, nil
+		}
+
+		// An alias that was promoted sends all its traffic to one version, which
+		// is where a weighted alias ends up, so it only differs while shifting
+		canary, weight := AliasWeight(existing)
+		if canary != "" && (alias.RoutingConfig == nil || alias.RoutingConfig.Weight != weight) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// publishVersion publishes the function's current code and configuration. If
+// neither changed since the last version, Lambda returns that version instead.
+func publishVersion(client *lambda.Client, lambdaConfig types.LambdaConfig, out console.Printer) (string, error) {
+	output, err := client.PublishVersion(context.TODO(), &lambda.PublishVersionInput{
+		FunctionName: aws.String(lambdaConfig.Name),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to publish version of lambda %s: %w", lambdaConfig.Name, err)
+	}
+
+	version := aws.ToString(output.Version)
+	out.Infof("Published version %s of lambda %q", version, lambdaConfig.Name)
+	return version, nil
+}
+
+// syncAliases points a function's aliases at version. An alias with a
+// routingConfig weight keeps its current version and sends that share of its
+// traffic to the new one, until it's promoted. Aliases that aren't in the
+// config are left alone.
+func syncAliases(client *lambda.Client, lambdaConfig types.LambdaConfig, version string, out console.Printer) error {
+	if len(lambdaConfig.Aliases) == 0 {
+		return nil
+	}
+
+	live, err := ListLambdaAliases(*lambdaConfig.Region, lambdaConfig.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, alias := range lambdaConfig.Aliases {
+		existing, exists := live[alias.Name]
+		if !exists {
+			_, err := client.CreateAlias(context.TODO(), &lambda.CreateAliasInput{
+				FunctionName:    aws.String(lambdaConfig.Name),
+				Name:            aws.String(alias.Name),
+				FunctionVersion: aws.String(version),
+				Description:     alias.Description,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create alias %s for lambda %s: %w", alias.Name, lambdaConfig.Name, err)
+			}
+			out.Infof("Created alias %q of lambda %q at version %s", alias.Name, lambdaConfig.Name, version)
+			continue
+		}
+
+		primary := version
+		weights := map[string]float64{}
+		current := aws.ToString(existing.FunctionVersion)
+		if alias.RoutingConfig != nil && current != version {
+			primary = current
+			weights[version] = alias.RoutingConfig.Weight
+		}
+
+		if primary == current && routingMatches(weights, existing) && aws.ToString(existing.Description) == aws.ToString(alias.Description) {
+			continue
+		}
+
+		_, err := client.UpdateAlias(context.TODO(), &lambda.UpdateAliasInput{
+			FunctionName:    aws.String(lambdaConfig.Name),
+			Name:            aws.String(alias.Name),
+			FunctionVersion: aws.String(primary),
+			Description:     aws.String(aws.ToString(alias.Description)),
+			RoutingConfig:   &lambdaTypes.AliasRoutingConfiguration{AdditionalVersionWeights: weights},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update alias %s for lambda %s: %w", alias.Name, lambdaConfig.Name, err)
+		}
+
+		if len(weights) > 0 {
+			out.Infof("Alias %q of lambda %q sends %s of its traffic to version %s", alias.Name, lambdaConfig.Name, FormatWeight(alias.RoutingConfig.Weight), version)
+		} else {
+			out.Infof("Moved alias %q of lambda %q to version %s", alias.Name, lambdaConfig.Name, version)
+		}
+	}
+
+	return nil
+}
+
+func routingMatches(weights map[string]float64, existing lambdaTypes.AliasConfiguration) bool {
+	canary, weight := AliasWeight(existing)
+	if canary == "" {
+		return len(weights) == 0
+	}
+	target, exists := weights[canary]
+	return exists && target == weight
+}
+
+// PromoteAlias sends all of an alias's traffic to the version it's shifting
+// traffic to, completing a weighted rollout
+func PromoteAlias(region, lambdaName, aliasName string, out console.Printer) error {
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	client := lambda.NewFromConfig(cfg)
+
+	alias, err := client.GetAlias(ctx, &lambda.GetAliasInput{
+		FunctionName: aws.String(lambdaName),
+		Name:         aws.String(aliasName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get alias %s for lambda %s: %w", aliasName, lambdaName, err)
+	}
+
+	canary, _ := AliasWeight(lambdaTypes.AliasConfiguration{RoutingConfig: alias.RoutingConfig})
+	if canary == "" {
+		out.Infof("Alias %q of lambda %q already sends all traffic to version %s", aliasName, lambdaName, aws.ToString(alias.FunctionVersion))
+		return nil
+	}
+
+	_, err = client.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		FunctionName:    aws.String(lambdaName),
+		Name:            aws.String(aliasName),
+		FunctionVersion: aws.String(canary),
+		RoutingConfig:   &lambdaTypes.AliasRoutingConfiguration{AdditionalVersionWeights: map[string]float64{}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to promote alias %s for lambda %s: %w", aliasName, lambdaName, err)
+	}
+
+	out.Infof("Alias %q of lambda %q now sends all traffic to version %s (was %s)", aliasName, lambdaName, canary, aws.ToString(alias.FunctionVersion))
+	return nil
+}
+
+// restoreAliases points aliases back at the versions and weights they had before a deploy
+func restoreAliases(client *lambda.Client, lambdaName string, previous map[string]lambdaTypes.AliasConfiguration, out console.Printer) error {
+	for name, alias := range previous {
+		weights := map[string]float64{}
+		if alias.RoutingConfig != nil && alias.RoutingConfig.AdditionalVersionWeights != nil {
+			weights = alias.RoutingConfig.AdditionalVersionWeights
+		}
+
+		_, err := client.UpdateAlias(context.TODO(), &lambda.UpdateAliasInput{
+			FunctionName:    aws.String(lambdaName),
+			Name:            aws.String(name),
+			FunctionVersion: alias.FunctionVersion,
+			Description:     aws.String(aws.ToString(alias.Description)),
+			RoutingConfig:   &lambdaTypes.AliasRoutingConfiguration{AdditionalVersionWeights: weights},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to restore alias %s for lambda %s: %w", name, lambdaName, err)
+		}
+		out.Infof("Restored alias %q of lambda %s to version %s", name, lambdaName, aws.ToString(alias.FunctionVersion))
+	}
+	return nil
+}
+
+// FormatWeight formats a routing weight as a percentage, e.g. 0.1 -> 10%
+func FormatWeight(weight float64) string {
+	return fmt.Sprintf("%.4g%%", weight*100)
+}
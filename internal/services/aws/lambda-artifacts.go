@@ -0,0 +1,136 @@
+package aws
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/packaging"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Lambda rejects packages above this size when they're sent inline
+const inlineCodeLimit = 50 * 1024 * 1024
+
+// lambdaCode returns where Lambda should take a function's code from. Image
+// functions point at their image. Otherwise the package is sent inline unless
+// the function has a codeBucket or the package is too large, in which case it
+// is uploaded to S3 first.
+func lambdaCode(lambdaConfig types.LambdaConfig, pkg *packaging.Package, out console.Printer) (*lambdaTypes.FunctionCode, error) {
+	if lambdaConfig.IsImage() {
+		return &lambdaTypes.FunctionCode{ImageUri: lambdaConfig.ImageUri}, nil
+	}
+
+	bucket := aws.ToString(lambdaConfig.CodeBucket)
+	if bucket == "" {
+		if len(pkg.ZipFile) > inlineCodeLimit {
+			return nil, fmt.Errorf("code package for %s is %d MB, which is over the %d MB limit for direct uploads. Set codeBucket to upload it through S3",
+				lambdaConfig.Name, len(pkg.ZipFile)/(1024*1024), inlineCodeLimit/(1024*1024))
+		}
+		return &lambdaTypes.FunctionCode{ZipFile: pkg.ZipFile}, nil
+	}
+
+	key, err := artifactKey(lambdaConfig, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cfg, err := GetConfig(*lambdaConfig.Region)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	out.Infof("Uploading code for lambda %q to s3://%s/%s", lambdaConfig.Name, bucket, key)
+	version, err := PutObject(ctx, GetClient(cfg), bucket, key, pkg.ZipFile, map[string]string{"code-sha256": pkg.CodeSha256})
+	if err != nil {
+		return nil, err
+	}
+
+	code := &lambdaTypes.FunctionCode{
+		S3Bucket: aws.String(bucket),
+		S3Key:    aws.String(key),
+	}
+	if version != "" {
+		code.S3ObjectVersion = aws.String(version)
+	}
+
+	return code, nil
+}
+
+// artifactPrefix is the folder a function's packages are uploaded to, e.g. <codeKeyPrefix>/<function name>/
+func artifactPrefix(lambdaConfig types.LambdaConfig) string {
+	prefix := aws.ToString(lambdaConfig.CodeKeyPrefix)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix + lambdaConfig.Name + "/"
+}
+
+// artifactKey names a package by its hash, so the same code is always uploaded to the same key
+func artifactKey(lambdaConfig types.LambdaConfig, pkg *packaging.Package) (string, error) {
+	sum, err := base64.StdEncoding.DecodeString(pkg.CodeSha256)
+	if err != nil {
+		return "", fmt.Errorf("invalid code hash for %s: %w", lambdaConfig.Name, err)
+	}
+	return artifactPrefix(lambdaConfig) + hex.EncodeToString(sum) + ".zip", nil
+}
+
+// pruneArtifacts deletes a function's oldest packages from its codeBucket,
+// keeping the newest codeRetention of them and the one just deployed. A failure
+// is only reported, since the deploy itself has already succeeded.
+func pruneArtifacts(lambdaConfig types.LambdaConfig, code *lambdaTypes.FunctionCode, out console.Printer) {
+	if code.S3Bucket == nil || lambdaConfig.CodeRetention == nil {
+		return
+	}
+
+	bucket := aws.ToString(code.S3Bucket)
+	current := aws.ToString(code.S3Key)
+	keep := int(*lambdaConfig.CodeRetention)
+
+	ctx, cfg, err := GetConfig(*lambdaConfig.Region)
+	if err != nil {
+		out.Warnf("Failed to clean up old code for lambda %s: %s", lambdaConfig.Name, err.Error())
+		return
+	}
+	client := GetClient(cfg)
+
+	var objects []s3Types.Object
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(artifactPrefix(lambdaConfig)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			out.Warnf("Failed to clean up old code for lambda %s: %s", lambdaConfig.Name, err.Error())
+			return
+		}
+		objects = append(objects, page.Contents...)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return aws.ToTime(objects[i].LastModified).After(aws.ToTime(objects[j].LastModified))
+	})
+
+	kept := 0
+	for _, object := range objects {
+		key := aws.ToString(object.Key)
+		if key == current || kept < keep {
+			kept++
+			continue
+		}
+
+		if err := DeleteObject(ctx, client, bucket, key); err != nil {
+			out.Warnf("Failed to clean up old code for lambda %s: %s", lambdaConfig.Name, err.Error())
+			continue
+		}
+		out.Debugf("Deleted old code s3://%s/%s", bucket, key)
+	}
+}
@@ -0,0 +1,355 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// EventSource is an event source from the config with its source resolved to an ARN
+type EventSource struct {
+	SourceArn string
+	Config    types.LambdaEventSource
+}
+
+// ResolveEventSources resolves the source of each of a function's event sources to an ARN
+func ResolveEventSources(lambdaConfig types.LambdaConfig, refMap map[string]string) ([]EventSource, error) {
+	sources := make([]EventSource, 0, len(lambdaConfig.EventSources))
+	seen := make(map[string]bool)
+	for _, source := range lambdaConfig.EventSources {
+		arn := aws.ToString(source.SourceArn)
+		if arn == "" && source.Source != nil {
+			if aws.ToString(source.Source.Ref) != "" {
+				return nil, fmt.Errorf("an event source for lambda %s is a ref, which points at a function rather than a queue or stream", lambdaConfig.Name)
+			}
+
+			resolved, err := ResolveTarget(*source.Source, refMap)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve event source for lambda %s: %w", lambdaConfig.Name, err)
+			}
+			arn = resolved
+		}
+
+		if arn == "" {
+			return nil, fmt.Errorf("an event source for lambda %s has no sourceArn or source", lambdaConfig.Name)
+		}
+		if seen[arn] {
+			return nil, fmt.Errorf("lambda %s lists event source %s more than once", lambdaConfig.Name, arn)
+		}
+		seen[arn] = true
+
+		sources = append(sources, EventSource{SourceArn: arn, Config: source})
+	}
+
+	return sources, nil
+}
+
+// ListEventSourceMappings returns the event source mappings that invoke a function, keyed by source ARN
+func ListEventSourceMappings(region, lambdaName string) (map[string]lambdaTypes.EventSourceMappingConfiguration, error) {
+	mappings := make(map[string]lambdaTypes.EventSourceMappingConfiguration)
+
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return mappings, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	paginator := lambda.NewListEventSourceMappingsPaginator(lambda.NewFromConfig(cfg), &lambda.ListEventSourceMappingsInput{
+		FunctionName: aws.String(lambdaName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return mappings, fmt.Errorf("failed to list event sources for lambda %s: %w", lambdaName, err)
+		}
+		for _, mapping := range page.EventSourceMappings {
+			mappings[aws.ToString(mapping.EventSourceArn)] = mapping
+		}
+	}
+
+	return mappings, nil
+}
+
+// SyncEventSources creates, updates and deletes a function's event source
+// mappings to match its config. Functions without eventSources are left alone,
+// so mappings wired up outside Labrador survive; an empty list removes them all.
+func SyncEventSources(lambdaConfig types.LambdaConfig, refMap map[string]string, out console.Printer) error {
+	if lambdaConfig.EventSources == nil {
+		return nil
+	}
+
+	sources, err := ResolveEventSources(lambdaConfig, refMap)
+	if err != nil {
+		return err
+	}
+
+	live, err := ListEventSourceMappings(*lambdaConfig.Region, lambdaConfig.Name)
+	if err != nil {
+		return err
+	}
+
+	ctx, cfg, err := GetConfig(*lambdaConfig.Region)
+	if err != nil {
+		return fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	client := lambda.NewFromConfig(cfg)
+
+	wanted := make(map[string]bool)
+	for _, source := range sources {
+		wanted[source.SourceArn] = true
+
+		mapping, exists := live[source.SourceArn]
+		if !exists {
+			if err := createEventSourceMapping(ctx, client, lambdaConfig.Name, source, out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(DiffEventSource(source, mapping)) == 0 {
+			out.Debugf("Event source %s for lambda %s is unchanged", source.SourceArn, lambdaConfig.Name)
+			continue
+		}
+
+		input := &lambda.UpdateEventSourceMappingInput{
+			UUID:                           mapping.UUID,
+			BatchSize:                      batchSize(source.Config),
+			MaximumBatchingWindowInSeconds: batchingWindow(source.Config),
+			Enabled:                        aws.Bool(eventSourceEnabled(source.Config)),
+			FilterCriteria:                 filterCriteria(source.Config),
+		}
+		if !isQueue(source.SourceArn) {
+			input.DestinationConfig = failureDestination(source.Config)
+		}
+
+		if _, err := client.UpdateEventSourceMapping(ctx, input); err != nil {
+			return fmt.Errorf("failed to update event source %s for lambda %s: %w", source.SourceArn, lambdaConfig.Name, err)
+		}
+		out.Infof("Updated event source %s for lambda %q", source.SourceArn, lambdaConfig.Name)
+	}
+
+	for arn, mapping := range live {
+		if wanted[arn] {
+			continue
+		}
+
+		if err := deleteEventSourceMapping(ctx, client, lambdaConfig.Name, mapping, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createEventSourceMapping(ctx context.Context, client *lambda.Client, lambdaName string, source EventSource, out console.Printer) error {
+	input := &lambda.CreateEventSourceMappingInput{
+		FunctionName:                   aws.String(lambdaName),
+		EventSourceArn:                 aws.String(source.SourceArn),
+		BatchSize:                      batchSize(source.Config),
+		MaximumBatchingWindowInSeconds: batchingWindow(source.Config),
+		Enabled:                        aws.Bool(eventSourceEnabled(source.Config)),
+		FilterCriteria:                 filterCriteria(source.Config),
+	}
+
+	// Queues don't have a position or failure destination, their redrive policy handles failures
+	if !isQueue(source.SourceArn) {
+		input.StartingPosition = lambdaTypes.EventSourcePositionLatest
+		if source.Config.StartingPosition != nil {
+			input.StartingPosition = lambdaTypes.EventSourcePosition(*source.Config.StartingPosition)
+		}
+		if source.Config.FailureDestination != nil {
+			input.DestinationConfig = failureDestination(source.Config)
+		}
+	}
+
+	if _, err := client.CreateEventSourceMapping(ctx, input); err != nil {
+		return fmt.Errorf("failed to create event source %s for lambda %s: %w", source.SourceArn, lambdaName, err)
+	}
+
+	out.Infof("Created event source %s for lambda %q", source.SourceArn, lambdaName)
+	return nil
+}
+
+func deleteEventSourceMapping(ctx context.Context, client *lambda.Client, lambdaName string, mapping lambdaTypes.EventSourceMappingConfiguration, out console.Printer) error {
+	_, err := client.DeleteEventSourceMapping(ctx, &lambda.DeleteEventSourceMappingInput{
+		UUID: mapping.UUID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete event source %s for lambda %s: %w", aws.ToString(mapping.EventSourceArn), lambdaName, err)
+	}
+
+	out.Infof("Deleted event source %s for lambda %q", aws.ToString(mapping.EventSourceArn), lambdaName)
+	return nil
+}
+
+// deleteEventSourceMappings removes every mapping that invokes a function.
+// Deleting a function leaves its mappings behind, so this runs first.
+func deleteEventSourceMappings(ctx context.Context, client *lambda.Client, lambdaName string, out console.Printer) error {
+	paginator := lambda.NewListEventSourceMappingsPaginator(client, &lambda.ListEventSourceMappingsInput{
+		FunctionName: aws.String(lambdaName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list event sources for lambda %s: %w", lambdaName, err)
+		}
+
+		for _, mapping := range page.EventSourceMappings {
+			if err := deleteEventSourceMapping(ctx, client, lambdaName, mapping, out); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SettingChange is a setting that differs from the live resource
+type SettingChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// DiffEventSource compares the settings Labrador manages on an event source
+// with its live mapping. Batch size and batching window are only compared when set.
+func DiffEventSource(source EventSource, mapping lambdaTypes.EventSourceMappingConfiguration) []SettingChange {
+	var changes []SettingChange
+	add := func(field, before, after string) {
+		if before != after {
+			changes = append(changes, SettingChange{Field: field, Before: before, After: after})
+		}
+	}
+
+	if source.Config.BatchSize != nil {
+		add("batchSize", fmt.Sprint(aws.ToInt32(mapping.BatchSize)), fmt.Sprint(*source.Config.BatchSize))
+	}
+	if source.Config.BatchingWindow != nil {
+		add("batchingWindow", fmt.Sprint(aws.ToInt32(mapping.MaximumBatchingWindowInSeconds)), fmt.Sprint(*source.Config.BatchingWindow))
+	}
+
+	add("enabled", fmt.Sprint(mappingEnabled(mapping)), fmt.Sprint(eventSourceEnabled(source.Config)))
+
+	var livePatterns []string
+	if mapping.FilterCriteria != nil {
+		for _, filter := range mapping.FilterCriteria.Filters {
+			livePatterns = append(livePatterns, normalizeJSON([]byte(aws.ToString(filter.Pattern))))
+		}
+	}
+	add("filterCriteria", joinPatterns(livePatterns), joinPatterns(patterns(source.Config)))
+
+	if !isQueue(source.SourceArn) {
+		liveDestination := ""
+		if mapping.DestinationConfig != nil && mapping.DestinationConfig.OnFailure != nil {
+			liveDestination = aws.ToString(mapping.DestinationConfig.OnFailure.Destination)
+		}
+		add("failureDestination", liveDestination, aws.ToString(source.Config.FailureDestination))
+	}
+
+	return changes
+}
+
+// eventSourceFromMapping turns a live mapping back into the config that
+// creates it, so a snapshot of the mappings can be synced like a config
+func eventSourceFromMapping(mapping lambdaTypes.EventSourceMappingConfiguration) types.LambdaEventSource {
+	source := types.LambdaEventSource{
+		SourceArn: mapping.EventSourceArn,
+		Enabled:   aws.Bool(mappingEnabled(mapping)),
+	}
+	if mapping.BatchSize != nil {
+		source.BatchSize = aws.Uint16(uint16(*mapping.BatchSize))
+	}
+	if mapping.MaximumBatchingWindowInSeconds != nil {
+		source.BatchingWindow = aws.Uint16(uint16(*mapping.MaximumBatchingWindowInSeconds))
+	}
+	if mapping.StartingPosition != "" {
+		source.StartingPosition = aws.String(string(mapping.StartingPosition))
+	}
+	if mapping.FilterCriteria != nil {
+		for _, filter := range mapping.FilterCriteria.Filters {
+			source.FilterCriteria = append(source.FilterCriteria, json.RawMessage(aws.ToString(filter.Pattern)))
+		}
+	}
+	if mapping.DestinationConfig != nil && mapping.DestinationConfig.OnFailure != nil && aws.ToString(mapping.DestinationConfig.OnFailure.Destination) != "" {
+		source.FailureDestination = mapping.DestinationConfig.OnFailure.Destination
+	}
+
+	return source
+}
+
+func mappingEnabled(mapping lambdaTypes.EventSourceMappingConfiguration) bool {
+	return aws.ToString(mapping.State) != "Disabled" && aws.ToString(mapping.State) != "Disabling"
+}
+
+func isQueue(arn string) bool {
+	return strings.HasPrefix(arn, "arn:aws:sqs:")
+}
+
+func eventSourceEnabled(source types.LambdaEventSource) bool {
+	return source.Enabled == nil || *source.Enabled
+}
+
+func batchSize(source types.LambdaEventSource) *int32 {
+	if source.BatchSize == nil {
+		return nil
+	}
+	return aws.Int32(int32(*source.BatchSize))
+}
+
+func batchingWindow(source types.LambdaEventSource) *int32 {
+	if source.BatchingWindow == nil {
+		return nil
+	}
+	return aws.Int32(int32(*source.BatchingWindow))
+}
+
+// filterCriteria is always sent, so removing filters from the config removes them from the mapping
+func filterCriteria(source types.LambdaEventSource) *lambdaTypes.FilterCriteria {
+	criteria := &lambdaTypes.FilterCriteria{Filters: []lambdaTypes.Filter{}}
+	for _, pattern := range patterns(source) {
+		criteria.Filters = append(criteria.Filters, lambdaTypes.Filter{Pattern: aws.String(pattern)})
+	}
+	return criteria
+}
+
+func failureDestination(source types.LambdaEventSource) *lambdaTypes.DestinationConfig {
+	return &lambdaTypes.DestinationConfig{
+		OnFailure: &lambdaTypes.OnFailure{Destination: aws.String(aws.ToString(source.FailureDestination))},
+	}
+}
+
+func patterns(source types.LambdaEventSource) []string {
+	var result []string
+	for _, pattern := range source.FilterCriteria {
+		result = append(result, normalizeJSON(pattern))
+	}
+	return result
+}
+
+// normalizeJSON compacts a JSON document, such as a filter pattern, and sorts
+// its keys, so documents compare equal however they were written
+func normalizeJSON(pattern []byte) string {
+	var value any
+	if err := json.Unmarshal(pattern, &value); err != nil {
+		return string(pattern)
+	}
+
+	normalized, err := json.Marshal(value)
+	if err != nil {
+		return string(pattern)
+	}
+	return string(normalized)
+}
+
+func joinPatterns(patterns []string) string {
+	sorted := append([]string{}, patterns...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
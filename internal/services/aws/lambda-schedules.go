@@ -0,0 +1,414 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	internalTypes "github.com/DQGriffin/labrador/internal/types"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgeTypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	schedulerTypes "github.com/aws/aws-sdk-go-v2/service/scheduler/types"
+)
+
+// The ID of the target Labrador adds to a schedule's rule
+const scheduleTargetId = "labrador"
+
+// LiveSchedule is a function's schedule as it's configured in EventBridge
+type LiveSchedule struct {
+	Expression string
+	Timezone   string
+	Input      string
+	Enabled    bool
+	// Scheduler is set for EventBridge Scheduler schedules, and unset for rules
+	Scheduler bool
+	RoleArn   string
+}
+
+// ScheduleName is the name of the rule or schedule for one of a function's
+// schedules. Prefixing it with the function name keeps it unique in the account.
+func ScheduleName(lambdaName string, schedule types.LambdaSchedule) string {
+	return lambdaName + "-" + schedule.Name
+}
+
+// ListLambdaSchedules returns the rules and Scheduler schedules that invoke a
+// function, keyed by name. Only the ones named after the function are
+// included, so schedules created outside Labrador are left out.
+func ListLambdaSchedules(region, lambdaName, functionArn string) (map[string]LiveSchedule, error) {
+	schedules := make(map[string]LiveSchedule)
+
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return schedules, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	events := eventbridge.NewFromConfig(cfg)
+	rules, err := listScheduleRules(ctx, events, lambdaName, functionArn)
+	if err != nil {
+		return schedules, err
+	}
+
+	for _, name := range rules {
+		rule, err := events.DescribeRule(ctx, &eventbridge.DescribeRuleInput{Name: aws.String(name)})
+		if err != nil {
+			return schedules, fmt.Errorf("failed to get rule %s: %w", name, err)
+		}
+
+		targets, err := events.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{Rule: aws.String(name)})
+		if err != nil {
+			return schedules, fmt.Errorf("failed to get targets of rule %s: %w", name, err)
+		}
+
+		live := LiveSchedule{
+			Expression: aws.ToString(rule.ScheduleExpression),
+			Enabled:    rule.State == eventbridgeTypes.RuleStateEnabled,
+		}
+		for _, target := range targets.Targets {
+			if aws.ToString(target.Arn) == functionArn {
+				live.Input = aws.ToString(target.Input)
+			}
+		}
+		schedules[name] = live
+	}
+
+	client := scheduler.NewFromConfig(cfg)
+	paginator := scheduler.NewListSchedulesPaginator(client, &scheduler.ListSchedulesInput{
+		NamePrefix: aws.String(lambdaName + "-"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return schedules, fmt.Errorf("failed to list schedules for lambda %s: %w", lambdaName, err)
+		}
+
+		for _, summary := range page.Schedules {
+			if summary.Target == nil || aws.ToString(summary.Target.Arn) != functionArn {
+				continue
+			}
+
+			schedule, err := client.GetSchedule(ctx, &scheduler.GetScheduleInput{Name: summary.Name})
+			if err != nil {
+				return schedules, fmt.Errorf("failed to get schedule %s: %w", aws.ToString(summary.Name), err)
+			}
+
+			live := LiveSchedule{
+				Expression: aws.ToString(schedule.ScheduleExpression),
+				Timezone:   aws.ToString(schedule.ScheduleExpressionTimezone),
+				Enabled:    schedule.State == schedulerTypes.ScheduleStateEnabled,
+				Scheduler:  true,
+			}
+			if schedule.Target != nil {
+				live.Input = aws.ToString(schedule.Target.Input)
+				live.RoleArn = aws.ToString(schedule.Target.RoleArn)
+			}
+			schedules[aws.ToString(summary.Name)] = live
+		}
+	}
+
+	return schedules, nil
+}
+
+// SyncSchedules creates, updates and deletes a function's schedules to match
+// its config. Functions without schedules are left alone; an empty list
+// removes every schedule Labrador created for the function.
+func SyncSchedules(lambdaConfig types.LambdaConfig, functionArn string, out console.Printer) error {
+	if lambdaConfig.Schedules == nil {
+		return nil
+	}
+
+	live, err := ListLambdaSchedules(*lambdaConfig.Region, lambdaConfig.Name, functionArn)
+	if err != nil {
+		return err
+	}
+
+	ctx, cfg, err := GetConfig(*lambdaConfig.Region)
+	if err != nil {
+		return fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	wanted := make(map[string]bool)
+	for _, schedule := range lambdaConfig.Schedules {
+		name := ScheduleName(lambdaConfig.Name, schedule)
+		wanted[name] = true
+
+		existing, exists := live[name]
+		if exists && len(DiffSchedule(schedule, existing)) == 0 {
+			out.Debugf("Schedule %s for lambda %s is unchanged", name, lambdaConfig.Name)
+			continue
+		}
+
+		// A schedule that gains or loses a timezone moves between rules and Scheduler
+		if exists && existing.Scheduler != usesScheduler(schedule) {
+			if err := deleteSchedule(ctx, cfg, lambdaConfig.Name, name, existing, out); err != nil {
+				return err
+			}
+			exists = false
+		}
+
+		if usesScheduler(schedule) {
+			err = putSchedulerSchedule(ctx, scheduler.NewFromConfig(cfg), name, schedule, functionArn, exists)
+		} else {
+			err = putScheduleRule(ctx, cfg, lambdaConfig.Name, name, schedule, functionArn, out)
+		}
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			out.Infof("Updated schedule %s for lambda %q", name, lambdaConfig.Name)
+		} else {
+			out.Infof("Created schedule %s for lambda %q", name, lambdaConfig.Name)
+		}
+	}
+
+	for name, existing := range live {
+		if wanted[name] {
+			continue
+		}
+
+		if err := deleteSchedule(ctx, cfg, lambdaConfig.Name, name, existing, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DiffSchedule compares a schedule from the config with the live one
+func DiffSchedule(schedule types.LambdaSchedule, live LiveSchedule) []SettingChange {
+	var changes []SettingChange
+	add := func(field, before, after string) {
+		if before != after {
+			changes = append(changes, SettingChange{Field: field, Before: before, After: after})
+		}
+	}
+
+	add("expression", live.Expression, schedule.Expression)
+	add("timezone", live.Timezone, aws.ToString(schedule.Timezone))
+	add("input", normalizeJSON([]byte(live.Input)), scheduleInput(schedule))
+	add("enabled", fmt.Sprint(live.Enabled), fmt.Sprint(scheduleEnabled(schedule)))
+
+	return changes
+}
+
+// putScheduleRule creates or updates a schedule's rule and target, and lets
+// the rule invoke the function
+func putScheduleRule(ctx context.Context, cfg aws.Config, lambdaName, name string, schedule types.LambdaSchedule, functionArn string, out console.Printer) error {
+	client := eventbridge.NewFromConfig(cfg)
+
+	state := eventbridgeTypes.RuleStateEnabled
+	if !scheduleEnabled(schedule) {
+		state = eventbridgeTypes.RuleStateDisabled
+	}
+
+	rule, err := client.PutRule(ctx, &eventbridge.PutRuleInput{
+		Name:               aws.String(name),
+		ScheduleExpression: aws.String(schedule.Expression),
+		State:              state,
+		Description:        aws.String(fmt.Sprintf("Invokes %s. Managed by Labrador", lambdaName)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put rule %s: %w", name, err)
+	}
+
+	target := eventbridgeTypes.Target{
+		Id:  aws.String(scheduleTargetId),
+		Arn: aws.String(functionArn),
+	}
+	if input := scheduleInput(schedule); input != "" {
+		target.Input = aws.String(input)
+	}
+
+	output, err := client.PutTargets(ctx, &eventbridge.PutTargetsInput{
+		Rule:    aws.String(name),
+		Targets: []eventbridgeTypes.Target{target},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add lambda %s as the target of rule %s: %w", lambdaName, name, err)
+	}
+	if output.FailedEntryCount > 0 {
+		return fmt.Errorf("failed to add lambda %s as the target of rule %s: %s", lambdaName, name, aws.ToString(output.FailedEntries[0].ErrorMessage))
+	}
+
+	permission := internalTypes.LambdaPermission{
+		FunctionName: lambdaName,
+		Action:       "lambda:InvokeFunction",
+		Principal:    "events.amazonaws.com",
+		StatementId:  schedulePermissionId(name),
+		SourceArn:    aws.ToString(rule.RuleArn),
+	}
+
+	permErr := AddPermissionToLambda(ctx, cfg, permission, out)
+	if permErr != nil {
+		if strings.Contains(permErr.Error(), "409") {
+			out.Debugf("Permission already exists for rule %s", name)
+		} else {
+			return permErr
+		}
+	}
+
+	return nil
+}
+
+func putSchedulerSchedule(ctx context.Context, client *scheduler.Client, name string, schedule types.LambdaSchedule, functionArn string, exists bool) error {
+	state := schedulerTypes.ScheduleStateEnabled
+	if !scheduleEnabled(schedule) {
+		state = schedulerTypes.ScheduleStateDisabled
+	}
+
+	target := &schedulerTypes.Target{
+		Arn:     aws.String(functionArn),
+		RoleArn: schedule.RoleArn,
+	}
+	if input := scheduleInput(schedule); input != "" {
+		target.Input = aws.String(input)
+	}
+
+	window := &schedulerTypes.FlexibleTimeWindow{Mode: schedulerTypes.FlexibleTimeWindowModeOff}
+
+	var err error
+	if exists {
+		_, err = client.UpdateSchedule(ctx, &scheduler.UpdateScheduleInput{
+			Name:                       aws.String(name),
+			ScheduleExpression:         aws.String(schedule.Expression),
+			ScheduleExpressionTimezone: schedule.Timezone,
+			State:                      state,
+			FlexibleTimeWindow:         window,
+			Target:                     target,
+		})
+	} else {
+		_, err = client.CreateSchedule(ctx, &scheduler.CreateScheduleInput{
+			Name:                       aws.String(name),
+			ScheduleExpression:         aws.String(schedule.Expression),
+			ScheduleExpressionTimezone: schedule.Timezone,
+			State:                      state,
+			FlexibleTimeWindow:         window,
+			Target:                     target,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put schedule %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// deleteSchedule removes a rule along with its target and permission, or a Scheduler schedule
+func deleteSchedule(ctx context.Context, cfg aws.Config, lambdaName, name string, live LiveSchedule, out console.Printer) error {
+	if live.Scheduler {
+		_, err := scheduler.NewFromConfig(cfg).DeleteSchedule(ctx, &scheduler.DeleteScheduleInput{Name: aws.String(name)})
+		if err != nil {
+			return fmt.Errorf("failed to delete schedule %s: %w", name, err)
+		}
+		out.Infof("Deleted schedule %s for lambda %q", name, lambdaName)
+		return nil
+	}
+
+	client := eventbridge.NewFromConfig(cfg)
+	_, err := client.RemoveTargets(ctx, &eventbridge.RemoveTargetsInput{
+		Rule: aws.String(name),
+		Ids:  []string{scheduleTargetId},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove target from rule %s: %w", name, err)
+	}
+
+	if _, err := client.DeleteRule(ctx, &eventbridge.DeleteRuleInput{Name: aws.String(name)}); err != nil {
+		return fmt.Errorf("failed to delete rule %s: %w", name, err)
+	}
+
+	_, err = lambda.NewFromConfig(cfg).RemovePermission(ctx, &lambda.RemovePermissionInput{
+		FunctionName: aws.String(lambdaName),
+		StatementId:  aws.String(schedulePermissionId(name)),
+	})
+	if err != nil && !strings.Contains(err.Error(), "404") {
+		return fmt.Errorf("failed to remove permission for rule %s from lambda %s: %w", name, lambdaName, err)
+	}
+
+	out.Infof("Deleted schedule %s for lambda %q", name, lambdaName)
+	return nil
+}
+
+// deleteSchedules removes every schedule Labrador created for a function
+func deleteSchedules(ctx context.Context, cfg aws.Config, lambdaName, functionArn string, out console.Printer) error {
+	live, err := ListLambdaSchedules(cfg.Region, lambdaName, functionArn)
+	if err != nil {
+		return err
+	}
+
+	for name, schedule := range live {
+		if err := deleteSchedule(ctx, cfg, lambdaName, name, schedule, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listScheduleRules lists the rules named after a function that target it
+func listScheduleRules(ctx context.Context, client *eventbridge.Client, lambdaName, functionArn string) ([]string, error) {
+	var names []string
+	input := &eventbridge.ListRuleNamesByTargetInput{TargetArn: aws.String(functionArn)}
+
+	for {
+		output, err := client.ListRuleNamesByTarget(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list rules for lambda %s: %w", lambdaName, err)
+		}
+
+		for _, name := range output.RuleNames {
+			if strings.HasPrefix(name, lambdaName+"-") {
+				names = append(names, name)
+			}
+		}
+
+		if output.NextToken == nil {
+			return names, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// scheduleFromLive turns a live schedule back into the config that creates it,
+// so a snapshot of the schedules can be synced like a config
+func scheduleFromLive(lambdaName, name string, live LiveSchedule) types.LambdaSchedule {
+	schedule := types.LambdaSchedule{
+		Name:       strings.TrimPrefix(name, lambdaName+"-"),
+		Expression: live.Expression,
+		Enabled:    aws.Bool(live.Enabled),
+	}
+	if live.Scheduler {
+		schedule.Timezone = aws.String(live.Timezone)
+		schedule.RoleArn = aws.String(live.RoleArn)
+	}
+	if live.Input != "" {
+		schedule.Input = json.RawMessage(live.Input)
+	}
+
+	return schedule
+}
+
+func usesScheduler(schedule types.LambdaSchedule) bool {
+	return schedule.Timezone != nil && *schedule.Timezone != ""
+}
+
+func scheduleEnabled(schedule types.LambdaSchedule) bool {
+	return schedule.Enabled == nil || *schedule.Enabled
+}
+
+func scheduleInput(schedule types.LambdaSchedule) string {
+	if len(schedule.Input) == 0 {
+		return ""
+	}
+	return normalizeJSON(schedule.Input)
+}
+
+func schedulePermissionId(name string) string {
+	return "events-" + name + "-invoke"
+}
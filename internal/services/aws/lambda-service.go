@@ -4,10 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/packaging"
 	internalTypes "github.com/DQGriffin/labrador/internal/types"
 	"github.com/DQGriffin/labrador/pkg/types"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -16,31 +17,54 @@ import (
 	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
 )
 
-const (
-	region = "us-east-1"
-)
-
-func ListLambdas() (map[string]lambdaTypes.FunctionConfiguration, error) {
+// ListLambdas returns the live configuration of the functions in every region
+// the project's functions deploy to, keyed by name. A configured function is
+// only matched in its own region, so a function with the same name elsewhere
+// isn't mistaken for it. Other functions are listed from AWS_REGION.
+func ListLambdas(stages []types.Stage) (map[string]lambdaTypes.FunctionConfiguration, error) {
 	m := make(map[string]lambdaTypes.FunctionConfiguration)
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(os.Getenv("AWS_REGION")),
-	)
-	if err != nil {
-		return m, err
+	defaultRegion := os.Getenv("AWS_REGION")
+	configured := make(map[string]string)
+	regions := []string{defaultRegion}
+	for _, stage := range stages {
+		for _, fnConfig := range stage.Functions {
+			for _, fn := range fnConfig.Functions {
+				region := aws.ToString(fn.Region)
+				if region == "" {
+					region = defaultRegion
+				}
+				configured[fn.Name] = region
+				if !slices.Contains(regions, region) {
+					regions = append(regions, region)
+				}
+			}
+		}
 	}
 
-	client := lambda.NewFromConfig(cfg)
-
-	paginator := lambda.NewListFunctionsPaginator(client, &lambda.ListFunctionsInput{})
-
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(context.TODO())
+	for _, region := range regions {
+		cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
 		if err != nil {
-			console.Fatal(err)
+			return m, fmt.Errorf("unable to load AWS config: %w", err)
 		}
-		for _, fn := range page.Functions {
-			m[*fn.FunctionName] = lambdaTypes.FunctionConfiguration{}
+
+		paginator := lambda.NewListFunctionsPaginator(lambda.NewFromConfig(cfg), &lambda.ListFunctionsInput{})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				return m, fmt.Errorf("failed to list lambdas in %s: %w", region, err)
+			}
+			for _, fn := range page.Functions {
+				name := aws.ToString(fn.FunctionName)
+				want, exists := configured[name]
+				if !exists {
+					want = defaultRegion
+				}
+				if want != region {
+					continue
+				}
+				m[name] = fn
+			}
 		}
 	}
 
@@ -49,17 +73,17 @@ func ListLambdas() (map[string]lambdaTypes.FunctionConfiguration, error) {
 
 // Should refactor this in the future. Currently we're creating a new client every time
 // a function is created or update. Ideally we would reuse the client
-func CreateLambda(lambdaConfig types.LambdaConfig) {
+func CreateLambda(lambdaConfig types.LambdaConfig, out console.Printer) (string, error) {
 	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(*lambdaConfig.Region))
 	if err != nil {
-		console.Fatalf("Unable to load AWS config: %v", err)
+		return "", fmt.Errorf("unable to load AWS config: %w", err)
 	}
 
 	client := lambda.NewFromConfig(cfg)
 
-	zipData, err := os.ReadFile(*lambdaConfig.Code)
+	pkg, err := buildPackage(lambdaConfig, out)
 	if err != nil {
-		console.Fatalf("Failed to read scaffold zip: %v", err)
+		return "", err
 	}
 
 	_, getErr := client.GetFunction(context.TODO(), &lambda.GetFunctionInput{
@@ -67,90 +91,326 @@ func CreateLambda(lambdaConfig types.LambdaConfig) {
 	})
 
 	if getErr == nil {
-		console.Infof("Lambda %q already exists. Skipping.", lambdaConfig.Name)
-		// continue
-		return
+		return "", fmt.Errorf("lambda %q already exists", lambdaConfig.Name)
 	}
 
-	console.Infof("Creating Lambda %q...", lambdaConfig.Name)
-	_, err = client.CreateFunction(context.TODO(), &lambda.CreateFunctionInput{
-		FunctionName: aws.String(lambdaConfig.Name),
-		Description:  aws.String(*lambdaConfig.Description),
-		Timeout:      aws.Int32(int32(*lambdaConfig.Timeout)),
-		Role:         aws.String(*lambdaConfig.RoleArn),
-		Handler:      aws.String(*lambdaConfig.Handler),
-		Runtime:      lambdaTypes.Runtime(*lambdaConfig.Runtime),
-		MemorySize:   aws.Int32(int32(*lambdaConfig.MemorySize)),
-		Code: &lambdaTypes.FunctionCode{
-			ZipFile: zipData,
-		},
+	code, err := lambdaCode(lambdaConfig, pkg, out)
+	if err != nil {
+		return "", err
+	}
+
+	input := &lambda.CreateFunctionInput{
+		FunctionName:     aws.String(lambdaConfig.Name),
+		Description:      aws.String(*lambdaConfig.Description),
+		Timeout:          aws.Int32(int32(*lambdaConfig.Timeout)),
+		Role:             aws.String(*lambdaConfig.RoleArn),
+		MemorySize:       aws.Int32(int32(*lambdaConfig.MemorySize)),
+		Code:             code,
+		Architectures:    architectures(lambdaConfig),
+		Layers:           lambdaConfig.Layers,
+		EphemeralStorage: ephemeralStorage(lambdaConfig),
+		TracingConfig:    tracingConfig(lambdaConfig),
+		KMSKeyArn:        lambdaConfig.KmsKeyArn,
+		LoggingConfig:    loggingConfig(lambdaConfig),
 		Environment: &lambdaTypes.Environment{
 			Variables: lambdaConfig.Environment,
 		},
 		Tags:    lambdaConfig.Tags,
 		Publish: true,
-	})
+	}
+
+	if lambdaConfig.IsImage() {
+		input.PackageType = lambdaTypes.PackageTypeImage
+		input.ImageConfig = imageConfig(lambdaConfig)
+	} else {
+		input.Handler = aws.String(*lambdaConfig.Handler)
+		input.Runtime = lambdaTypes.Runtime(*lambdaConfig.Runtime)
+	}
+
+	if lambdaConfig.VpcConfig != nil {
+		input.VpcConfig = vpcConfig(lambdaConfig)
+	}
+
+	if lambdaConfig.DeadLetterConfig != nil {
+		input.DeadLetterConfig = deadLetterConfig(lambdaConfig)
+	}
+
+	out.Infof("Creating Lambda %q...", lambdaConfig.Name)
+	output, err := client.CreateFunction(context.TODO(), input)
 
 	if err != nil {
-		console.Errorf("Failed to create function %q: %v", lambdaConfig.Name, err)
-		return
+		return "", fmt.Errorf("failed to create function %q: %w", lambdaConfig.Name, err)
 	}
 
-	console.Infof("Created Lambda %q", lambdaConfig.Name)
+	out.Infof("Waiting for lambda %q to become active", lambdaConfig.Name)
+	if err := WaitForLambda(context.TODO(), client, lambdaConfig.Name, LambdaWaitTimeout(lambdaConfig), out); err != nil {
+		return aws.ToString(output.FunctionArn), err
+	}
+
+	if lambdaConfig.ReservedConcurrency != nil {
+		if err := putReservedConcurrency(client, lambdaConfig, out); err != nil {
+			return aws.ToString(output.FunctionArn), err
+		}
+	}
+
+	if err := syncAliases(client, lambdaConfig, aws.ToString(output.Version), out); err != nil {
+		return aws.ToString(output.FunctionArn), err
+	}
+
+	pruneArtifacts(lambdaConfig, code, out)
+	out.Infof("Created Lambda %q", lambdaConfig.Name)
+	return aws.ToString(output.FunctionArn), nil
 }
 
-func UpdateLambda(lambdaConfig types.LambdaConfig) {
-	console.Infof("Updating lambda %q", lambdaConfig.Name)
-	updateLambdaCode(lambdaConfig)
-	time.Sleep(5 * time.Second)
-	UpdateLambdaConfiguration(lambdaConfig)
-	console.Infof("Finished updating lambda %q", lambdaConfig.Name)
+// UpdateLambda brings an existing function in line with its config. Code is only
+// uploaded when the package differs from the live CodeSha256 (or the image URI
+// or architecture changed), and the configuration is only applied when
+// configChanged is set. Any change publishes a new version and moves the
+// function's aliases to it.
+func UpdateLambda(lambdaConfig types.LambdaConfig, live lambdaTypes.FunctionConfiguration, configChanged bool, out console.Printer) (string, error) {
+	pkg, err := buildPackage(lambdaConfig, out)
+	if err != nil {
+		return "", err
+	}
+
+	codeChanged, err := lambdaCodeChanged(lambdaConfig, live, pkg)
+	if err != nil {
+		return "", err
+	}
+
+	concurrencyChanged, err := reservedConcurrencyChanged(lambdaConfig)
+	if err != nil {
+		return "", err
+	}
+
+	aliasesChanged, err := aliasesNeedUpdate(lambdaConfig)
+	if err != nil {
+		return "", err
+	}
+
+	if !codeChanged && !configChanged && !concurrencyChanged && !aliasesChanged {
+		out.Infof("Lambda %q is unchanged", lambdaConfig.Name)
+		return aws.ToString(live.FunctionArn), nil
+	}
+
+	out.Infof("Updating lambda %q", lambdaConfig.Name)
+	arn := aws.ToString(live.FunctionArn)
+
+	if codeChanged {
+		arn, err = updateLambdaCode(lambdaConfig, pkg, out)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		out.Infof("Code for lambda %q is unchanged", lambdaConfig.Name)
+	}
+
+	if configChanged {
+		configErr := UpdateLambdaConfiguration(lambdaConfig, out)
+		if configErr != nil {
+			return arn, configErr
+		}
+	} else {
+		out.Infof("Configuration for lambda %q is unchanged", lambdaConfig.Name)
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(*lambdaConfig.Region))
+	if err != nil {
+		return arn, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	client := lambda.NewFromConfig(cfg)
+
+	if concurrencyChanged {
+		if err := putReservedConcurrency(client, lambdaConfig, out); err != nil {
+			return arn, err
+		}
+	}
+
+	if codeChanged || configChanged || aliasesChanged {
+		version, err := publishVersion(client, lambdaConfig, out)
+		if err != nil {
+			return arn, err
+		}
+
+		if err := syncAliases(client, lambdaConfig, version, out); err != nil {
+			return arn, err
+		}
+	}
+
+	out.Infof("Finished updating lambda %q", lambdaConfig.Name)
+	return arn, nil
 }
 
-func updateLambdaCode(lambdaConfig types.LambdaConfig) {
+func updateLambdaCode(lambdaConfig types.LambdaConfig, pkg *packaging.Package, out console.Printer) (string, error) {
 	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(*lambdaConfig.Region))
 	if err != nil {
-		console.Fatalf("Unable to load AWS config: %v", err)
+		return "", fmt.Errorf("unable to load AWS config: %w", err)
 	}
 
 	client := lambda.NewFromConfig(cfg)
 
-	zipData, err := os.ReadFile(*lambdaConfig.Code)
+	code, err := lambdaCode(lambdaConfig, pkg, out)
 	if err != nil {
-		console.Fatalf("Failed to read zip: %v", err)
+		return "", err
 	}
 
-	_, updateErr := client.UpdateFunctionCode(context.TODO(), &lambda.UpdateFunctionCodeInput{
-		FunctionName: aws.String(lambdaConfig.Name),
-		ZipFile:      zipData,
+	output, updateErr := client.UpdateFunctionCode(context.TODO(), &lambda.UpdateFunctionCodeInput{
+		FunctionName:    aws.String(lambdaConfig.Name),
+		ZipFile:         code.ZipFile,
+		S3Bucket:        code.S3Bucket,
+		S3Key:           code.S3Key,
+		S3ObjectVersion: code.S3ObjectVersion,
+		ImageUri:        code.ImageUri,
+		Architectures:   architectures(lambdaConfig),
 	})
 	if updateErr != nil {
-		console.Errorf("Failed to update function code for %s: %v", lambdaConfig.Name, err)
+		return "", fmt.Errorf("failed to update function code for %s: %w", lambdaConfig.Name, updateErr)
+	}
+
+	// The configuration can't be changed until the code update has finished
+	if err := WaitForLambda(context.TODO(), client, lambdaConfig.Name, LambdaWaitTimeout(lambdaConfig), out); err != nil {
+		return aws.ToString(output.FunctionArn), err
 	}
+
+	pruneArtifacts(lambdaConfig, code, out)
+	return aws.ToString(output.FunctionArn), nil
 }
 
-func UpdateLambdaConfiguration(lambdaConfig types.LambdaConfig) {
+// lambdaCodeChanged reports whether a function's code has to be updated: its
+// package or image differs from the live one, or it moved to another architecture
+func lambdaCodeChanged(lambdaConfig types.LambdaConfig, live lambdaTypes.FunctionConfiguration, pkg *packaging.Package) (bool, error) {
+	if lambdaConfig.Architecture != nil && LiveArchitecture(live) != *lambdaConfig.Architecture {
+		return true, nil
+	}
+
+	if !lambdaConfig.IsImage() {
+		return aws.ToString(live.CodeSha256) != pkg.CodeSha256, nil
+	}
+
+	imageUri, err := GetLambdaImageUri(*lambdaConfig.Region, lambdaConfig.Name)
+	if err != nil {
+		return false, err
+	}
+	return imageUri != aws.ToString(lambdaConfig.ImageUri), nil
+}
+
+// GetLambdaImageUri returns the image a function was deployed from, or "" for zip functions
+func GetLambdaImageUri(region, lambdaName string) (string, error) {
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return "", fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	output, err := lambda.NewFromConfig(cfg).GetFunction(ctx, &lambda.GetFunctionInput{
+		FunctionName: aws.String(lambdaName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get lambda %s: %w", lambdaName, err)
+	}
+
+	if output.Code == nil {
+		return "", nil
+	}
+	return aws.ToString(output.Code.ImageUri), nil
+}
+
+// LiveArchitecture returns the instruction set a function runs on
+func LiveArchitecture(live lambdaTypes.FunctionConfiguration) string {
+	if len(live.Architectures) == 0 {
+		return string(lambdaTypes.ArchitectureX8664)
+	}
+	return string(live.Architectures[0])
+}
+
+func architectures(lambdaConfig types.LambdaConfig) []lambdaTypes.Architecture {
+	if lambdaConfig.Architecture == nil {
+		return nil
+	}
+	return []lambdaTypes.Architecture{lambdaTypes.Architecture(*lambdaConfig.Architecture)}
+}
+
+// imageConfig returns the image overrides to apply. Unset overrides are sent
+// empty, which clears any that were set before.
+func imageConfig(lambdaConfig types.LambdaConfig) *lambdaTypes.ImageConfig {
+	settings := types.LambdaImageConfig{}
+	if lambdaConfig.ImageConfig != nil {
+		settings = *lambdaConfig.ImageConfig
+	}
+
+	config := &lambdaTypes.ImageConfig{
+		Command:          settings.Command,
+		EntryPoint:       settings.EntryPoint,
+		WorkingDirectory: settings.WorkingDirectory,
+	}
+	if config.Command == nil {
+		config.Command = []string{}
+	}
+	if config.EntryPoint == nil {
+		config.EntryPoint = []string{}
+	}
+
+	return config
+}
+
+// buildPackage packages a function's code, reusing the cached package if its
+// files haven't changed. Image functions have no package, so it returns nil for them.
+func buildPackage(lambdaConfig types.LambdaConfig, out console.Printer) (*packaging.Package, error) {
+	if lambdaConfig.IsImage() {
+		return nil, nil
+	}
+
+	if lambdaConfig.Code == nil || *lambdaConfig.Code == "" {
+		return nil, fmt.Errorf("lambda %s has no code", lambdaConfig.Name)
+	}
+
+	pkg, err := packaging.Build(*lambdaConfig.Code, lambdaConfig.Include, lambdaConfig.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("failed to package code for %s: %w", lambdaConfig.Name, err)
+	}
+
+	out.Debugf("Packaged code for lambda %s from %s (%s)", lambdaConfig.Name, *lambdaConfig.Code, pkg.Path)
+	return pkg, nil
+}
+
+func UpdateLambdaConfiguration(lambdaConfig types.LambdaConfig, out console.Printer) error {
 	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(*lambdaConfig.Region))
 	if err != nil {
-		console.Fatalf("Unable to load AWS config: %v", err)
+		return fmt.Errorf("unable to load AWS config: %w", err)
 	}
 
 	client := lambda.NewFromConfig(cfg)
 
-	_, err = client.UpdateFunctionConfiguration(context.TODO(), &lambda.UpdateFunctionConfigurationInput{
+	input := &lambda.UpdateFunctionConfigurationInput{
 		FunctionName: aws.String(lambdaConfig.Name),
-		Handler:      aws.String(*lambdaConfig.Handler),
-		Runtime:      lambdaTypes.Runtime(*lambdaConfig.Runtime),
+		Description:  lambdaConfig.Description,
 		MemorySize:   aws.Int32(int32(*lambdaConfig.MemorySize)),
 		Timeout:      aws.Int32(int32(*lambdaConfig.Timeout)),
 		Role:         aws.String(*lambdaConfig.RoleArn),
 		Environment: &lambdaTypes.Environment{
 			Variables: lambdaConfig.Environment,
 		},
-	})
+		Layers:           layers(lambdaConfig),
+		EphemeralStorage: ephemeralStorage(lambdaConfig),
+		VpcConfig:        vpcConfig(lambdaConfig),
+		TracingConfig:    tracingConfig(lambdaConfig),
+		DeadLetterConfig: deadLetterConfig(lambdaConfig),
+		KMSKeyArn:        aws.String(aws.ToString(lambdaConfig.KmsKeyArn)),
+		LoggingConfig:    loggingConfig(lambdaConfig),
+	}
+
+	if lambdaConfig.IsImage() {
+		input.ImageConfig = imageConfig(lambdaConfig)
+	} else {
+		input.Handler = aws.String(*lambdaConfig.Handler)
+		input.Runtime = lambdaTypes.Runtime(*lambdaConfig.Runtime)
+	}
+
+	_, err = client.UpdateFunctionConfiguration(context.TODO(), input)
 	if err != nil {
-		console.Errorf("Failed to update function config: %v", err)
+		return fmt.Errorf("failed to update function config for %s: %w", lambdaConfig.Name, err)
 	}
+
+	return WaitForLambda(context.TODO(), client, lambdaConfig.Name, LambdaWaitTimeout(lambdaConfig), out)
 }
 
 func GetLambda(ctx context.Context, cfg aws.Config, lambdaName string) (lambdaTypes.FunctionConfiguration, error) {
@@ -169,45 +429,61 @@ func GetLambda(ctx context.Context, cfg aws.Config, lambdaName string) (lambdaTy
 	return fn, err
 }
 
-func DeleteLambda(lambdaName string) {
-	console.Infof("Deleting lambda: %s", lambdaName)
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+func DeleteLambda(lambdaName string, lambdaRegion string, out console.Printer) error {
+	out.Infof("Deleting lambda: %s", lambdaName)
+	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(lambdaRegion))
 	if err != nil {
-		console.Fatalf("Unable to load AWS config: %v", err)
+		return fmt.Errorf("unable to load AWS config: %w", err)
 	}
 
 	client := lambda.NewFromConfig(cfg)
 
+	if err := deleteEventSourceMappings(context.TODO(), client, lambdaName, out); err != nil && !strings.Contains(err.Error(), "404") {
+		return err
+	}
+
+	if existing, err := client.GetFunction(context.TODO(), &lambda.GetFunctionInput{FunctionName: aws.String(lambdaName)}); err == nil {
+		if err := deleteSchedules(context.TODO(), cfg, lambdaName, aws.ToString(existing.Configuration.FunctionArn), out); err != nil {
+			return err
+		}
+	}
+
 	_, deleteErr := client.DeleteFunction(context.TODO(), &lambda.DeleteFunctionInput{
 		FunctionName: aws.String(lambdaName),
 	})
 	if deleteErr != nil {
 		if strings.Contains(deleteErr.Error(), "404") {
-			console.Infof("Lambda %s did not exist. No action taken", lambdaName)
-			return
-		} else {
-			console.Errorf("failed to delete Lambda %s: %s", lambdaName, deleteErr.Error())
-			return
+			out.Infof("Lambda %s did not exist. No action taken", lambdaName)
+			return nil
 		}
+		return fmt.Errorf("failed to delete Lambda %s: %w", lambdaName, deleteErr)
 	}
 
-	console.Infof("Deleted Lambda: %s", lambdaName)
+	out.Infof("Deleted Lambda: %s", lambdaName)
+	return nil
 }
 
-func AddPermissionToLambda(ctx context.Context, cfg aws.Config, permission internalTypes.LambdaPermission) error {
+func AddPermissionToLambda(ctx context.Context, cfg aws.Config, permission internalTypes.LambdaPermission, out console.Printer) error {
 	client := lambda.NewFromConfig(cfg)
 
-	_, err := client.AddPermission(ctx, &lambda.AddPermissionInput{
+	input := &lambda.AddPermissionInput{
 		Action:       aws.String(permission.Action),
 		FunctionName: aws.String(permission.FunctionName),
 		Principal:    aws.String(permission.Principal),
 		StatementId:  aws.String(permission.StatementId),
 		SourceArn:    aws.String(permission.SourceArn),
-	})
+	}
+
+	// An alias has its own resource policy, separate from the function's
+	if permission.Qualifier != "" {
+		input.Qualifier = aws.String(permission.Qualifier)
+	}
+
+	_, err := client.AddPermission(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to add permission to %s: %w", permission.FunctionName, err)
 	}
 
-	console.Infof("Added permission to lambda %s", permission.FunctionName)
+	out.Infof("Added permission to lambda %s", permission.FunctionName)
 	return nil
 }
@@ -0,0 +1,217 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// Lambda's values for settings that aren't configured
+const (
+	DefaultEphemeralStorage = 512
+	DefaultTracingMode      = string(lambdaTypes.TracingModePassThrough)
+)
+
+// ResolveLayers turns a function's layers into version ARNs. A layer is either
+// an ARN, or a layer name in the function's account with an optional version,
+// e.g. shared-deps:3. A name without a version resolves to the latest version.
+func ResolveLayers(region string, layers []string) ([]string, error) {
+	if len(layers) == 0 {
+		return layers, nil
+	}
+
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	client := lambda.NewFromConfig(cfg)
+
+	resolved := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		if strings.HasPrefix(layer, "arn:") {
+			resolved = append(resolved, layer)
+			continue
+		}
+
+		name, version, hasVersion := strings.Cut(layer, ":")
+		if hasVersion {
+			number, err := strconv.ParseInt(version, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version for layer %s: %s", name, version)
+			}
+
+			output, err := client.GetLayerVersion(ctx, &lambda.GetLayerVersionInput{
+				LayerName:     aws.String(name),
+				VersionNumber: aws.Int64(number),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get layer %s: %w", layer, err)
+			}
+			resolved = append(resolved, aws.ToString(output.LayerVersionArn))
+			continue
+		}
+
+		output, err := client.ListLayerVersions(ctx, &lambda.ListLayerVersionsInput{
+			LayerName: aws.String(name),
+			MaxItems:  aws.Int32(1),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get layer %s: %w", layer, err)
+		}
+		if len(output.LayerVersions) == 0 {
+			return nil, fmt.Errorf("layer %s has no versions", layer)
+		}
+		resolved = append(resolved, aws.ToString(output.LayerVersions[0].LayerVersionArn))
+	}
+
+	return resolved, nil
+}
+
+// GetReservedConcurrency returns a function's reserved concurrency, or nil if it has none
+func GetReservedConcurrency(region, lambdaName string) (*int32, error) {
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	output, err := lambda.NewFromConfig(cfg).GetFunctionConcurrency(ctx, &lambda.GetFunctionConcurrencyInput{
+		FunctionName: aws.String(lambdaName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get concurrency for lambda %s: %w", lambdaName, err)
+	}
+
+	return output.ReservedConcurrentExecutions, nil
+}
+
+// reservedConcurrencyChanged reports whether a function's reserved concurrency
+// differs from its config. Functions without reservedConcurrency are left alone.
+func reservedConcurrencyChanged(lambdaConfig types.LambdaConfig) (bool, error) {
+	if lambdaConfig.ReservedConcurrency == nil {
+		return false, nil
+	}
+
+	live, err := GetReservedConcurrency(*lambdaConfig.Region, lambdaConfig.Name)
+	if err != nil {
+		return false, err
+	}
+
+	return live == nil || *live != int32(*lambdaConfig.ReservedConcurrency), nil
+}
+
+func putReservedConcurrency(client *lambda.Client, lambdaConfig types.LambdaConfig, out console.Printer) error {
+	out.Infof("Setting reserved concurrency for lambda %q to %d", lambdaConfig.Name, *lambdaConfig.ReservedConcurrency)
+	_, err := client.PutFunctionConcurrency(context.TODO(), &lambda.PutFunctionConcurrencyInput{
+		FunctionName:                 aws.String(lambdaConfig.Name),
+		ReservedConcurrentExecutions: aws.Int32(int32(*lambdaConfig.ReservedConcurrency)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set reserved concurrency for %s: %w", lambdaConfig.Name, err)
+	}
+	return nil
+}
+
+// restoreReservedConcurrency puts back a function's previous reserved
+// concurrency, or removes it if the function had none
+func restoreReservedConcurrency(ctx context.Context, client *lambda.Client, lambdaName string, previous *int32, out console.Printer) error {
+	var err error
+	if previous == nil {
+		_, err = client.DeleteFunctionConcurrency(ctx, &lambda.DeleteFunctionConcurrencyInput{
+			FunctionName: aws.String(lambdaName),
+		})
+	} else {
+		_, err = client.PutFunctionConcurrency(ctx, &lambda.PutFunctionConcurrencyInput{
+			FunctionName:                 aws.String(lambdaName),
+			ReservedConcurrentExecutions: previous,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore reserved concurrency for %s: %w", lambdaName, err)
+	}
+
+	out.Debugf("Restored reserved concurrency for lambda %s", lambdaName)
+	return nil
+}
+
+// The settings below are sent on every configuration update. Unset settings
+// are sent as Lambda's defaults, so removing one from the config removes it
+// from the function.
+
+func ephemeralStorage(lambdaConfig types.LambdaConfig) *lambdaTypes.EphemeralStorage {
+	size := int32(DefaultEphemeralStorage)
+	if lambdaConfig.EphemeralStorage != nil {
+		size = int32(*lambdaConfig.EphemeralStorage)
+	}
+	return &lambdaTypes.EphemeralStorage{Size: aws.Int32(size)}
+}
+
+func vpcConfig(lambdaConfig types.LambdaConfig) *lambdaTypes.VpcConfig {
+	settings := types.LambdaVpcConfig{}
+	if lambdaConfig.VpcConfig != nil {
+		settings = *lambdaConfig.VpcConfig
+	}
+
+	config := &lambdaTypes.VpcConfig{
+		SubnetIds:        settings.SubnetIds,
+		SecurityGroupIds: settings.SecurityGroupIds,
+	}
+	if config.SubnetIds == nil {
+		config.SubnetIds = []string{}
+	}
+	if config.SecurityGroupIds == nil {
+		config.SecurityGroupIds = []string{}
+	}
+	return config
+}
+
+func tracingConfig(lambdaConfig types.LambdaConfig) *lambdaTypes.TracingConfig {
+	mode := DefaultTracingMode
+	if lambdaConfig.TracingConfig != nil {
+		mode = lambdaConfig.TracingConfig.Mode
+	}
+	return &lambdaTypes.TracingConfig{Mode: lambdaTypes.TracingMode(mode)}
+}
+
+func deadLetterConfig(lambdaConfig types.LambdaConfig) *lambdaTypes.DeadLetterConfig {
+	if lambdaConfig.DeadLetterConfig == nil {
+		return &lambdaTypes.DeadLetterConfig{TargetArn: aws.String("")}
+	}
+	return &lambdaTypes.DeadLetterConfig{TargetArn: aws.String(lambdaConfig.DeadLetterConfig.TargetArn)}
+}
+
+func layers(lambdaConfig types.LambdaConfig) []string {
+	if lambdaConfig.Layers == nil {
+		return []string{}
+	}
+	return lambdaConfig.Layers
+}
+
+// loggingConfig is only sent when the function sets it, since Lambda's default
+// log group depends on the function name
+func loggingConfig(lambdaConfig types.LambdaConfig) *lambdaTypes.LoggingConfig {
+	if lambdaConfig.LoggingConfig == nil {
+		return nil
+	}
+
+	logging := lambdaConfig.LoggingConfig
+	config := &lambdaTypes.LoggingConfig{
+		LogGroup: logging.LogGroup,
+	}
+	if logging.LogFormat != nil {
+		config.LogFormat = lambdaTypes.LogFormat(*logging.LogFormat)
+	}
+	if logging.ApplicationLogLevel != nil {
+		config.ApplicationLogLevel = lambdaTypes.ApplicationLogLevel(*logging.ApplicationLogLevel)
+	}
+	if logging.SystemLogLevel != nil {
+		config.SystemLogLevel = lambdaTypes.SystemLogLevel(*logging.SystemLogLevel)
+	}
+	return config
+}
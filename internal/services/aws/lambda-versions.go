@@ -0,0 +1,86 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+// StaleVersions lists a function's published versions beyond the newest retain
+// of them, oldest first. The newest version, which is the one a deploy just
+// published, and versions an alias points at or shifts traffic to are never stale.
+func StaleVersions(region, lambdaName string, retain int) ([]string, error) {
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	var versions []int64
+	paginator := lambda.NewListVersionsByFunctionPaginator(lambda.NewFromConfig(cfg), &lambda.ListVersionsByFunctionInput{
+		FunctionName: aws.String(lambdaName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of lambda %s: %w", lambdaName, err)
+		}
+
+		for _, version := range page.Versions {
+			// $LATEST isn't a published version
+			number, err := strconv.ParseInt(aws.ToString(version.Version), 10, 64)
+			if err != nil {
+				continue
+			}
+			versions = append(versions, number)
+		}
+	}
+
+	aliases, err := ListLambdaAliases(region, lambdaName)
+	if err != nil {
+		return nil, err
+	}
+
+	aliased := make(map[string]bool)
+	for _, alias := range aliases {
+		aliased[aws.ToString(alias.FunctionVersion)] = true
+		if canary, _ := AliasWeight(alias); canary != "" {
+			aliased[canary] = true
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+
+	var stale []string
+	for i, number := range versions {
+		version := strconv.FormatInt(number, 10)
+		if i < max(retain, 1) || aliased[version] {
+			continue
+		}
+		stale = append([]string{version}, stale...)
+	}
+
+	return stale, nil
+}
+
+// DeleteLambdaVersion deletes one published version of a function
+func DeleteLambdaVersion(region, lambdaName, version string) error {
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	_, err = lambda.NewFromConfig(cfg).DeleteFunction(ctx, &lambda.DeleteFunctionInput{
+		FunctionName: aws.String(lambdaName),
+		Qualifier:    aws.String(version),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete version %s of lambda %s: %w", version, lambdaName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+const (
+	defaultLambdaWaitTimeout = 5 * time.Minute
+	minLambdaPollInterval    = 1 * time.Second
+	maxLambdaPollInterval    = 10 * time.Second
+)
+
+// LambdaWaitTimeout returns how long to wait for a function to settle after a change
+func LambdaWaitTimeout(lambdaConfig types.LambdaConfig) time.Duration {
+	if lambdaConfig.WaitTimeout == nil || *lambdaConfig.WaitTimeout == 0 {
+		return defaultLambdaWaitTimeout
+	}
+	return time.Duration(*lambdaConfig.WaitTimeout) * time.Second
+}
+
+// WaitForLambda polls the function until it is no longer pending and its last update
+// has finished. Lambda rejects further changes with a ResourceConflictException until then.
+func WaitForLambda(ctx context.Context, client *lambda.Client, lambdaName string, timeout time.Duration, out console.Printer) error {
+	deadline := time.Now().Add(timeout)
+	interval := minLambdaPollInterval
+
+	for {
+		output, err := client.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+			FunctionName: aws.String(lambdaName),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get state of lambda %s: %w", lambdaName, err)
+		}
+
+		if output.State == lambdaTypes.StateFailed {
+			return fmt.Errorf("lambda %s is in a failed state: %s", lambdaName, describeReason(output.StateReasonCode, output.StateReason))
+		}
+
+		if output.LastUpdateStatus == lambdaTypes.LastUpdateStatusFailed {
+			return fmt.Errorf("last update to lambda %s failed: %s", lambdaName, describeReason(output.LastUpdateStatusReasonCode, output.LastUpdateStatusReason))
+		}
+
+		if output.State != lambdaTypes.StatePending && output.LastUpdateStatus != lambdaTypes.LastUpdateStatusInProgress {
+			return nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for lambda %s (state %s, last update %s)", timeout, lambdaName, output.State, output.LastUpdateStatus)
+		}
+
+		out.Debugf("Lambda %s is %s (last update %s). Checking again in %s", lambdaName, output.State, output.LastUpdateStatus, interval)
+		time.Sleep(interval)
+
+		interval *= 2
+		if interval > maxLambdaPollInterval {
+			interval = maxLambdaPollInterval
+		}
+	}
+}
+
+func describeReason[T ~string](code T, reason *string) string {
+	if reason == nil || *reason == "" {
+		return string(code)
+	}
+	if code == "" {
+		return *reason
+	}
+	return fmt.Sprintf("%s (%s)", *reason, code)
+}
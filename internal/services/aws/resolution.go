@@ -3,11 +3,28 @@ package aws
 import (
 	"errors"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 )
 
+// ResolveTarget returns the ARN a target points at. A target with an alias
+// resolves to the alias's ARN, e.g. arn:aws:lambda:...:function:orders:live
 func ResolveTarget(target types.ResourceTarget, refMap map[string]string) (string, error) {
+	arn, err := resolveTargetArn(target, refMap)
+	if err != nil {
+		return arn, err
+	}
+
+	if target.Alias != nil && *target.Alias != "" {
+		return arn + ":" + *target.Alias, nil
+	}
+	return arn, nil
+}
+
+func resolveTargetArn(target types.ResourceTarget, refMap map[string]string) (string, error) {
 	// Prefer Labrador-managed reference
 	if target.Ref != nil && *target.Ref != "" {
 		return resolveRef(*target.Ref, refMap)
@@ -32,12 +49,62 @@ func resolveRef(ref string, refMap map[string]string) (string, error) {
 	result := refMap[ref]
 
 	if result == "" {
-		return "", errors.New("ref not found")
+		return "", fmt.Errorf("ref %q not found", ref)
 	}
 
 	return result, nil
 }
 
+// BuildRefMap maps the ref of every Lambda in the project to its ARN, so API
+// integrations can target functions by ref. ARNs are built from the function
+// name, so they resolve before the function has been created. It fails if the
+// account ID is needed and can't be looked up.
+func BuildRefMap(stages []types.Stage) (map[string]string, error) {
+	refMap := make(map[string]string)
+
+	accountId := os.Getenv("AWS_ACCOUNT_ID")
+	for _, stage := range stages {
+		for _, fnConfig := range stage.Functions {
+			for _, fn := range fnConfig.Functions {
+				if fn.Ref == nil || *fn.Ref == "" {
+					continue
+				}
+
+				if accountId == "" {
+					id, err := GetAccountID()
+					if err != nil {
+						return nil, fmt.Errorf("failed to resolve lambda refs: %w", err)
+					}
+					accountId = id
+				}
+
+				refMap[*fn.Ref] = LambdaArn(*fn.Region, accountId, fn.Name)
+			}
+		}
+	}
+
+	return refMap, nil
+}
+
+func LambdaArn(region, accountId, name string) string {
+	return fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", region, accountId, name)
+}
+
+// lambdaNameFromTarget returns the function an integration invokes, either
+// from its dynamic target or from the ARN it resolved to
+func lambdaNameFromTarget(target types.ResourceTarget, arn string) string {
+	if target.External != nil && target.External.Dynamic != nil {
+		return target.External.Dynamic.Name
+	}
+
+	_, name, found := strings.Cut(arn, ":function:")
+	if !found {
+		return arn
+	}
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
 func lookupByNameAndType(resource types.DynamicResourceRefData) (string, error) {
 	if resource.Type == "s3" {
 		arn := lookupS3Bucket(resource.Name)
@@ -45,6 +112,10 @@ func lookupByNameAndType(resource types.DynamicResourceRefData) (string, error)
 	} else if resource.Type == "lambda" {
 		arn, err := lookupLambda(resource)
 		return arn, err
+	} else if resource.Type == "sqs" || resource.Type == "kinesis" {
+		return lookupQueueOrStream(resource)
+	} else if resource.Type == "dynamodb" {
+		return lookupTableStream(resource)
 	}
 	return "", errors.New("lookupByNameAndType is not fully implemented")
 }
@@ -55,6 +126,43 @@ func lookupS3Bucket(bucketName string) string {
 	return fmt.Sprintf("arn:aws:s3:::%s", bucketName)
 }
 
+// Queue and stream ARNs are deterministic too, given the account
+func lookupQueueOrStream(resource types.DynamicResourceRefData) (string, error) {
+	accountId := os.Getenv("AWS_ACCOUNT_ID")
+	if accountId == "" {
+		id, err := GetAccountID()
+		if err != nil {
+			return "", err
+		}
+		accountId = id
+	}
+
+	if resource.Type == "kinesis" {
+		return fmt.Sprintf("arn:aws:kinesis:%s:%s:stream/%s", resource.Region, accountId, resource.Name), nil
+	}
+	return fmt.Sprintf("arn:aws:sqs:%s:%s:%s", resource.Region, accountId, resource.Name), nil
+}
+
+// Stream ARNs end in a creation timestamp, so they have to be looked up
+func lookupTableStream(resource types.DynamicResourceRefData) (string, error) {
+	ctx, cfg, err := GetConfig(resource.Region)
+	if err != nil {
+		return "", fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	out, err := dynamodb.NewFromConfig(cfg).DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: &resource.Name,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe table %s: %w", resource.Name, err)
+	}
+
+	if out.Table.LatestStreamArn == nil || *out.Table.LatestStreamArn == "" {
+		return "", fmt.Errorf("table %s doesn't have a stream enabled", resource.Name)
+	}
+	return *out.Table.LatestStreamArn, nil
+}
+
 func lookupLambda(resource types.DynamicResourceRefData) (string, error) {
 	ctx, cfg, err := GetConfig(resource.Region)
 	if err != nil {
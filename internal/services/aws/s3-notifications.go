@@ -0,0 +1,253 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	internalTypes "github.com/DQGriffin/labrador/internal/types"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// BucketNotification is a Lambda notification on a bucket, from the config
+// with its target resolved, or read from the live bucket
+type BucketNotification struct {
+	FunctionArn string
+	Events      []string
+	Prefix      string
+	Suffix      string
+	Target      *types.ResourceTarget
+}
+
+// Key identifies a notification by its function and filters. S3 rejects two
+// notifications on the same filters, so the key is unique within a bucket.
+func (n BucketNotification) Key() string {
+	key := n.FunctionArn
+	if n.Prefix != "" || n.Suffix != "" {
+		key += " (" + n.Prefix + "*" + n.Suffix + ")"
+	}
+	return key
+}
+
+// DescribeEvents lists the notification's events in a stable order
+func (n BucketNotification) DescribeEvents() string {
+	events := append([]string{}, n.Events...)
+	sort.Strings(events)
+	return strings.Join(events, ", ")
+}
+
+// ResolveBucketNotifications resolves the target of each of a bucket's notifications to a function ARN
+func ResolveBucketNotifications(bucket types.S3Settings, refMap map[string]string) ([]BucketNotification, error) {
+	notifications := make([]BucketNotification, 0, len(bucket.Notifications))
+	for _, notification := range bucket.Notifications {
+		arn, err := ResolveTarget(notification.Target, refMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve notification target for bucket %s: %w", aws.ToString(bucket.Name), err)
+		}
+
+		notifications = append(notifications, BucketNotification{
+			FunctionArn: arn,
+			Events:      notification.Events,
+			Prefix:      aws.ToString(notification.Prefix),
+			Suffix:      aws.ToString(notification.Suffix),
+			Target:      &notification.Target,
+		})
+	}
+
+	return notifications, nil
+}
+
+// ListBucketNotifications returns the Lambda notifications configured on a bucket
+func ListBucketNotifications(ctx context.Context, client *s3.Client, bucketName string) ([]BucketNotification, error) {
+	output, err := client.GetBucketNotificationConfiguration(ctx, &s3.GetBucketNotificationConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications for bucket %s: %w", bucketName, err)
+	}
+
+	notifications := []BucketNotification{}
+	for _, config := range output.LambdaFunctionConfigurations {
+		notification := BucketNotification{FunctionArn: aws.ToString(config.LambdaFunctionArn)}
+		for _, event := range config.Events {
+			notification.Events = append(notification.Events, string(event))
+		}
+		if config.Filter != nil && config.Filter.Key != nil {
+			for _, rule := range config.Filter.Key.FilterRules {
+				// S3 returns the rule names capitalized
+				switch strings.ToLower(string(rule.Name)) {
+				case "prefix":
+					notification.Prefix = aws.ToString(rule.Value)
+				case "suffix":
+					notification.Suffix = aws.ToString(rule.Value)
+				}
+			}
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nil
+}
+
+// SyncBucketNotifications grants S3 permission to invoke each target function
+// and replaces the bucket's Lambda notifications with the ones in its config.
+// Buckets without notifications are left alone, an empty list removes them
+// all. SNS, SQS and EventBridge notifications are kept as they are.
+func SyncBucketNotifications(ctx context.Context, cfg aws.Config, client *s3.Client, bucket types.S3Settings, refMap map[string]string, out console.Printer) error {
+	if bucket.Notifications == nil {
+		return nil
+	}
+
+	notifications, err := ResolveBucketNotifications(bucket, refMap)
+	if err != nil {
+		return err
+	}
+
+	// S3 checks that it can invoke the functions when the configuration is put
+	granted := make(map[string]bool)
+	for _, notification := range notifications {
+		if granted[notification.FunctionArn] {
+			continue
+		}
+		granted[notification.FunctionArn] = true
+
+		if err := grantBucketInvoke(ctx, cfg, *bucket.Name, notification, out); err != nil {
+			return err
+		}
+	}
+
+	live, err := ListBucketNotifications(ctx, client, *bucket.Name)
+	if err != nil {
+		return err
+	}
+
+	if notificationsMatch(notifications, live) {
+		out.Debugf("Notifications for bucket %s are unchanged", *bucket.Name)
+		return nil
+	}
+
+	if err := putBucketNotifications(ctx, client, *bucket.Name, notifications); err != nil {
+		return err
+	}
+
+	out.Infof("Updated notifications for bucket %s", *bucket.Name)
+	return nil
+}
+
+// RestoreBucketNotifications puts back the Lambda notifications a bucket had before a deploy
+func RestoreBucketNotifications(bucketName, region string, previous []BucketNotification, out console.Printer) error {
+	ctx, cfg, err := GetConfig(region)
+	if err != nil {
+		return err
+	}
+
+	if err := putBucketNotifications(ctx, GetClient(cfg), bucketName, previous); err != nil {
+		return err
+	}
+
+	out.Infof("Restored notifications for bucket %s", bucketName)
+	return nil
+}
+
+func putBucketNotifications(ctx context.Context, client *s3.Client, bucketName string, notifications []BucketNotification) error {
+	existing, err := client.GetBucketNotificationConfiguration(ctx, &s3.GetBucketNotificationConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get notifications for bucket %s: %w", bucketName, err)
+	}
+
+	// The whole configuration is replaced, so carry over the destinations Labrador doesn't manage
+	config := &s3Types.NotificationConfiguration{
+		EventBridgeConfiguration:     existing.EventBridgeConfiguration,
+		QueueConfigurations:          existing.QueueConfigurations,
+		TopicConfigurations:          existing.TopicConfigurations,
+		LambdaFunctionConfigurations: []s3Types.LambdaFunctionConfiguration{},
+	}
+	for _, notification := range notifications {
+		config.LambdaFunctionConfigurations = append(config.LambdaFunctionConfigurations, lambdaNotification(notification))
+	}
+
+	_, err = client.PutBucketNotificationConfiguration(ctx, &s3.PutBucketNotificationConfigurationInput{
+		Bucket:                    aws.String(bucketName),
+		NotificationConfiguration: config,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put notifications for bucket %s: %w", bucketName, err)
+	}
+
+	return nil
+}
+
+func grantBucketInvoke(ctx context.Context, cfg aws.Config, bucketName string, notification BucketNotification, out console.Printer) error {
+	permission := internalTypes.LambdaPermission{
+		Action:       "lambda:InvokeFunction",
+		FunctionName: notification.FunctionArn,
+		Principal:    "s3.amazonaws.com",
+		StatementId:  "s3-" + bucketName + "-invoke",
+		SourceArn:    fmt.Sprintf("arn:aws:s3:::%s", bucketName),
+	}
+	if notification.Target != nil {
+		permission.FunctionName = lambdaNameFromTarget(*notification.Target, notification.FunctionArn)
+		permission.Qualifier = aws.ToString(notification.Target.Alias)
+	}
+
+	err := AddPermissionToLambda(ctx, cfg, permission, out)
+	if err != nil {
+		if strings.Contains(err.Error(), "409") {
+			out.Debugf("Permission already exists for bucket %s on lambda %s", bucketName, permission.FunctionName)
+		} else {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func lambdaNotification(notification BucketNotification) s3Types.LambdaFunctionConfiguration {
+	config := s3Types.LambdaFunctionConfiguration{
+		LambdaFunctionArn: aws.String(notification.FunctionArn),
+	}
+	for _, event := range notification.Events {
+		config.Events = append(config.Events, s3Types.Event(event))
+	}
+
+	var rules []s3Types.FilterRule
+	if notification.Prefix != "" {
+		rules = append(rules, s3Types.FilterRule{Name: s3Types.FilterRuleNamePrefix, Value: aws.String(notification.Prefix)})
+	}
+	if notification.Suffix != "" {
+		rules = append(rules, s3Types.FilterRule{Name: s3Types.FilterRuleNameSuffix, Value: aws.String(notification.Suffix)})
+	}
+	if len(rules) > 0 {
+		config.Filter = &s3Types.NotificationConfigurationFilter{
+			Key: &s3Types.S3KeyFilter{FilterRules: rules},
+		}
+	}
+
+	return config
+}
+
+func notificationsMatch(wanted, live []BucketNotification) bool {
+	if len(wanted) != len(live) {
+		return false
+	}
+
+	liveEvents := make(map[string]string)
+	for _, notification := range live {
+		liveEvents[notification.Key()] = notification.DescribeEvents()
+	}
+	for _, notification := range wanted {
+		events, exists := liveEvents[notification.Key()]
+		if !exists || events != notification.DescribeEvents() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,8 +1,11 @@
 package aws
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/DQGriffin/labrador/internal/cli/console"
@@ -34,8 +37,8 @@ func ListBuckets(ctx context.Context, client *s3.Client) (map[string]bool, error
 	return m, nil
 }
 
-func CreateBucket(ctx context.Context, cfg aws.Config, client s3.Client, bucket types.S3Settings) error {
-	console.Infof("Creating bucket: %s", *bucket.Name)
+func CreateBucket(ctx context.Context, cfg aws.Config, client s3.Client, bucket types.S3Settings, out console.Printer) error {
+	out.Infof("Creating bucket: %s", *bucket.Name)
 	input := &s3.CreateBucketInput{
 		Bucket: aws.String(*bucket.Name),
 	}
@@ -57,23 +60,23 @@ func CreateBucket(ctx context.Context, cfg aws.Config, client s3.Client, bucket
 		return settingsErr
 	}
 
-	console.Infof("Created bucket: %s", *bucket.Name)
+	out.Infof("Created bucket: %s", *bucket.Name)
 	return nil
 }
 
-func UpdateBucket(ctx context.Context, client s3.Client, bucket types.S3Settings) error {
+func UpdateBucket(ctx context.Context, client s3.Client, bucket types.S3Settings, out console.Printer) error {
 	settingsErr := setBucketSettings(ctx, client, &bucket)
 	if settingsErr != nil {
 		return settingsErr
 	}
 
-	console.Infof("Updated bucket: %s", *bucket.Name)
+	out.Infof("Updated bucket: %s", *bucket.Name)
 
 	return nil
 }
 
-func DeleteBucket(bucketName string, bucketRegion string, force bool) error {
-	console.Infof("Deleting bucket: %s", bucketName)
+func DeleteBucket(bucketName string, bucketRegion string, force bool, out console.Printer) error {
+	out.Infof("Deleting bucket: %s", bucketName)
 	ctx, cfg, err := GetConfig(bucketRegion)
 
 	if err != nil {
@@ -84,7 +87,7 @@ func DeleteBucket(bucketName string, bucketRegion string, force bool) error {
 
 	if force {
 		// Region is hard coded for now. Need to refactor
-		EmptyBucket(ctx, bucketName, bucketRegion)
+		EmptyBucket(ctx, bucketName, bucketRegion, out)
 	}
 
 	_, deleteErr := client.DeleteBucket(ctx, &s3.DeleteBucketInput{
@@ -93,17 +96,17 @@ func DeleteBucket(bucketName string, bucketRegion string, force bool) error {
 
 	if deleteErr != nil {
 		if strings.Contains(deleteErr.Error(), "404") {
-			console.Infof("Bucket %s did not exist. No action taken", bucketName)
+			out.Infof("Bucket %s did not exist. No action taken", bucketName)
 			return nil
 		}
 		return fmt.Errorf("failed to delete bucket %s: %w", bucketName, deleteErr)
 	}
 
-	console.Infof("Deleted bucket: %s", bucketName)
+	out.Infof("Deleted bucket: %s", bucketName)
 	return nil
 }
 
-func EmptyBucket(ctx context.Context, bucketName, region string) error {
+func EmptyBucket(ctx context.Context, bucketName, region string, out console.Printer) error {
 	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	if err != nil {
 		return fmt.Errorf("failed to load AWS config: %w", err)
@@ -144,10 +147,10 @@ func EmptyBucket(ctx context.Context, bucketName, region string) error {
 			return fmt.Errorf("failed to delete objects: %w", err)
 		}
 
-		console.Infof("Deleted %d objects from %s\n", len(objectsToDelete), bucketName)
+		out.Infof("Deleted %d objects from %s\n", len(objectsToDelete), bucketName)
 	}
 
-	console.Infof("Bucket %s is now empty\n", bucketName)
+	out.Infof("Bucket %s is now empty\n", bucketName)
 	return nil
 }
 
@@ -236,3 +239,115 @@ func ConvertTags(tagMap map[string]string) []s3Types.Tag {
 	}
 	return tags
 }
+
+// GetObject returns the contents of an object, or nil if the object does not exist
+func GetObject(ctx context.Context, client *s3.Client, bucketName, key string) ([]byte, error) {
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *s3Types.NoSuchKey
+		if errors.As(err, &noSuchKey) || strings.Contains(err.Error(), "404") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get object s3://%s/%s: %w", bucketName, key, err)
+	}
+	defer output.Body.Close()
+
+	return io.ReadAll(output.Body)
+}
+
+// PutObject writes an object and returns its version ID, which is empty when the bucket isn't versioned
+func PutObject(ctx context.Context, client *s3.Client, bucketName, key string, data []byte, metadata map[string]string) (string, error) {
+	output, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(bucketName),
+		Key:      aws.String(key),
+		Body:     bytes.NewReader(data),
+		Metadata: metadata,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to put object s3://%s/%s: %w", bucketName, key, err)
+	}
+
+	return aws.ToString(output.VersionId), nil
+}
+
+// PutObjectIfAbsent writes an object only if no object exists at the key yet.
+// It returns false without an error if the object already exists.
+func PutObjectIfAbsent(ctx context.Context, client *s3.Client, bucketName, key string, data []byte, metadata map[string]string) (bool, error) {
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		Metadata:    metadata,
+		IfNoneMatch: aws.String("*"),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "PreconditionFailed") || strings.Contains(err.Error(), "412") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to put object s3://%s/%s: %w", bucketName, key, err)
+	}
+
+	return true, nil
+}
+
+func DeleteObject(ctx context.Context, client *s3.Client, bucketName, key string) error {
+	_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object s3://%s/%s: %w", bucketName, key, err)
+	}
+
+	return nil
+}
+
+// GetBucketSettings reads the live settings Labrador manages for a bucket
+func GetBucketSettings(ctx context.Context, client s3.Client, bucketName string, region string) (types.S3Settings, error) {
+	settings := types.S3Settings{
+		Name:   aws.String(bucketName),
+		Region: aws.String(region),
+		Tags:   map[string]string{},
+	}
+
+	versioning, err := client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		return settings, fmt.Errorf("failed to get versioning for bucket %s: %w", bucketName, err)
+	}
+	settings.Versioning = aws.Bool(versioning.Status == s3Types.BucketVersioningStatusEnabled)
+
+	tagging, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil && !strings.Contains(err.Error(), "NoSuchTagSet") {
+		return settings, fmt.Errorf("failed to get tags for bucket %s: %w", bucketName, err)
+	}
+	if err == nil {
+		for _, tag := range tagging.TagSet {
+			settings.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+
+	publicAccess, err := client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil && !strings.Contains(err.Error(), "NoSuchPublicAccessBlockConfiguration") {
+		return settings, fmt.Errorf("failed to get public access block for bucket %s: %w", bucketName, err)
+	}
+
+	// Labrador sets all four flags together, so only treat the bucket as blocked if all four are set
+	blocked := false
+	if err == nil && publicAccess.PublicAccessBlockConfiguration != nil {
+		block := publicAccess.PublicAccessBlockConfiguration
+		blocked = aws.ToBool(block.BlockPublicAcls) && aws.ToBool(block.IgnorePublicAcls) &&
+			aws.ToBool(block.BlockPublicPolicy) && aws.ToBool(block.RestrictPublicBuckets)
+	}
+	settings.BlockPublicAccess = aws.Bool(blocked)
+
+	return settings, nil
+}
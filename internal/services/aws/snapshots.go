@@ -0,0 +1,465 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/internal/packaging"
+	"github.com/DQGriffin/labrador/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// LambdaSnapshot is a function's code and configuration as they were before a deploy
+type LambdaSnapshot struct {
+	Configuration lambdaTypes.FunctionConfiguration
+	// ZipFile is nil when the deploy wasn't going to replace the package
+	ZipFile  []byte
+	ImageUri string
+	Tags     map[string]string
+	// The settings below are only captured by SnapshotLambda, and the ones
+	// left unset are left alone on restore
+	Aliases      map[string]lambdaTypes.AliasConfiguration
+	EventSources map[string]lambdaTypes.EventSourceMappingConfiguration
+	Schedules    map[string]LiveSchedule
+	// ReservedConcurrency is nil when the function had none, so
+	// ConcurrencyCaptured tells that apart from not having captured it
+	ReservedConcurrency *int32
+	ConcurrencyCaptured bool
+}
+
+// GetLambdaSnapshot downloads a function's current code package alongside its configuration
+func GetLambdaSnapshot(lambdaName string, region string) (LambdaSnapshot, error) {
+	return getLambdaSnapshot(lambdaName, region, nil)
+}
+
+// SnapshotLambda captures what a deploy of lambdaConfig can change, so
+// RestoreLambda can put it back. The code package is only downloaded when its
+// CodeSha256 differs from the package being deployed, and only the settings
+// the config manages are captured.
+func SnapshotLambda(lambdaConfig types.LambdaConfig, out console.Printer) (LambdaSnapshot, error) {
+	pkg, err := buildPackage(lambdaConfig, out)
+	if err != nil {
+		return LambdaSnapshot{}, err
+	}
+
+	snapshot, err := getLambdaSnapshot(lambdaConfig.Name, *lambdaConfig.Region, func(live lambdaTypes.FunctionConfiguration) (bool, error) {
+		return lambdaCodeChanged(lambdaConfig, live, pkg)
+	})
+	if err != nil {
+		return snapshot, err
+	}
+
+	if err := snapshotLambdaSettings(&snapshot, lambdaConfig); err != nil {
+		return snapshot, err
+	}
+
+	return snapshot, nil
+}
+
+// getLambdaSnapshot reads a function and downloads its code package, unless
+// needsCode is set and says the package isn't needed
+func getLambdaSnapshot(lambdaName string, region string, needsCode func(lambdaTypes.FunctionConfiguration) (bool, error)) (LambdaSnapshot, error) {
+	var snapshot LambdaSnapshot
+
+	ctx := context.TODO()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return snapshot, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	output, err := lambda.NewFromConfig(cfg).GetFunction(ctx, &lambda.GetFunctionInput{
+		FunctionName: aws.String(lambdaName),
+	})
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to get lambda %s: %w", lambdaName, err)
+	}
+	snapshot.Configuration = *output.Configuration
+	snapshot.Tags = output.Tags
+
+	if output.Code == nil {
+		return snapshot, fmt.Errorf("lambda %s did not return a code location", lambdaName)
+	}
+
+	if output.Code.ImageUri != nil {
+		snapshot.ImageUri = *output.Code.ImageUri
+		return snapshot, nil
+	}
+
+	if needsCode != nil {
+		changed, err := needsCode(snapshot.Configuration)
+		if err != nil {
+			return snapshot, err
+		}
+		if !changed {
+			return snapshot, nil
+		}
+	}
+
+	snapshot.ZipFile, err = download(aws.ToString(output.Code.Location))
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to download code for lambda %s: %w", lambdaName, err)
+	}
+
+	return snapshot, nil
+}
+
+// snapshotLambdaSettings adds the settings a deploy of lambdaConfig can change
+// outside the function's configuration to a snapshot. Only the ones the config
+// manages are captured, matching what the deploy touches.
+func snapshotLambdaSettings(snapshot *LambdaSnapshot, lambdaConfig types.LambdaConfig) error {
+	var err error
+
+	if len(lambdaConfig.Aliases) > 0 {
+		snapshot.Aliases, err = ListLambdaAliases(*lambdaConfig.Region, lambdaConfig.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if lambdaConfig.ReservedConcurrency != nil {
+		snapshot.ReservedConcurrency, err = GetReservedConcurrency(*lambdaConfig.Region, lambdaConfig.Name)
+		if err != nil {
+			return err
+		}
+		snapshot.ConcurrencyCaptured = true
+	}
+
+	if lambdaConfig.EventSources != nil {
+		snapshot.EventSources, err = ListEventSourceMappings(*lambdaConfig.Region, lambdaConfig.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if lambdaConfig.Schedules != nil {
+		functionArn := aws.ToString(snapshot.Configuration.FunctionArn)
+		snapshot.Schedules, err = ListLambdaSchedules(*lambdaConfig.Region, lambdaConfig.Name, functionArn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreLambda puts back the code, configuration, tags and settings captured
+// by SnapshotLambda. lambdaConfig is the
+// function's config from the deploy, which decides how the code is uploaded.
+func RestoreLambda(snapshot LambdaSnapshot, lambdaConfig types.LambdaConfig, out console.Printer) error {
+	lambdaName := aws.ToString(snapshot.Configuration.FunctionName)
+	out.Infof("Restoring lambda %s", lambdaName)
+
+	ctx := context.TODO()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(*lambdaConfig.Region))
+	if err != nil {
+		return fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	client := lambda.NewFromConfig(cfg)
+	timeout := LambdaWaitTimeout(lambdaConfig)
+
+	// A nil package means the deploy left the code alone
+	if snapshot.ImageUri != "" || snapshot.ZipFile != nil {
+		if err := restoreLambdaCode(ctx, client, snapshot, lambdaConfig, out); err != nil {
+			return err
+		}
+
+		if err := WaitForLambda(ctx, client, lambdaName, timeout, out); err != nil {
+			return err
+		}
+	}
+
+	previous := snapshot.Configuration
+	configInput := &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String(lambdaName),
+		Description:  previous.Description,
+		MemorySize:   previous.MemorySize,
+		Timeout:      previous.Timeout,
+		Role:         previous.Role,
+		Environment:  &lambdaTypes.Environment{Variables: map[string]string{}},
+	}
+	if previous.PackageType != lambdaTypes.PackageTypeImage {
+		configInput.Handler = previous.Handler
+		configInput.Runtime = previous.Runtime
+	}
+	if previous.Environment != nil && previous.Environment.Variables != nil {
+		configInput.Environment.Variables = previous.Environment.Variables
+	}
+	restoreSettings(configInput, previous)
+
+	if _, err := client.UpdateFunctionConfiguration(ctx, configInput); err != nil {
+		return fmt.Errorf("failed to restore configuration for lambda %s: %w", lambdaName, err)
+	}
+
+	if err := WaitForLambda(ctx, client, lambdaName, timeout, out); err != nil {
+		return err
+	}
+
+	if err := restoreLambdaTags(ctx, client, aws.ToString(previous.FunctionArn), snapshot.Tags); err != nil {
+		return err
+	}
+
+	if snapshot.ConcurrencyCaptured {
+		if err := restoreReservedConcurrency(ctx, client, lambdaName, snapshot.ReservedConcurrency, out); err != nil {
+			return err
+		}
+	}
+
+	// Versions are immutable, so the aliases just go back to the ones they pointed at
+	if err := restoreAliases(client, lambdaName, snapshot.Aliases, out); err != nil {
+		return err
+	}
+
+	if snapshot.EventSources != nil {
+		previousSources := lambdaConfig
+		previousSources.EventSources = []types.LambdaEventSource{}
+		for _, mapping := range snapshot.EventSources {
+			previousSources.EventSources = append(previousSources.EventSources, eventSourceFromMapping(mapping))
+		}
+		if err := SyncEventSources(previousSources, nil, out); err != nil {
+			return err
+		}
+	}
+
+	if snapshot.Schedules != nil {
+		previousSchedules := lambdaConfig
+		previousSchedules.Schedules = []types.LambdaSchedule{}
+		for name, live := range snapshot.Schedules {
+			previousSchedules.Schedules = append(previousSchedules.Schedules, scheduleFromLive(lambdaName, name, live))
+		}
+		if err := SyncSchedules(previousSchedules, aws.ToString(snapshot.Configuration.FunctionArn), out); err != nil {
+			return err
+		}
+	}
+
+	out.Infof("Restored lambda %s", lambdaName)
+	return nil
+}
+
+func restoreLambdaCode(ctx context.Context, client *lambda.Client, snapshot LambdaSnapshot, lambdaConfig types.LambdaConfig, out console.Printer) error {
+	lambdaName := aws.ToString(snapshot.Configuration.FunctionName)
+
+	codeInput := &lambda.UpdateFunctionCodeInput{
+		FunctionName:  aws.String(lambdaName),
+		Architectures: snapshot.Configuration.Architectures,
+	}
+	if snapshot.ImageUri != "" {
+		codeInput.ImageUri = aws.String(snapshot.ImageUri)
+	} else {
+		// The old package goes through the same upload path as a deploy, so
+		// packages too large to send inline are put in the codeBucket
+		pkg := &packaging.Package{ZipFile: snapshot.ZipFile, CodeSha256: aws.ToString(snapshot.Configuration.CodeSha256)}
+		code, err := lambdaCode(lambdaConfig, pkg, out)
+		if err != nil {
+			return fmt.Errorf("failed to restore code for lambda %s: %w", lambdaName, err)
+		}
+		codeInput.ZipFile = code.ZipFile
+		codeInput.S3Bucket = code.S3Bucket
+		codeInput.S3Key = code.S3Key
+		codeInput.S3ObjectVersion = code.S3ObjectVersion
+	}
+
+	if _, err := client.UpdateFunctionCode(ctx, codeInput); err != nil {
+		return fmt.Errorf("failed to restore code for lambda %s: %w", lambdaName, err)
+	}
+
+	return nil
+}
+
+// restoreLambdaTags puts back a function's previous tags and removes the ones added since
+func restoreLambdaTags(ctx context.Context, client *lambda.Client, functionArn string, previous map[string]string) error {
+	current, err := client.ListTags(ctx, &lambda.ListTagsInput{Resource: aws.String(functionArn)})
+	if err != nil {
+		return fmt.Errorf("failed to list tags of lambda %s: %w", functionArn, err)
+	}
+
+	var added []string
+	for key := range current.Tags {
+		if _, kept := previous[key]; !kept {
+			added = append(added, key)
+		}
+	}
+	if len(added) > 0 {
+		_, err := client.UntagResource(ctx, &lambda.UntagResourceInput{Resource: aws.String(functionArn), TagKeys: added})
+		if err != nil {
+			return fmt.Errorf("failed to restore tags of lambda %s: %w", functionArn, err)
+		}
+	}
+
+	if len(previous) > 0 {
+		_, err := client.TagResource(ctx, &lambda.TagResourceInput{Resource: aws.String(functionArn), Tags: previous})
+		if err != nil {
+			return fmt.Errorf("failed to restore tags of lambda %s: %w", functionArn, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreSettings copies the optional settings Labrador manages from a
+// function's previous configuration into a configuration update
+func restoreSettings(input *lambda.UpdateFunctionConfigurationInput, previous lambdaTypes.FunctionConfiguration) {
+	input.Layers = []string{}
+	for _, layer := range previous.Layers {
+		input.Layers = append(input.Layers, aws.ToString(layer.Arn))
+	}
+
+	input.EphemeralStorage = previous.EphemeralStorage
+	input.TracingConfig = &lambdaTypes.TracingConfig{Mode: lambdaTypes.TracingModePassThrough}
+	if previous.TracingConfig != nil && previous.TracingConfig.Mode != "" {
+		input.TracingConfig.Mode = previous.TracingConfig.Mode
+	}
+
+	input.VpcConfig = &lambdaTypes.VpcConfig{SubnetIds: []string{}, SecurityGroupIds: []string{}}
+	if previous.VpcConfig != nil && len(previous.VpcConfig.SubnetIds) > 0 {
+		input.VpcConfig.SubnetIds = previous.VpcConfig.SubnetIds
+		input.VpcConfig.SecurityGroupIds = previous.VpcConfig.SecurityGroupIds
+	}
+
+	input.DeadLetterConfig = &lambdaTypes.DeadLetterConfig{TargetArn: aws.String("")}
+	if previous.DeadLetterConfig != nil {
+		input.DeadLetterConfig.TargetArn = aws.String(aws.ToString(previous.DeadLetterConfig.TargetArn))
+	}
+
+	input.KMSKeyArn = aws.String(aws.ToString(previous.KMSKeyArn))
+	input.LoggingConfig = previous.LoggingConfig
+}
+
+// RestoreBucket puts back the settings captured by GetBucketSettings
+func RestoreBucket(previous types.S3Settings, out console.Printer) error {
+	out.Infof("Restoring bucket %s", *previous.Name)
+
+	ctx, cfg, err := GetConfig(*previous.Region)
+	if err != nil {
+		return err
+	}
+	client := GetClient(cfg)
+
+	// An empty tag set is rejected by PutBucketTagging, so clear the tags instead
+	if len(previous.Tags) == 0 {
+		_, err = client.DeleteBucketTagging(ctx, &s3.DeleteBucketTaggingInput{
+			Bucket: previous.Name,
+		})
+	} else {
+		err = setTags(ctx, *client, &previous)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore tags on bucket %s: %w", *previous.Name, err)
+	}
+
+	if err := setVersioning(ctx, *client, previous); err != nil {
+		return err
+	}
+
+	if err := blockPublicAccess(ctx, *client, &previous); err != nil {
+		return err
+	}
+
+	out.Infof("Restored bucket %s", *previous.Name)
+	return nil
+}
+
+// RestoreApiGateway replaces the routes and integrations on an API with the ones
+// captured by GetApiGateway
+func RestoreApiGateway(previous LiveApiGateway, region string, out console.Printer) error {
+	out.Infof("Restoring API %s", previous.ApiId)
+
+	ctx := context.TODO()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	client := apigatewayv2.NewFromConfig(cfg)
+
+	_, err = client.UpdateApi(ctx, &apigatewayv2.UpdateApiInput{
+		ApiId:       aws.String(previous.ApiId),
+		Description: aws.String(previous.Description),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore API %s: %w", previous.ApiId, err)
+	}
+
+	currentRoutes, err := ListRoutes(&ctx, client, previous.ApiId)
+	if err != nil {
+		return err
+	}
+
+	currentIntegrations, err := listIntegrations(&ctx, client, previous.ApiId)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteRoutes(currentRoutes, ctx, client, previous.ApiId, out); err != nil {
+		return err
+	}
+	deleteIntegrations(&currentIntegrations, &ctx, client, previous.ApiId, out)
+
+	// Integration IDs change when they're recreated, so routes are pointed at the new ones
+	integrationIds := make(map[string]string)
+	for oldId, integration := range previous.Integrations {
+		created, err := client.CreateIntegration(ctx, &apigatewayv2.CreateIntegrationInput{
+			ApiId:                aws.String(previous.ApiId),
+			IntegrationType:      integration.IntegrationType,
+			IntegrationUri:       integration.IntegrationUri,
+			IntegrationMethod:    integration.IntegrationMethod,
+			PayloadFormatVersion: integration.PayloadFormatVersion,
+			ConnectionType:       integration.ConnectionType,
+			ConnectionId:         integration.ConnectionId,
+			TimeoutInMillis:      integration.TimeoutInMillis,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to restore integration %s: %w", oldId, err)
+		}
+		integrationIds[oldId] = aws.ToString(created.IntegrationId)
+		out.Infof("Restored integration %s", aws.ToString(integration.IntegrationUri))
+	}
+
+	for routeKey, route := range previous.Routes {
+		input := &apigatewayv2.CreateRouteInput{
+			ApiId:             aws.String(previous.ApiId),
+			RouteKey:          aws.String(routeKey),
+			AuthorizationType: route.AuthorizationType,
+			AuthorizerId:      route.AuthorizerId,
+			ApiKeyRequired:    route.ApiKeyRequired,
+		}
+
+		if target := aws.ToString(route.Target); target != "" {
+			oldId := strings.TrimPrefix(target, "integrations/")
+			if newId, exists := integrationIds[oldId]; exists {
+				input.Target = aws.String("integrations/" + newId)
+			} else {
+				input.Target = route.Target
+			}
+		}
+
+		if _, err := client.CreateRoute(ctx, input); err != nil {
+			return fmt.Errorf("failed to restore route %s: %w", routeKey, err)
+		}
+		out.Infof("Restored route %s", routeKey)
+	}
+
+	out.Infof("Restored API %s", previous.ApiId)
+	return nil
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,149 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DQGriffin/labrador/pkg/types"
+)
+
+const defaultLockExpiry = time.Hour
+
+// Backend stores the state file and the lock that guards it
+type Backend interface {
+	// Read returns the raw state, or nil if no state has been written yet
+	Read() ([]byte, error)
+	Write(data []byte) error
+
+	Lock(info LockInfo) error
+	// Unlock releases the lock if it is the one with the given ID
+	Unlock(id string) error
+	// ForceUnlock releases the lock regardless of who holds it
+	ForceUnlock() error
+
+	Describe() string
+}
+
+// LockInfo is stored alongside the state while a lock is held. Owner is for
+// people to read; ID is unique to the process that took the lock, so two jobs
+// running as the same owner can't release each other's locks.
+type LockInfo struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Operation string    `json:"operation"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+func (l LockInfo) IsExpired() bool {
+	return !l.Expires.IsZero() && time.Now().After(l.Expires)
+}
+
+// LockedError is returned when a lock is already held by someone else
+type LockedError struct {
+	Info LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("state is locked by %s for %q since %s (expires %s)",
+		e.Info.Owner, e.Info.Operation, e.Info.Created.Format(time.RFC3339), e.Info.Expires.Format(time.RFC3339))
+}
+
+// NewBackend builds the backend selected in the project config. Projects that
+// don't configure one get a local file under .labrador/state.
+func NewBackend(config *types.StateConfig, project, env string) (Backend, error) {
+	if config == nil || config.Backend == "" || config.Backend == "local" {
+		path := DefaultPath(project, env)
+		if config != nil && config.Path != "" {
+			path = envPath(config.Path, env)
+		}
+		return NewLocalBackend(path), nil
+	}
+
+	if config.Backend == "s3" {
+		if config.Bucket == "" {
+			return nil, fmt.Errorf("s3 state backend requires a bucket")
+		}
+
+		key := fmt.Sprintf("labrador/%s/%s.json", sanitize(project), sanitize(env))
+		if config.Key != "" {
+			key = envPath(config.Key, env)
+		}
+
+		region := os.Getenv("AWS_REGION")
+		if config.Region != "" {
+			region = config.Region
+		}
+
+		return NewS3Backend(config.Bucket, key, region), nil
+	}
+
+	return nil, fmt.Errorf("unknown state backend: %s", config.Backend)
+}
+
+// NewLockInfo describes a lock taken by the current user for an operation
+func NewLockInfo(operation string, config *types.StateConfig) LockInfo {
+	expiry := defaultLockExpiry
+	if config != nil && config.LockExpiry > 0 {
+		expiry = time.Duration(config.LockExpiry) * time.Second
+	}
+
+	now := time.Now().UTC()
+	return LockInfo{
+		ID:        newLockID(),
+		Owner:     LockOwner(),
+		Operation: operation,
+		Created:   now,
+		Expires:   now.Add(expiry),
+	}
+}
+
+// LockOwner identifies who is taking a lock. CI jobs can set LABRADOR_LOCK_OWNER
+// to something more meaningful than the runner's user and hostname.
+func LockOwner() string {
+	if owner := os.Getenv("LABRADOR_LOCK_OWNER"); owner != "" {
+		return owner
+	}
+
+	user := os.Getenv("USER")
+	if user == "" {
+		user = os.Getenv("USERNAME")
+	}
+	if user == "" {
+		user = "unknown"
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s@%s", user, host)
+}
+
+// newLockID is the process ID plus a random token, so it is unique even
+// across CI jobs that run on the same runner
+func newLockID() string {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%d-%s", os.Getpid(), hex.EncodeToString(token))
+}
+
+// envPath gives each environment its own state file when the path or key is
+// configured. {{env}} is replaced with the environment, and a path without it
+// gets the environment added before its extension, e.g. state.json -> state.prod.json.
+func envPath(path, env string) string {
+	if strings.Contains(path, "{{env}}") {
+		return strings.ReplaceAll(path, "{{env}}", sanitize(env))
+	}
+
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + sanitize(env) + ext
+}
@@ -0,0 +1,157 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LocalBackend keeps state in a file on disk. The lock is a sibling file
+// created exclusively, so it survives the process and can be inspected or
+// removed by `labrador state unlock`.
+type LocalBackend struct {
+	Path string
+}
+
+func NewLocalBackend(path string) *LocalBackend {
+	return &LocalBackend{Path: path}
+}
+
+func (b *LocalBackend) Describe() string {
+	return b.Path
+}
+
+func (b *LocalBackend) Read() ([]byte, error) {
+	data, err := os.ReadFile(b.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read state file %s: %w", b.Path, err)
+	}
+
+	return data, nil
+}
+
+func (b *LocalBackend) Write(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a half written state file
+	tmpPath := b.Path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return os.Rename(tmpPath, b.Path)
+}
+
+func (b *LocalBackend) Lock(info LockInfo) error {
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	acquired, err := b.tryLock(data)
+	if err != nil || acquired {
+		return err
+	}
+
+	existing, err := b.readLock()
+	if err != nil {
+		return err
+	}
+
+	if existing == nil || !existing.IsExpired() {
+		if existing == nil {
+			return fmt.Errorf("state lock %s exists but could not be read", b.lockPath())
+		}
+		return &LockedError{Info: *existing}
+	}
+
+	// The previous holder never released the lock and it has expired, take it over
+	if err := os.Remove(b.lockPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove expired lock: %w", err)
+	}
+
+	acquired, err = b.tryLock(data)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return fmt.Errorf("state lock %s was taken by someone else", b.lockPath())
+	}
+
+	return nil
+}
+
+func (b *LocalBackend) Unlock(id string) error {
+	existing, err := b.readLock()
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		return nil
+	}
+
+	if existing.ID != id {
+		return fmt.Errorf("state lock %s is held by %s, not by this lock. Use force-unlock to release it", existing.ID, existing.Owner)
+	}
+
+	return b.ForceUnlock()
+}
+
+func (b *LocalBackend) ForceUnlock() error {
+	err := os.Remove(b.lockPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove lock %s: %w", b.lockPath(), err)
+	}
+
+	return nil
+}
+
+func (b *LocalBackend) lockPath() string {
+	return b.Path + ".lock"
+}
+
+func (b *LocalBackend) tryLock(data []byte) (bool, error) {
+	file, err := os.OpenFile(b.lockPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create lock %s: %w", b.lockPath(), err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return false, fmt.Errorf("failed to write lock %s: %w", b.lockPath(), err)
+	}
+
+	return true, nil
+}
+
+func (b *LocalBackend) readLock() (*LockInfo, error) {
+	data, err := os.ReadFile(b.lockPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read lock %s: %w", b.lockPath(), err)
+	}
+
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode lock %s: %w", b.lockPath(), err)
+	}
+
+	return &info, nil
+}
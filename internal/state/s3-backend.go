@@ -0,0 +1,144 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/DQGriffin/labrador/internal/services/aws"
+)
+
+// S3Backend keeps state in an S3 object. The lock is a second object that is
+// written with a conditional put, so only one writer can ever create it.
+type S3Backend struct {
+	Bucket string
+	Key    string
+	Region string
+}
+
+func NewS3Backend(bucket, key, region string) *S3Backend {
+	return &S3Backend{
+		Bucket: bucket,
+		Key:    key,
+		Region: region,
+	}
+}
+
+func (b *S3Backend) Describe() string {
+	return fmt.Sprintf("s3://%s/%s", b.Bucket, b.Key)
+}
+
+func (b *S3Backend) Read() ([]byte, error) {
+	ctx, cfg, err := aws.GetConfig(b.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	return aws.GetObject(ctx, aws.GetClient(cfg), b.Bucket, b.Key)
+}
+
+func (b *S3Backend) Write(data []byte) error {
+	ctx, cfg, err := aws.GetConfig(b.Region)
+	if err != nil {
+		return err
+	}
+
+	_, putErr := aws.PutObject(ctx, aws.GetClient(cfg), b.Bucket, b.Key, data, nil)
+	return putErr
+}
+
+func (b *S3Backend) Lock(info LockInfo) error {
+	ctx, cfg, err := aws.GetConfig(b.Region)
+	if err != nil {
+		return err
+	}
+	client := aws.GetClient(cfg)
+
+	data, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	metadata := map[string]string{
+		"owner":   info.Owner,
+		"expires": info.Expires.Format(time.RFC3339),
+	}
+
+	acquired, err := aws.PutObjectIfAbsent(ctx, client, b.Bucket, b.lockKey(), data, metadata)
+	if err != nil || acquired {
+		return err
+	}
+
+	existing, err := b.readLock()
+	if err != nil {
+		return err
+	}
+
+	if existing != nil && !existing.IsExpired() {
+		return &LockedError{Info: *existing}
+	}
+
+	// The previous holder never released the lock and it has expired, take it over
+	if err := aws.DeleteObject(ctx, client, b.Bucket, b.lockKey()); err != nil {
+		return err
+	}
+
+	acquired, err = aws.PutObjectIfAbsent(ctx, client, b.Bucket, b.lockKey(), data, metadata)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return fmt.Errorf("state lock s3://%s/%s was taken by someone else", b.Bucket, b.lockKey())
+	}
+
+	return nil
+}
+
+func (b *S3Backend) Unlock(id string) error {
+	existing, err := b.readLock()
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		return nil
+	}
+
+	if existing.ID != id {
+		return fmt.Errorf("state lock %s is held by %s, not by this lock. Use force-unlock to release it", existing.ID, existing.Owner)
+	}
+
+	return b.ForceUnlock()
+}
+
+func (b *S3Backend) ForceUnlock() error {
+	ctx, cfg, err := aws.GetConfig(b.Region)
+	if err != nil {
+		return err
+	}
+
+	return aws.DeleteObject(ctx, aws.GetClient(cfg), b.Bucket, b.lockKey())
+}
+
+func (b *S3Backend) lockKey() string {
+	return b.Key + ".lock"
+}
+
+func (b *S3Backend) readLock() (*LockInfo, error) {
+	ctx, cfg, err := aws.GetConfig(b.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := aws.GetObject(ctx, aws.GetClient(cfg), b.Bucket, b.lockKey())
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode lock s3://%s/%s: %w", b.Bucket, b.lockKey(), err)
+	}
+
+	return &info, nil
+}
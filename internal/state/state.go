@@ -0,0 +1,215 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stateVersion = 1
+	stateDir     = ".labrador/state"
+)
+
+// ResourceState records a single resource that Labrador created or took over
+type ResourceState struct {
+	Type       string    `json:"type"`
+	Name       string    `json:"name"`
+	Stage      string    `json:"stage"`
+	Arn        string    `json:"arn,omitempty"`
+	Id         string    `json:"id,omitempty"`
+	Region     string    `json:"region"`
+	ConfigHash string    `json:"configHash"`
+	OnDelete   string    `json:"onDelete,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// State is the set of resources Labrador owns for a single project + environment
+type State struct {
+	Version     int                      `json:"version"`
+	Project     string                   `json:"project"`
+	Environment string                   `json:"environment"`
+	Resources   map[string]ResourceState `json:"resources"`
+
+	backend Backend
+	lock    *LockInfo
+	// mu guards Resources, which deploys update from several goroutines
+	mu sync.Mutex
+}
+
+// DefaultPath returns the location of the local state file for a project + environment
+func DefaultPath(project, env string) string {
+	return filepath.Join(stateDir, fmt.Sprintf("%s.%s.json", sanitize(project), sanitize(env)))
+}
+
+// Load reads the state from the backend. Missing state is not an error, it just
+// means Labrador doesn't own anything yet.
+func Load(backend Backend, project, env string) (*State, error) {
+	s := &State{
+		Version:     stateVersion,
+		Project:     project,
+		Environment: env,
+		Resources:   make(map[string]ResourceState),
+		backend:     backend,
+	}
+
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// LockAndLoad takes the state lock before reading, so nobody else can change
+// the state between the read and our writes
+func LockAndLoad(backend Backend, project, env string, info LockInfo) (*State, error) {
+	if err := backend.Lock(info); err != nil {
+		return nil, err
+	}
+
+	s, err := Load(backend, project, env)
+	if err != nil {
+		backend.Unlock(info.ID)
+		return nil, err
+	}
+
+	s.lock = &info
+	return s, nil
+}
+
+// Unlock releases the lock taken by LockAndLoad. It is a no-op for unlocked state.
+func (s *State) Unlock() error {
+	if s.lock == nil {
+		return nil
+	}
+
+	err := s.backend.Unlock(s.lock.ID)
+	if err == nil {
+		s.lock = nil
+	}
+	return err
+}
+
+func (s *State) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save()
+}
+
+func (s *State) save() error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	return s.backend.Write(data)
+}
+
+// Location describes where the state is stored
+func (s *State) Location() string {
+	return s.backend.Describe()
+}
+
+func (s *State) Get(resourceType, name string) (ResourceState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resource, exists := s.Resources[key(resourceType, name)]
+	return resource, exists
+}
+
+func (s *State) IsManaged(resourceType, name string) bool {
+	_, exists := s.Get(resourceType, name)
+	return exists
+}
+
+// StageResources returns the resources recorded against a stage, sorted by name
+func (s *State) StageResources(stageName string) []ResourceState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resources []ResourceState
+	for _, resource := range s.Resources {
+		if resource.Stage == stageName {
+			resources = append(resources, resource)
+		}
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Name < resources[j].Name
+	})
+
+	return resources
+}
+
+// Record adds or replaces a resource and persists the state file
+func (s *State) Record(resource ResourceState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resource.UpdatedAt = time.Now().UTC()
+	s.Resources[key(resource.Type, resource.Name)] = resource
+	return s.save()
+}
+
+// Remove drops a resource and persists the state file
+func (s *State) Remove(resourceType, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.Resources, key(resourceType, name))
+	return s.save()
+}
+
+// HashConfig returns a stable hash of the config that produced a resource
+func HashConfig(config any) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *State) read() error {
+	data, err := s.backend.Read()
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return fmt.Errorf("failed to decode state from %s: %w", s.backend.Describe(), err)
+	}
+
+	if s.Resources == nil {
+		s.Resources = make(map[string]ResourceState)
+	}
+
+	return nil
+}
+
+func key(resourceType, name string) string {
+	return resourceType + "/" + name
+}
+
+func sanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+}
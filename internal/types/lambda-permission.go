@@ -6,4 +6,5 @@ type LambdaPermission struct {
 	Principal    string
 	StatementId  string
 	SourceArn    string
+	Qualifier    string
 }
@@ -4,6 +4,8 @@ type UniversalResourceDefinition struct {
 	StageName    string `json:"stageName"`
 	Name         string `json:"name"`
 	Arn          string `json:"arn"`
+	Id           string `json:"id,omitempty"`
 	ResourceType string `json:"resourceType"`
 	Region       string `json:"region"`
+	SkipReason   string `json:"skipReason,omitempty"`
 }
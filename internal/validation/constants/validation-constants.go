@@ -1,3 +1,19 @@
 package constants
 
-var CONFLICT_RESOLUTION_OPTIONS = []string{"stop", "continue", "rollback"}
+// onConflict decides what a deploy does with an existing resource Labrador doesn't manage
+const (
+	ON_CONFLICT_STOP   = "stop"
+	ON_CONFLICT_UPDATE = "update"
+	ON_CONFLICT_SKIP   = "skip"
+)
+
+var CONFLICT_RESOLUTION_OPTIONS = []string{ON_CONFLICT_STOP, ON_CONFLICT_UPDATE, ON_CONFLICT_SKIP}
+
+// onError decides what a deploy does when a resource in the stage fails
+const (
+	ON_ERROR_STOP     = "stop"
+	ON_ERROR_SKIP     = "skip"
+	ON_ERROR_ROLLBACK = "rollback"
+)
+
+var ERROR_RESOLUTION_OPTIONS = []string{ON_ERROR_STOP, ON_ERROR_SKIP, ON_ERROR_ROLLBACK}
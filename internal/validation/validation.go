@@ -1,11 +1,23 @@
 package validation
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 
+	"github.com/DQGriffin/labrador/internal/graph"
+	"github.com/DQGriffin/labrador/internal/validation/constants"
 	"github.com/DQGriffin/labrador/pkg/types"
 )
 
+var (
+	aliasNamePattern    = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+	versionPattern      = regexp.MustCompile(`^[0-9]+$`)
+	scheduleNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+)
+
 func ValidateProject(project types.Project) []error {
 	var errs []error
 	for _, stage := range project.Stages {
@@ -25,31 +37,316 @@ func ValidateProject(project types.Project) []error {
 		}
 	}
 
+	stateErr := validateStateConfig(project.State)
+	if stateErr != nil {
+		errs = append(errs, fmt.Errorf("state: %w", stateErr))
+	}
+
 	return errs
 }
 
-func validateConflictResolution(value string) error {
-	switch value {
-	case "stop":
+// ValidateStageDependencies checks that every dependsOn names a real stage and
+// that the dependencies don't form a cycle. It runs after interpolation since
+// stage names can contain variables.
+func ValidateStageDependencies(stages []types.Stage) error {
+	_, err := graph.OrderStages(stages)
+	return err
+}
+
+// ValidateRefDependencies checks that every stage targeting a function by ref
+// depends on the stage that defines it. Refs resolve to ARNs before anything is
+// deployed, so without the dependency the stage could run before the function
+// exists. It runs once the stage configs have been read.
+func ValidateRefDependencies(stages []types.Stage) []error {
+	g, err := graph.NewStageGraph(stages)
+	if err != nil {
+		return []error{err}
+	}
+
+	defined := make(map[string]string)
+	for _, stage := range stages {
+		for _, fnConfig := range stage.Functions {
+			for _, fn := range fnConfig.Functions {
+				if fn.Ref != nil && *fn.Ref != "" {
+					defined[*fn.Ref] = stage.Name
+				}
+			}
+		}
+	}
+
+	var errs []error
+	check := func(stage types.Stage, target types.ResourceTarget) {
+		if target.Ref == nil || *target.Ref == "" {
+			return
+		}
+
+		owner, exists := defined[*target.Ref]
+		if !exists || owner == stage.Name || g.DependsOn(stage.Name, owner) {
+			return
+		}
+		errs = append(errs, fmt.Errorf("stage %q uses ref %q, so it must depend on stage %q", stage.Name, *target.Ref, owner))
+	}
+
+	for _, stage := range stages {
+		for _, gatewayConfig := range stage.Gateways {
+			for _, gateway := range gatewayConfig.Gateways {
+				for _, integration := range gateway.Integrations {
+					check(stage, integration.Target)
+				}
+			}
+		}
+
+		for _, s3Config := range stage.Buckets {
+			for _, bucket := range s3Config.Buckets {
+				for _, notification := range bucket.Notifications {
+					check(stage, notification.Target)
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+// ValidateStageToggles checks that every stage's enabled setting is true or
+// false once its variables have been resolved
+func ValidateStageToggles(stages []types.Stage) error {
+	for _, stage := range stages {
+		if _, err := stage.IsEnabled(); err != nil {
+			return fmt.Errorf("stage %s: enabled %s", stage.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+func validateLoggingConfig(logging types.LambdaLoggingConfig) []error {
+	var errs []error
+
+	format := "Text"
+	if logging.LogFormat != nil {
+		format = *logging.LogFormat
+		if err := validateOption("loggingConfig.logFormat", format, []string{"JSON", "Text"}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	levels := []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+	if logging.ApplicationLogLevel != nil {
+		if err := validateOption("loggingConfig.applicationLogLevel", *logging.ApplicationLogLevel, levels); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if logging.SystemLogLevel != nil {
+		if err := validateOption("loggingConfig.systemLogLevel", *logging.SystemLogLevel, []string{"DEBUG", "INFO", "WARN"}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if format != "JSON" && (logging.ApplicationLogLevel != nil || logging.SystemLogLevel != nil) {
+		errs = append(errs, fmt.Errorf("log levels require loggingConfig.logFormat JSON"))
+	}
+
+	return errs
+}
+
+func validateAliases(aliases []types.LambdaAlias) []error {
+	var errs []error
+
+	seen := make(map[string]bool)
+	for _, alias := range aliases {
+		if !aliasNamePattern.MatchString(alias.Name) || versionPattern.MatchString(alias.Name) {
+			errs = append(errs, fmt.Errorf("alias %q must contain only letters, numbers, - and _, and can't be a version number", alias.Name))
+		}
+
+		if seen[alias.Name] {
+			errs = append(errs, fmt.Errorf("alias %q is declared more than once", alias.Name))
+		}
+		seen[alias.Name] = true
+
+		if alias.RoutingConfig != nil && (alias.RoutingConfig.Weight <= 0 || alias.RoutingConfig.Weight >= 1) {
+			errs = append(errs, fmt.Errorf("alias %q: routingConfig.weight must be between 0 and 1", alias.Name))
+		}
+	}
+
+	return errs
+}
+
+func validateEventSource(source types.LambdaEventSource) []error {
+	var errs []error
+
+	hasArn := source.SourceArn != nil && *source.SourceArn != ""
+	if hasArn == (source.Source != nil) {
+		errs = append(errs, fmt.Errorf("set either sourceArn or source"))
+	}
+
+	if source.Source != nil && source.Source.Ref != nil && *source.Source.Ref != "" {
+		errs = append(errs, fmt.Errorf("source can't be a ref, refs point at functions"))
+	}
+
+	if source.BatchSize != nil && (*source.BatchSize < 1 || *source.BatchSize > 10000) {
+		errs = append(errs, fmt.Errorf("batchSize must be between 1 and 10000"))
+	}
+
+	if source.BatchingWindow != nil && *source.BatchingWindow > 300 {
+		errs = append(errs, fmt.Errorf("batchingWindow must be 300 seconds or less"))
+	}
+
+	if source.StartingPosition != nil {
+		if err := validateOption("startingPosition", *source.StartingPosition, []string{"LATEST", "TRIM_HORIZON"}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if source.FailureDestination != nil {
+		if !strings.HasPrefix(*source.FailureDestination, "arn:") {
+			errs = append(errs, fmt.Errorf("failureDestination must be an ARN"))
+		}
+		if hasArn && strings.HasPrefix(*source.SourceArn, "arn:aws:sqs:") {
+			errs = append(errs, fmt.Errorf("failureDestination isn't supported for SQS sources, use the queue's redrive policy"))
+		}
+	}
+
+	for _, pattern := range source.FilterCriteria {
+		var value map[string]any
+		if err := json.Unmarshal(pattern, &value); err != nil {
+			errs = append(errs, fmt.Errorf("filterCriteria entries must be JSON objects"))
+			break
+		}
+	}
+
+	return errs
+}
+
+// eventSourceKey identifies the queue or stream an event source reads from
+func eventSourceKey(source types.LambdaEventSource) string {
+	if source.SourceArn != nil && *source.SourceArn != "" {
+		return *source.SourceArn
+	}
+
+	if source.Source == nil || source.Source.External == nil {
+		return ""
+	}
+	if source.Source.External.Arn != nil && *source.Source.External.Arn != "" {
+		return *source.Source.External.Arn
+	}
+	if dynamic := source.Source.External.Dynamic; dynamic != nil {
+		return dynamic.Type + "/" + dynamic.Region + "/" + dynamic.Name
+	}
+	return ""
+}
+
+func validateSchedules(lambdaName string, schedules []types.LambdaSchedule) []error {
+	var errs []error
+
+	seen := make(map[string]bool)
+	for _, schedule := range schedules {
+		if !scheduleNamePattern.MatchString(schedule.Name) {
+			errs = append(errs, fmt.Errorf("schedule %q must contain only letters, numbers, ., - and _", schedule.Name))
+		}
+
+		// Rules and schedules are named <function>-<schedule>, and both are limited to 64 characters
+		if len(lambdaName)+1+len(schedule.Name) > 64 {
+			errs = append(errs, fmt.Errorf("schedule %q: the function and schedule names together must be under 64 characters", schedule.Name))
+		}
+
+		if seen[schedule.Name] {
+			errs = append(errs, fmt.Errorf("schedule %q is declared more than once", schedule.Name))
+		}
+		seen[schedule.Name] = true
+
+		hasTimezone := schedule.Timezone != nil && *schedule.Timezone != ""
+		// One-time at() schedules only exist in Scheduler
+		isAt := strings.HasPrefix(schedule.Expression, "at(")
+		if !isAt && !strings.HasPrefix(schedule.Expression, "rate(") && !strings.HasPrefix(schedule.Expression, "cron(") {
+			errs = append(errs, fmt.Errorf("schedule %q: expression must be rate(...), cron(...) or at(...)", schedule.Name))
+		} else if isAt && !hasTimezone {
+			errs = append(errs, fmt.Errorf("schedule %q: at() expressions need a timezone", schedule.Name))
+		}
+
+		if hasTimezone && (schedule.RoleArn == nil || *schedule.RoleArn == "") {
+			errs = append(errs, fmt.Errorf("schedule %q: roleArn is required for schedules with a timezone", schedule.Name))
+		}
+	}
+
+	return errs
+}
+
+// ValidateBuckets checks the settings of every bucket once defaults have been applied
+func ValidateBuckets(s3Config types.S3Config) []error {
+	var errs []error
+
+	for _, bucket := range s3Config.Buckets {
+		name := ""
+		if bucket.Name != nil {
+			name = *bucket.Name
+		}
+
+		for i, notification := range bucket.Notifications {
+			for _, err := range validateNotification(notification) {
+				errs = append(errs, fmt.Errorf("bucket %q: notifications[%d]: %w", name, i, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateNotification(notification types.S3Notification) []error {
+	var errs []error
+
+	if len(notification.Events) == 0 {
+		errs = append(errs, fmt.Errorf("events is required"))
+	}
+	for _, event := range notification.Events {
+		if !strings.HasPrefix(event, "s3:") {
+			errs = append(errs, fmt.Errorf("event %q must be an S3 event type, e.g. s3:ObjectCreated:*", event))
+		}
+	}
+
+	target := notification.Target
+	hasRef := target.Ref != nil && *target.Ref != ""
+	if !hasRef && target.External == nil {
+		errs = append(errs, fmt.Errorf("target needs a ref or an external lambda"))
+	}
+	if target.External != nil && target.External.Dynamic != nil && target.External.Dynamic.Type != "lambda" {
+		errs = append(errs, fmt.Errorf("target must be a lambda"))
+	}
+
+	return errs
+}
+
+func validateStateConfig(config *types.StateConfig) error {
+	if config == nil {
 		return nil
-	case "update":
+	}
+
+	switch config.Backend {
+	case "", "local":
+		return nil
+	case "s3":
+		if config.Bucket == "" {
+			return fmt.Errorf("bucket is required for the s3 backend")
+		}
 		return nil
 	default:
-		return fmt.Errorf("onConflict must be one of: stop, update, skip")
+		return fmt.Errorf("backend must be one of: local, s3")
 	}
 }
 
+func validateConflictResolution(value string) error {
+	return validateOption("onConflict", value, constants.CONFLICT_RESOLUTION_OPTIONS)
+}
+
 func validateErrorResolution(value string) error {
-	switch value {
-	case "stop":
-		return nil
-	case "skip":
-		return nil
-	case "rollback":
+	return validateOption("onError", value, constants.ERROR_RESOLUTION_OPTIONS)
+}
+
+func validateOption(field string, value string, options []string) error {
+	if slices.Contains(options, value) {
 		return nil
-	default:
-		return fmt.Errorf("onError must be one of: stop, skip, rollback")
 	}
+	return fmt.Errorf("%s must be one of: %s", field, strings.Join(options, ", "))
 }
 
 // TODO: Refactor this
@@ -66,10 +363,92 @@ func validateStageType(value string) error {
 	}
 }
 
+// ValidateFunctions checks the settings of every function once defaults have been applied
 func ValidateFunctions(functionData types.LambdaData) []error {
 	var errs []error
 
-	// Not yet implemented
+	for _, fn := range functionData.Functions {
+		for _, err := range validateFunction(fn) {
+			errs = append(errs, fmt.Errorf("lambda %q: %w", fn.Name, err))
+		}
+	}
+
+	return errs
+}
+
+func validateFunction(fn types.LambdaConfig) []error {
+	var errs []error
+
+	if fn.PackageType != nil {
+		if err := validateOption("packageType", *fn.PackageType, []string{"Zip", "Image"}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if fn.Architecture != nil {
+		if err := validateOption("architecture", *fn.Architecture, []string{"x86_64", "arm64"}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if fn.EphemeralStorage != nil && (*fn.EphemeralStorage < 512 || *fn.EphemeralStorage > 10240) {
+		errs = append(errs, fmt.Errorf("ephemeralStorage must be between 512 and 10240 MB"))
+	}
+
+	if fn.TracingConfig != nil {
+		if err := validateOption("tracingConfig.mode", fn.TracingConfig.Mode, []string{"Active", "PassThrough"}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if fn.DeadLetterConfig != nil && !strings.HasPrefix(fn.DeadLetterConfig.TargetArn, "arn:") {
+		errs = append(errs, fmt.Errorf("deadLetterConfig.targetArn must be the ARN of an SQS queue or SNS topic"))
+	}
+
+	if fn.LoggingConfig != nil {
+		errs = append(errs, validateLoggingConfig(*fn.LoggingConfig)...)
+	}
+
+	if len(fn.Aliases) > 0 {
+		errs = append(errs, validateAliases(fn.Aliases)...)
+	}
+
+	if len(fn.Schedules) > 0 {
+		errs = append(errs, validateSchedules(fn.Name, fn.Schedules)...)
+	}
+
+	seenSources := make(map[string]bool)
+	for i, source := range fn.EventSources {
+		for _, err := range validateEventSource(source) {
+			errs = append(errs, fmt.Errorf("eventSources[%d]: %w", i, err))
+		}
+
+		// Lambda keys mappings by source, so a function can only poll each once
+		key := eventSourceKey(source)
+		if key != "" && seenSources[key] {
+			errs = append(errs, fmt.Errorf("eventSources[%d]: the same source is listed more than once", i))
+		}
+		seenSources[key] = true
+	}
+
+	if fn.IsImage() {
+		if fn.ImageUri == nil || *fn.ImageUri == "" {
+			errs = append(errs, fmt.Errorf("imageUri is required for image functions"))
+		}
+		if fn.Handler != nil {
+			errs = append(errs, fmt.Errorf("handler can't be set on image functions, use imageConfig.command instead"))
+		}
+		if fn.Runtime != nil {
+			errs = append(errs, fmt.Errorf("runtime can't be set on image functions"))
+		}
+		if fn.Code != nil {
+			errs = append(errs, fmt.Errorf("code can't be set on image functions, use imageUri instead"))
+		}
+	} else {
+		if fn.ImageUri != nil || fn.ImageConfig != nil {
+			errs = append(errs, fmt.Errorf("imageUri and imageConfig require packageType Image"))
+		}
+	}
 
 	return errs
 }
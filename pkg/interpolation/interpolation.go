@@ -17,6 +17,10 @@ func InterpolateProjectVariables(project *types.Project) {
 		InterpolateStage(&project.Stages[i], project.Variables)
 	}
 
+	if project.State != nil {
+		Interpolate(project.State, project.Variables)
+	}
+
 }
 
 func ResolveVariable(value string, vars map[string]string) string {
@@ -37,6 +41,13 @@ func InterpolateStage(stage *types.Stage, vars map[string]string) {
 	stage.ConfigFile = ResolveVariable(stage.ConfigFile, vars)
 	stage.OnConflict = ResolveVariable(stage.OnConflict, vars)
 	stage.OnError = ResolveVariable(stage.OnError, vars)
+	if stage.Enabled != nil {
+		enabled := types.Toggle(ResolveVariable(string(*stage.Enabled), vars))
+		stage.Enabled = &enabled
+	}
+	for i := range stage.DependsOn {
+		stage.DependsOn[i] = ResolveVariable(stage.DependsOn[i], vars)
+	}
 	if stage.Hooks != nil {
 		for i := range stage.Hooks.PreDeploy {
 			stage.Hooks.PreDeploy[i] = ResolveVariable(stage.Hooks.PreDeploy[i], vars)
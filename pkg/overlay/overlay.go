@@ -0,0 +1,196 @@
+package overlay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sources records the file each value in a merged config came from. Keys are
+// dotted JSON paths, with list entries addressed by index, e.g. functions.0.memory
+type Sources map[string]string
+
+// FilePath returns the overlay for a config file in an environment,
+// e.g. stages/lambdas.json -> stages/lambdas.prod.json
+func FilePath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// Read decodes a config file into target, deep-merging the overlay for env on
+// top of it if one exists. Objects are merged key by key, lists of objects with
+// a name are merged by name, and anything else in the overlay replaces the base value.
+func Read(path, env string, target any) (Sources, error) {
+	base, err := readDocument(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(Sources)
+	sources.record(base, "", path)
+
+	if env != "" {
+		overlayPath := FilePath(path, env)
+		overlay, err := readDocument(overlayPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		if err == nil {
+			base = merge(base, overlay, "", overlayPath, sources)
+		}
+	}
+
+	data, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	return sources, nil
+}
+
+// Origin returns the file a value came from. For an object or list, it lists
+// every file that contributed to it. It returns "" if the value isn't set.
+func (s Sources) Origin(path string) string {
+	if file, exists := s[path]; exists {
+		return file
+	}
+
+	seen := make(map[string]bool)
+	for key, file := range s {
+		if strings.HasPrefix(key, path+".") {
+			seen[file] = true
+		}
+	}
+
+	files := make([]string, 0, len(seen))
+	for file := range seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	return strings.Join(files, ", ")
+}
+
+func readDocument(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	return document, nil
+}
+
+func merge(base, overlay any, path, file string, sources Sources) any {
+	baseObject, baseIsObject := base.(map[string]any)
+	overlayObject, overlayIsObject := overlay.(map[string]any)
+	if baseIsObject && overlayIsObject {
+		for key, value := range overlayObject {
+			baseObject[key] = merge(baseObject[key], value, join(path, key), file, sources)
+		}
+		return baseObject
+	}
+
+	baseList, baseIsList := base.([]any)
+	overlayList, overlayIsList := overlay.([]any)
+	if baseIsList && overlayIsList && isNamedList(baseList) && isNamedList(overlayList) {
+		for _, entry := range overlayList {
+			name := entry.(map[string]any)["name"]
+
+			index := indexByName(baseList, name)
+			if index < 0 {
+				sources.record(entry, join(path, strconv.Itoa(len(baseList))), file)
+				baseList = append(baseList, entry)
+				continue
+			}
+
+			baseList[index] = merge(baseList[index], entry, join(path, strconv.Itoa(index)), file, sources)
+		}
+		return baseList
+	}
+
+	sources.clear(path)
+	sources.record(overlay, path, file)
+	return overlay
+}
+
+func (s Sources) record(value any, path, file string) {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, child := range value {
+			s.record(child, join(path, key), file)
+		}
+	case []any:
+		if !isNamedList(value) {
+			s[path] = file
+			return
+		}
+		for i, child := range value {
+			s.record(child, join(path, strconv.Itoa(i)), file)
+		}
+	default:
+		s[path] = file
+	}
+}
+
+func (s Sources) clear(path string) {
+	for key := range s {
+		if key == path || strings.HasPrefix(key, path+".") {
+			delete(s, key)
+		}
+	}
+}
+
+// isNamedList reports whether every entry in a list is an object with a name
+func isNamedList(list []any) bool {
+	if len(list) == 0 {
+		return false
+	}
+
+	for _, entry := range list {
+		object, ok := entry.(map[string]any)
+		if !ok {
+			return false
+		}
+		if _, ok := object["name"].(string); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func indexByName(list []any, name any) int {
+	for i, entry := range list {
+		if entry.(map[string]any)["name"] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,184 @@
+package overlay
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		overlay string
+		want    string
+		sources map[string]string
+	}{
+		{
+			name:    "no overlay",
+			base:    `{"memory": 128}`,
+			want:    `{"memory": 128}`,
+			sources: map[string]string{"memory": "base"},
+		},
+		{
+			name:    "objects merge key by key",
+			base:    `{"defaults": {"memory": 128, "timeout": 3}}`,
+			overlay: `{"defaults": {"memory": 512}}`,
+			want:    `{"defaults": {"memory": 512, "timeout": 3}}`,
+			sources: map[string]string{"defaults.memory": "overlay", "defaults.timeout": "base"},
+		},
+		{
+			name:    "named lists merge by name",
+			base:    `{"functions": [{"name": "a", "memory": 128}, {"name": "b", "memory": 128}]}`,
+			overlay: `{"functions": [{"name": "b", "memory": 1024}]}`,
+			want:    `{"functions": [{"name": "a", "memory": 128}, {"name": "b", "memory": 1024}]}`,
+			sources: map[string]string{
+				"functions.0.name": "base", "functions.0.memory": "base",
+				"functions.1.name": "overlay", "functions.1.memory": "overlay",
+			},
+		},
+		{
+			name:    "new names are appended",
+			base:    `{"functions": [{"name": "a"}]}`,
+			overlay: `{"functions": [{"name": "c", "memory": 256}]}`,
+			want:    `{"functions": [{"name": "a"}, {"name": "c", "memory": 256}]}`,
+			sources: map[string]string{"functions.0.name": "base", "functions.1.name": "overlay", "functions.1.memory": "overlay"},
+		},
+		{
+			name:    "plain lists are replaced",
+			base:    `{"layers": ["one", "two"]}`,
+			overlay: `{"layers": ["three"]}`,
+			want:    `{"layers": ["three"]}`,
+			sources: map[string]string{"layers": "overlay"},
+		},
+		{
+			name:    "an object replaced by a scalar drops its sources",
+			base:    `{"vpc": {"subnetIds": ["a"]}}`,
+			overlay: `{"vpc": null}`,
+			want:    `{"vpc": null}`,
+			sources: map[string]string{"vpc": "overlay"},
+		},
+		{
+			name:    "nested named lists",
+			base:    `{"stages": [{"name": "s", "hooks": {"preDeploy": ["make"]}, "routes": [{"name": "r", "path": "/a"}]}]}`,
+			overlay: `{"stages": [{"name": "s", "routes": [{"name": "r", "path": "/b"}]}]}`,
+			want:    `{"stages": [{"name": "s", "hooks": {"preDeploy": ["make"]}, "routes": [{"name": "r", "path": "/b"}]}]}`,
+			sources: map[string]string{
+				"stages.0.name": "overlay", "stages.0.hooks.preDeploy": "base",
+				"stages.0.routes.0.name": "overlay", "stages.0.routes.0.path": "overlay",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			basePath := filepath.Join(dir, "config.json")
+			overlayPath := FilePath(basePath, "prod")
+			writeFile(t, basePath, tt.base)
+			if tt.overlay != "" {
+				writeFile(t, overlayPath, tt.overlay)
+			}
+
+			var got any
+			sources, err := Read(basePath, "prod", &got)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("merged = %v, want %v", got, want)
+			}
+
+			files := map[string]string{"base": basePath, "overlay": overlayPath}
+			wantSources := make(Sources)
+			for key, file := range tt.sources {
+				wantSources[key] = files[file]
+			}
+			if !reflect.DeepEqual(sources, wantSources) {
+				t.Errorf("sources = %v, want %v", sources, wantSources)
+			}
+		})
+	}
+}
+
+func TestReadWithoutEnv(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "config.json")
+	writeFile(t, basePath, `{"memory": 128}`)
+	writeFile(t, FilePath(basePath, "prod"), `{"memory": 512}`)
+
+	var got map[string]any
+	if _, err := Read(basePath, "", &got); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if got["memory"] != float64(128) {
+		t.Errorf("memory = %v, want 128", got["memory"])
+	}
+}
+
+func TestReadInvalidOverlay(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "config.json")
+	writeFile(t, basePath, `{"memory": 128}`)
+	writeFile(t, FilePath(basePath, "prod"), `{"memory": `)
+
+	var got map[string]any
+	if _, err := Read(basePath, "prod", &got); err == nil {
+		t.Error("expected an error for an invalid overlay")
+	}
+}
+
+func TestFilePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "stages/lambdas.json", want: "stages/lambdas.prod.json"},
+		{path: "project.json", want: "project.prod.json"},
+		{path: "config", want: "config.prod"},
+	}
+
+	for _, tt := range tests {
+		if got := FilePath(tt.path, "prod"); got != tt.want {
+			t.Errorf("FilePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	sources := Sources{
+		"functions.0.name":   "base.json",
+		"functions.0.memory": "prod.json",
+		"functions.1.name":   "base.json",
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "functions.0.memory", want: "prod.json"},
+		{path: "functions.0", want: "base.json, prod.json"},
+		{path: "functions.1", want: "base.json"},
+		{path: "functions.2", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := sources.Origin(tt.path); got != tt.want {
+			t.Errorf("Origin(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -10,6 +10,7 @@ type LabradorConfig struct {
 type ResourceTarget struct {
 	Ref      *string            `json:"ref,omitempty"`
 	External *ExternalReference `json:"external,omitempty"`
+	Alias    *string            `json:"alias,omitempty"`
 }
 
 type ExternalReference struct {
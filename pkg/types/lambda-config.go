@@ -1,34 +1,153 @@
 package types
 
+import (
+	"encoding/json"
+	"strings"
+)
+
 type LambdaData struct {
 	Defaults  *LambdaDefaults `json:"defaults,omitempty"`
 	Functions []LambdaConfig  `json:"functions"`
 }
 
 type LambdaDefaults struct {
-	Region      *string           `json:"region,omitempty"`
-	RoleArn     *string           `json:"roleArn,omitempty"`
-	Handler     *string           `json:"handler,omitempty"`
-	Runtime     *string           `json:"runtime,omitempty"`
-	Code        *string           `json:"code,omitempty"`
-	MemorySize  *uint16           `json:"memory,omitempty"`
-	Timeout     *uint16           `json:"timeout,omitempty"`
-	Description *string           `json:"description,omitempty"`
-	Tags        map[string]string `json:"tags,omitempty"`
-	Environment map[string]string `json:"environment,omitempty"`
+	Region              *string                 `json:"region,omitempty"`
+	PackageType         *string                 `json:"packageType,omitempty"`
+	Architecture        *string                 `json:"architecture,omitempty"`
+	RoleArn             *string                 `json:"roleArn,omitempty"`
+	Handler             *string                 `json:"handler,omitempty"`
+	Runtime             *string                 `json:"runtime,omitempty"`
+	Code                *string                 `json:"code,omitempty"`
+	Include             []string                `json:"include,omitempty"`
+	Exclude             []string                `json:"exclude,omitempty"`
+	CodeBucket          *string                 `json:"codeBucket,omitempty"`
+	CodeKeyPrefix       *string                 `json:"codeKeyPrefix,omitempty"`
+	CodeRetention       *uint16                 `json:"codeRetention,omitempty"`
+	RetainVersions      *uint16                 `json:"retainVersions,omitempty"`
+	MemorySize          *uint16                 `json:"memory,omitempty"`
+	Timeout             *uint16                 `json:"timeout,omitempty"`
+	Description         *string                 `json:"description,omitempty"`
+	WaitTimeout         *uint16                 `json:"waitTimeout,omitempty"`
+	Layers              []string                `json:"layers,omitempty"`
+	EphemeralStorage    *uint16                 `json:"ephemeralStorage,omitempty"`
+	VpcConfig           *LambdaVpcConfig        `json:"vpcConfig,omitempty"`
+	TracingConfig       *LambdaTracingConfig    `json:"tracingConfig,omitempty"`
+	DeadLetterConfig    *LambdaDeadLetterConfig `json:"deadLetterConfig,omitempty"`
+	KmsKeyArn           *string                 `json:"kmsKeyArn,omitempty"`
+	LoggingConfig       *LambdaLoggingConfig    `json:"loggingConfig,omitempty"`
+	ReservedConcurrency *uint16                 `json:"reservedConcurrency,omitempty"`
+	Tags                map[string]string       `json:"tags,omitempty"`
+	Environment         map[string]string       `json:"environment,omitempty"`
 }
 
 type LambdaConfig struct {
-	Name        string            `json:"name"`
-	Region      *string           `json:"region,omitempty"`
-	RoleArn     *string           `json:"roleArn,omitempty"`
-	Handler     *string           `json:"handler,omitempty"`
-	Runtime     *string           `json:"runtime,omitempty"`
-	Code        *string           `json:"code,omitempty"`
-	MemorySize  *uint16           `json:"memory,omitempty"`
-	Timeout     *uint16           `json:"timeout,omitempty"`
-	Description *string           `json:"description,omitempty"`
-	OnDelete    *string           `json:"onDelete,omitempty"`
-	Tags        map[string]string `json:"tags,omitempty"`
-	Environment map[string]string `json:"environment,omitempty"`
+	Name                string                  `json:"name"`
+	Ref                 *string                 `json:"ref,omitempty"`
+	Region              *string                 `json:"region,omitempty"`
+	PackageType         *string                 `json:"packageType,omitempty"`
+	Architecture        *string                 `json:"architecture,omitempty"`
+	RoleArn             *string                 `json:"roleArn,omitempty"`
+	Handler             *string                 `json:"handler,omitempty"`
+	Runtime             *string                 `json:"runtime,omitempty"`
+	Code                *string                 `json:"code,omitempty"`
+	Include             []string                `json:"include,omitempty"`
+	Exclude             []string                `json:"exclude,omitempty"`
+	CodeBucket          *string                 `json:"codeBucket,omitempty"`
+	CodeKeyPrefix       *string                 `json:"codeKeyPrefix,omitempty"`
+	CodeRetention       *uint16                 `json:"codeRetention,omitempty"`
+	RetainVersions      *uint16                 `json:"retainVersions,omitempty"`
+	ImageUri            *string                 `json:"imageUri,omitempty"`
+	ImageConfig         *LambdaImageConfig      `json:"imageConfig,omitempty"`
+	MemorySize          *uint16                 `json:"memory,omitempty"`
+	Timeout             *uint16                 `json:"timeout,omitempty"`
+	Description         *string                 `json:"description,omitempty"`
+	OnDelete            *string                 `json:"onDelete,omitempty"`
+	WaitTimeout         *uint16                 `json:"waitTimeout,omitempty"`
+	Layers              []string                `json:"layers,omitempty"`
+	EphemeralStorage    *uint16                 `json:"ephemeralStorage,omitempty"`
+	VpcConfig           *LambdaVpcConfig        `json:"vpcConfig,omitempty"`
+	TracingConfig       *LambdaTracingConfig    `json:"tracingConfig,omitempty"`
+	DeadLetterConfig    *LambdaDeadLetterConfig `json:"deadLetterConfig,omitempty"`
+	KmsKeyArn           *string                 `json:"kmsKeyArn,omitempty"`
+	LoggingConfig       *LambdaLoggingConfig    `json:"loggingConfig,omitempty"`
+	ReservedConcurrency *uint16                 `json:"reservedConcurrency,omitempty"`
+	Aliases             []LambdaAlias           `json:"aliases,omitempty"`
+	EventSources        []LambdaEventSource     `json:"eventSources,omitempty"`
+	Schedules           []LambdaSchedule        `json:"schedules,omitempty"`
+	Tags                map[string]string       `json:"tags,omitempty"`
+	Environment         map[string]string       `json:"environment,omitempty"`
+}
+
+// LambdaAlias is a named pointer, e.g. live, to a published version of a function
+type LambdaAlias struct {
+	Name          string              `json:"name"`
+	Description   *string             `json:"description,omitempty"`
+	RoutingConfig *LambdaAliasRouting `json:"routingConfig,omitempty"`
+}
+
+// LambdaAliasRouting sends a share of an alias's traffic, between 0 and 1, to
+// a newly published version until the alias is promoted
+type LambdaAliasRouting struct {
+	Weight float64 `json:"weight"`
+}
+
+// LambdaEventSource has a function poll an SQS queue, DynamoDB stream or
+// Kinesis stream. The source is either sourceArn or a target to resolve.
+type LambdaEventSource struct {
+	SourceArn          *string           `json:"sourceArn,omitempty"`
+	Source             *ResourceTarget   `json:"source,omitempty"`
+	BatchSize          *uint16           `json:"batchSize,omitempty"`
+	BatchingWindow     *uint16           `json:"batchingWindow,omitempty"`
+	StartingPosition   *string           `json:"startingPosition,omitempty"`
+	Enabled            *bool             `json:"enabled,omitempty"`
+	FilterCriteria     []json.RawMessage `json:"filterCriteria,omitempty"`
+	FailureDestination *string           `json:"failureDestination,omitempty"`
+}
+
+// LambdaSchedule invokes a function on a rate or cron expression. Schedules
+// with a timezone run on EventBridge Scheduler, which needs roleArn to invoke
+// the function. Others are EventBridge rules.
+type LambdaSchedule struct {
+	Name       string          `json:"name"`
+	Expression string          `json:"expression"`
+	Timezone   *string         `json:"timezone,omitempty"`
+	Input      json.RawMessage `json:"input,omitempty"`
+	Enabled    *bool           `json:"enabled,omitempty"`
+	RoleArn    *string         `json:"roleArn,omitempty"`
+}
+
+// LambdaImageConfig overrides the settings baked into a container image
+type LambdaImageConfig struct {
+	Command          []string `json:"command,omitempty"`
+	EntryPoint       []string `json:"entryPoint,omitempty"`
+	WorkingDirectory *string  `json:"workingDirectory,omitempty"`
+}
+
+// LambdaVpcConfig connects a function to a VPC
+type LambdaVpcConfig struct {
+	SubnetIds        []string `json:"subnetIds,omitempty"`
+	SecurityGroupIds []string `json:"securityGroupIds,omitempty"`
+}
+
+// LambdaTracingConfig sets the X-Ray tracing mode, Active or PassThrough
+type LambdaTracingConfig struct {
+	Mode string `json:"mode"`
+}
+
+// LambdaDeadLetterConfig names the SQS queue or SNS topic failed async invocations are sent to
+type LambdaDeadLetterConfig struct {
+	TargetArn string `json:"targetArn"`
+}
+
+// LambdaLoggingConfig controls the format and destination of a function's logs
+type LambdaLoggingConfig struct {
+	LogFormat           *string `json:"logFormat,omitempty"`
+	LogGroup            *string `json:"logGroup,omitempty"`
+	ApplicationLogLevel *string `json:"applicationLogLevel,omitempty"`
+	SystemLogLevel      *string `json:"systemLogLevel,omitempty"`
+}
+
+// IsImage reports whether the function is deployed from a container image rather than a zip
+func (fn *LambdaConfig) IsImage() bool {
+	return fn.PackageType != nil && strings.EqualFold(*fn.PackageType, "Image")
 }
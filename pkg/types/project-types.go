@@ -3,6 +3,8 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/DQGriffin/labrador/pkg/overlay"
 )
 
 type Project struct {
@@ -10,12 +12,22 @@ type Project struct {
 	Environment string            `json:"environment"`
 	Stages      []Stage           `json:"stages"`
 	Variables   map[string]string `json:"variables,omitempty" ,interpolate:"false"`
+	State       *StateConfig      `json:"state,omitempty"`
+}
+
+type StateConfig struct {
+	Backend    string `json:"backend"`
+	Path       string `json:"path,omitempty"`
+	Bucket     string `json:"bucket,omitempty"`
+	Key        string `json:"key,omitempty"`
+	Region     string `json:"region,omitempty"`
+	LockExpiry int    `json:"lockExpiry,omitempty"`
 }
 
 type Stage struct {
 	Name         string             `json:"name"`
 	Type         string             `json:"type"`
-	Enabled      bool               `json:"enabled,omitempty"`
+	Enabled      *Toggle            `json:"enabled,omitempty"`
 	OnConflict   string             `json:"onConflict"`
 	OnError      string             `json:"onError"`
 	ConfigFile   string             `json:"config"`
@@ -25,6 +37,16 @@ type Stage struct {
 	Functions    []LambdaData       `json:"-"`
 	Buckets      []S3Config         `json:"-"`
 	Gateways     []ApiGatewayConfig `json:"-"`
+	// Sources records which file each value in the stage's config came from
+	Sources overlay.Sources `json:"-"`
+}
+
+// IsEnabled reports whether the stage is switched on. Stages are enabled unless they say otherwise.
+func (s *Stage) IsEnabled() (bool, error) {
+	if s.Enabled == nil {
+		return true, nil
+	}
+	return s.Enabled.Bool()
 }
 
 type Hooks struct {
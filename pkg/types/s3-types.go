@@ -13,6 +13,7 @@ type S3Settings struct {
 	BlockPublicAccess *bool                  `json:"blockPublicAccess,omitempty"`
 	StaticHosting     *StaticHostingSettings `json:"staticHosting,omitempty"`
 	Tags              map[string]string      `json:"tags,omitempty"`
+	Notifications     []S3Notification       `json:"notifications,omitempty"`
 }
 
 type StaticHostingSettings struct {
@@ -20,3 +21,12 @@ type StaticHostingSettings struct {
 	IndexDocument *string `json:"indexDocument,omitempty"`
 	ErrorDocument *string `json:"errorDocument,omitempty"`
 }
+
+// S3Notification invokes a Lambda when objects matching the filters change.
+// Events are S3 event types, e.g. s3:ObjectCreated:*
+type S3Notification struct {
+	Events []string       `json:"events"`
+	Prefix *string        `json:"prefix,omitempty"`
+	Suffix *string        `json:"suffix,omitempty"`
+	Target ResourceTarget `json:"target"`
+}
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Toggle is an on/off setting that can be written as a JSON boolean or as a
+// string, so it can be set from a variable, e.g. "enabled": "{{feature_x}}"
+type Toggle string
+
+func NewToggle(value bool) *Toggle {
+	t := Toggle(strconv.FormatBool(value))
+	return &t
+}
+
+// Bool parses the toggle once variables have been resolved
+func (t Toggle) Bool() (bool, error) {
+	value, err := strconv.ParseBool(string(t))
+	if err != nil {
+		return false, fmt.Errorf("%q is not true or false", string(t))
+	}
+	return value, nil
+}
+
+func (t *Toggle) UnmarshalJSON(data []byte) error {
+	var value bool
+	if err := json.Unmarshal(data, &value); err == nil {
+		*t = Toggle(strconv.FormatBool(value))
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("toggle must be a boolean or a string: %w", err)
+	}
+
+	*t = Toggle(text)
+	return nil
+}
+
+// MarshalJSON writes plain booleans back as booleans and anything else, such
+// as an unresolved variable, as a string
+func (t Toggle) MarshalJSON() ([]byte, error) {
+	if value, err := t.Bool(); err == nil {
+		return json.Marshal(value)
+	}
+	return json.Marshal(string(t))
+}
@@ -0,0 +1,78 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToggleUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Toggle
+		enabled bool
+		invalid bool
+	}{
+		{name: "true", input: `true`, want: "true", enabled: true},
+		{name: "false", input: `false`, want: "false", enabled: false},
+		{name: "string true", input: `"true"`, want: "true", enabled: true},
+		{name: "string false", input: `"false"`, want: "false", enabled: false},
+		{name: "unresolved variable", input: `"{{feature_x}}"`, want: "{{feature_x}}", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var toggle Toggle
+			if err := json.Unmarshal([]byte(tt.input), &toggle); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if toggle != tt.want {
+				t.Errorf("toggle = %q, want %q", toggle, tt.want)
+			}
+
+			enabled, err := toggle.Bool()
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("Bool() = %t, want an error", enabled)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bool: %v", err)
+			}
+			if enabled != tt.enabled {
+				t.Errorf("Bool() = %t, want %t", enabled, tt.enabled)
+			}
+		})
+	}
+}
+
+func TestToggleUnmarshalJSONRejectsOtherTypes(t *testing.T) {
+	for _, input := range []string{`1`, `{}`, `["true"]`} {
+		var toggle Toggle
+		if err := json.Unmarshal([]byte(input), &toggle); err == nil {
+			t.Errorf("Unmarshal(%s) = %q, want an error", input, toggle)
+		}
+	}
+}
+
+func TestToggleMarshalJSON(t *testing.T) {
+	tests := []struct {
+		toggle Toggle
+		want   string
+	}{
+		{toggle: "true", want: `true`},
+		{toggle: "false", want: `false`},
+		{toggle: "{{feature_x}}", want: `"{{feature_x}}"`},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.toggle)
+		if err != nil {
+			t.Fatalf("Marshal(%q): %v", tt.toggle, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("Marshal(%q) = %s, want %s", tt.toggle, data, tt.want)
+		}
+	}
+}
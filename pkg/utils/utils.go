@@ -1,12 +1,12 @@
 package utils
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
 
 	"github.com/DQGriffin/labrador/internal/cli/console"
+	"github.com/DQGriffin/labrador/pkg/overlay"
 	"github.com/DQGriffin/labrador/pkg/types"
 	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/urfave/cli/v2"
@@ -69,61 +69,47 @@ func BuildFunctionMap(fns []lambdaTypes.FunctionConfiguration) map[string]lambda
 	return m
 }
 
-func ReadProjectData(filepath string) (types.Project, error) {
+// ReadProjectData reads the project config, merging in the overlay for env if
+// there is one. Pass an empty env to read the base file alone.
+func ReadProjectData(filepath, env string) (types.Project, error) {
 	var project types.Project
 
-	file, err := os.Open(filepath)
-	if err != nil {
+	if _, err := overlay.Read(filepath, env, &project); err != nil {
 		console.Error("Failed to read project config")
 		console.Error(err.Error())
 		return project, err
 	}
-	defer file.Close()
-
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&project); err != nil {
-		console.Error("Failed to decode project config")
-		console.Error(err.Error())
-		return project, err
-	}
 
 	return project, nil
 }
 
-func ReadFunctionConfig(filepath string) (types.LambdaData, error) {
+func ReadFunctionConfig(filepath, env string) (types.LambdaData, overlay.Sources, error) {
 	var functionData types.LambdaData
 
-	file, err := os.Open(filepath)
+	sources, err := overlay.Read(filepath, env, &functionData)
 	if err != nil {
 		console.Error("Failed to read function config")
 		console.Error(err.Error())
-		return functionData, err
+		return functionData, nil, err
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&functionData); err != nil {
-		console.Error("Failed to decode function config")
-		console.Error(err.Error())
-		return functionData, err
-	}
-
-	return functionData, nil
+	return functionData, sources, nil
 }
 
-func ReadFunctionConfigs(stages *[]types.Stage) ([]types.LambdaData, error) {
+func ReadFunctionConfigs(stages *[]types.Stage, env string) ([]types.LambdaData, error) {
 	var configs []types.LambdaData
 
 	for i := range *stages {
 		stage := &(*stages)[i]
 
 		if stage.Type == "lambda" {
-			data, err := ReadFunctionConfig(stage.ConfigFile)
+			data, sources, err := ReadFunctionConfig(stage.ConfigFile, env)
 
 			if err != nil {
 				console.Error("Failed to read lambda config")
 				return configs, err
 			}
+			stage.Sources = sources
 			stage.Functions = append(stage.Functions, data)
 			configs = append(configs, data)
 		}
@@ -132,18 +118,19 @@ func ReadFunctionConfigs(stages *[]types.Stage) ([]types.LambdaData, error) {
 	return configs, nil
 }
 
-func ReadS3Configs(stages *[]types.Stage) ([]types.S3Config, error) {
+func ReadS3Configs(stages *[]types.Stage, env string) ([]types.S3Config, error) {
 	var configs []types.S3Config
 
 	for i := range *stages {
 		stage := &(*stages)[i]
 
 		if stage.Type == "s3" {
-			config, err := readS3Config(stage.ConfigFile)
+			config, sources, err := readS3Config(stage.ConfigFile, env)
 
 			if err != nil {
 				return configs, err
 			}
+			stage.Sources = sources
 
 			for i := range config.Buckets {
 				ApplyDefaults(&config.Buckets[i], *config.Defaults)
@@ -157,39 +144,32 @@ func ReadS3Configs(stages *[]types.Stage) ([]types.S3Config, error) {
 	return configs, nil
 }
 
-func readS3Config(filepath string) (types.S3Config, error) {
+func readS3Config(filepath, env string) (types.S3Config, overlay.Sources, error) {
 	var config types.S3Config
 
-	file, err := os.Open(filepath)
+	sources, err := overlay.Read(filepath, env, &config)
 	if err != nil {
 		console.Error("Failed to read s3 config")
 		console.Error(err.Error())
-		return config, err
-	}
-	defer file.Close()
-
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		console.Error("Failed to decode s3 config")
-		console.Error(err.Error())
-		return config, err
+		return config, nil, err
 	}
 
-	return config, nil
+	return config, sources, nil
 }
 
-func ReadApiGatewayConfigs(stages *[]types.Stage) ([]types.ApiGatewayConfig, error) {
+func ReadApiGatewayConfigs(stages *[]types.Stage, env string) ([]types.ApiGatewayConfig, error) {
 	var configs []types.ApiGatewayConfig
 
 	for i := range *stages {
 		stage := &(*stages)[i]
 
 		if stage.Type == "api" {
-			config, err := readApiGatewayConfig(stage.ConfigFile)
+			config, sources, err := readApiGatewayConfig(stage.ConfigFile, env)
 
 			if err != nil {
 				return configs, err
 			}
+			stage.Sources = sources
 
 			for i := range config.Gateways {
 				ApplyDefaults(&config.Gateways[i], *config.Defaults)
@@ -203,25 +183,17 @@ func ReadApiGatewayConfigs(stages *[]types.Stage) ([]types.ApiGatewayConfig, err
 	return configs, nil
 }
 
-func readApiGatewayConfig(filepath string) (types.ApiGatewayConfig, error) {
+func readApiGatewayConfig(filepath, env string) (types.ApiGatewayConfig, overlay.Sources, error) {
 	var config types.ApiGatewayConfig
 
-	file, err := os.Open(filepath)
+	sources, err := overlay.Read(filepath, env, &config)
 	if err != nil {
 		console.Error("Failed to read API gateway config")
 		console.Error(err.Error())
-		return config, err
-	}
-	defer file.Close()
-
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		console.Error("Failed to decode API gateway config")
-		console.Error(err.Error())
-		return config, err
+		return config, nil, err
 	}
 
-	return config, nil
+	return config, sources, nil
 }
 
 func ApplyDefaultsToFunctions(functionData *types.LambdaData) {
@@ -231,24 +203,49 @@ func ApplyDefaultsToFunctions(functionData *types.LambdaData) {
 }
 
 func applyDefaultsToFunction(function *types.LambdaConfig, defaults types.LambdaDefaults) {
-	if (function.Code == nil || *function.Code == "") && defaults.Code != nil {
-		function.Code = defaults.Code
+	if (function.PackageType == nil || *function.PackageType == "") && defaults.PackageType != nil {
+		function.PackageType = defaults.PackageType
 	}
 
-	if function.Environment == nil && defaults.Environment != nil {
-		function.Environment = defaults.Environment
+	if (function.Architecture == nil || *function.Architecture == "") && defaults.Architecture != nil {
+		function.Architecture = defaults.Architecture
 	}
 
-	if function.Tags == nil && defaults.Tags != nil {
-		function.Tags = defaults.Tags
+	// Image functions take their code, handler, and runtime from the image
+	if !function.IsImage() {
+		applyZipDefaultsToFunction(function, defaults)
 	}
 
-	if (function.Handler == nil || *function.Handler == "") && defaults.Handler != nil {
-		function.Handler = defaults.Handler
+	if function.Include == nil && defaults.Include != nil {
+		function.Include = defaults.Include
 	}
 
-	if (function.Runtime == nil || *function.Runtime == "") && defaults.Runtime != nil {
-		function.Runtime = defaults.Runtime
+	if function.Exclude == nil && defaults.Exclude != nil {
+		function.Exclude = defaults.Exclude
+	}
+
+	if (function.CodeBucket == nil || *function.CodeBucket == "") && defaults.CodeBucket != nil {
+		function.CodeBucket = defaults.CodeBucket
+	}
+
+	if function.CodeKeyPrefix == nil && defaults.CodeKeyPrefix != nil {
+		function.CodeKeyPrefix = defaults.CodeKeyPrefix
+	}
+
+	if function.CodeRetention == nil && defaults.CodeRetention != nil {
+		function.CodeRetention = defaults.CodeRetention
+	}
+
+	if function.RetainVersions == nil && defaults.RetainVersions != nil {
+		function.RetainVersions = defaults.RetainVersions
+	}
+
+	if function.Environment == nil && defaults.Environment != nil {
+		function.Environment = defaults.Environment
+	}
+
+	if function.Tags == nil && defaults.Tags != nil {
+		function.Tags = defaults.Tags
 	}
 
 	if (function.Region == nil || *function.Region == "") && defaults.Region != nil {
@@ -270,4 +267,54 @@ func applyDefaultsToFunction(function *types.LambdaConfig, defaults types.Lambda
 	if (function.Description == nil || *function.Description == "") && defaults.Description != nil {
 		function.Description = defaults.Description
 	}
+
+	if (function.WaitTimeout == nil || *function.WaitTimeout == 0) && defaults.WaitTimeout != nil {
+		function.WaitTimeout = defaults.WaitTimeout
+	}
+
+	if function.Layers == nil && defaults.Layers != nil {
+		function.Layers = defaults.Layers
+	}
+
+	if (function.EphemeralStorage == nil || *function.EphemeralStorage == 0) && defaults.EphemeralStorage != nil {
+		function.EphemeralStorage = defaults.EphemeralStorage
+	}
+
+	if function.VpcConfig == nil && defaults.VpcConfig != nil {
+		function.VpcConfig = defaults.VpcConfig
+	}
+
+	if function.TracingConfig == nil && defaults.TracingConfig != nil {
+		function.TracingConfig = defaults.TracingConfig
+	}
+
+	if function.DeadLetterConfig == nil && defaults.DeadLetterConfig != nil {
+		function.DeadLetterConfig = defaults.DeadLetterConfig
+	}
+
+	if (function.KmsKeyArn == nil || *function.KmsKeyArn == "") && defaults.KmsKeyArn != nil {
+		function.KmsKeyArn = defaults.KmsKeyArn
+	}
+
+	if function.LoggingConfig == nil && defaults.LoggingConfig != nil {
+		function.LoggingConfig = defaults.LoggingConfig
+	}
+
+	if function.ReservedConcurrency == nil && defaults.ReservedConcurrency != nil {
+		function.ReservedConcurrency = defaults.ReservedConcurrency
+	}
+}
+
+func applyZipDefaultsToFunction(function *types.LambdaConfig, defaults types.LambdaDefaults) {
+	if (function.Code == nil || *function.Code == "") && defaults.Code != nil {
+		function.Code = defaults.Code
+	}
+
+	if (function.Handler == nil || *function.Handler == "") && defaults.Handler != nil {
+		function.Handler = defaults.Handler
+	}
+
+	if (function.Runtime == nil || *function.Runtime == "") && defaults.Runtime != nil {
+		function.Runtime = defaults.Runtime
+	}
 }